@@ -35,6 +35,9 @@ mim dataset delete
 mim dataset entities --name=<dataset>
 mim dataset changes --name=<dataset>
 mim dataset store --name=<dataset> --filename=<entities file to load>
+mim dataset apply -f datasets.yaml
+mim dataset preview-virtual view.ts --source=<dataset>
+mim dataset export 'tmp.*' --dir=<directory>
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		if len(args) == 0 {
@@ -54,6 +57,20 @@ func init() {
 	DatasetCmd.AddCommand(datasets.GetCmd)
 	DatasetCmd.AddCommand(datasets.StoreCmd)
 	DatasetCmd.AddCommand(datasets.RenameCmd)
+	DatasetCmd.AddCommand(datasets.ApplyCmd)
+	DatasetCmd.AddCommand(datasets.PreviewVirtualCmd)
+	DatasetCmd.AddCommand(datasets.ExportCmd)
+	DatasetCmd.AddCommand(datasets.AsOfCmd)
+	DatasetCmd.AddCommand(datasets.ActivityCmd)
+	DatasetCmd.AddCommand(datasets.ChecksumCmd)
+	DatasetCmd.AddCommand(datasets.SampleCmd)
+	DatasetCmd.AddCommand(datasets.CheckRefsCmd)
+	DatasetCmd.AddCommand(datasets.DuplicatesCmd)
+	DatasetCmd.AddCommand(datasets.MigrateNamespaceCmd)
+	DatasetCmd.AddCommand(datasets.GenerateCmd)
+	DatasetCmd.AddCommand(datasets.PullCmd)
+	DatasetCmd.AddCommand(datasets.PushCmd)
+	DatasetCmd.AddCommand(datasets.DescribeCmd)
 
 	DatasetCmd.SetHelpFunc(func(command *cobra.Command, strings []string) {
 		pterm.Println()
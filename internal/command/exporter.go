@@ -0,0 +1,61 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+	"github.com/mimiro-io/datahub-cli/internal/exporter"
+	"github.com/mimiro-io/datahub-cli/internal/utils"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"os"
+	"time"
+)
+
+var ExporterCmd = &cobra.Command{
+	Use:   "exporter",
+	Short: "Serve datahub job and dataset metrics for Prometheus",
+	Long: `Serves the state of a connected data hub as Prometheus metrics on /metrics. The metrics are read from
+the hub on an interval, and cover the last duration, processed count and error of each job, whether
+jobs are paused or running, and the entities, changes and storage size of each dataset from /statistics.
+Examples:
+mim exporter --login prod --port 9200
+mim exporter --login prod --port 9200 --interval 1m
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		alias, err := cmd.Flags().GetString("login")
+		utils.HandleError(err)
+		port, err := cmd.Flags().GetString("port")
+		utils.HandleError(err)
+		interval, err := cmd.Flags().GetDuration("interval")
+		utils.HandleError(err)
+		if interval <= 0 {
+			pterm.Error.Println("The interval must be larger than 0")
+			os.Exit(1)
+		}
+
+		login := alias
+		if login == "" {
+			login = "the active"
+		}
+		pterm.Success.Println("Serving metrics on http://localhost:" + port + "/metrics with " + login + " login alias")
+		utils.HandleError(exporter.StartExporter(alias, port, interval))
+	},
+}
+
+func init() {
+	ExporterCmd.Flags().StringP("login", "l", "", "The account alias to use to indicate which datahub to connect to. Uses the active login if not set.")
+	ExporterCmd.Flags().StringP("port", "p", "9200", "The port on which the metrics are exposed.")
+	ExporterCmd.Flags().Duration("interval", 30*time.Second, "How often to read the metrics from the datahub.")
+}
@@ -55,6 +55,13 @@ func init() {
 	JobsCmd.AddCommand(jobs.CmdOperate())
 	JobsCmd.AddCommand(jobs.StatusCmd)
 	JobsCmd.AddCommand(jobs.HistoryCmd)
+	JobsCmd.AddCommand(jobs.ApplyCmd)
+	JobsCmd.AddCommand(jobs.ExportCmd)
+	JobsCmd.AddCommand(jobs.ValidateCmd)
+	JobsCmd.AddCommand(jobs.GraphCmd)
+	JobsCmd.AddCommand(jobs.RunChainCmd)
+	JobsCmd.AddCommand(jobs.TopCmd)
+	JobsCmd.AddCommand(jobs.CheckCmd)
 
 	// TODO: write nice documentation
 
@@ -167,9 +167,18 @@ func GetValue(key string) ([]byte, error) {
 	var res []byte
 	err = db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(bucket))
+		if b == nil { // nothing has been stored yet
+			return nil
+		}
 		res = b.Get([]byte(key))
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+	if res == nil {
+		return nil, nil
+	}
 
 	// because we close the db, there is some sort of ref to the original
 	// byte slice that gets lost, so need to copy it to get it out properly
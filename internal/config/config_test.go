@@ -0,0 +1,49 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/franela/goblin"
+)
+
+func TestGetValue(t *testing.T) {
+	g := Goblin(t)
+	g.Describe("Reading values", func() {
+		g.BeforeEach(func() {
+			t.Setenv("HOME", t.TempDir())
+		})
+		g.It("should return no value when nothing has been stored yet", func() {
+			v, err := GetValue("missing")
+			g.Assert(err).IsNil()
+			g.Assert(v == nil).IsTrue()
+		})
+		g.It("should return no value for a missing key", func() {
+			g.Assert(WriteValue("present", []byte(`"value"`))).IsNil()
+			v, err := GetValue("missing")
+			g.Assert(err).IsNil()
+			g.Assert(v == nil).IsTrue()
+		})
+		g.It("should return ErrValueNotFound when loading a missing key", func() {
+			g.Assert(WriteValue("present", []byte(`"value"`))).IsNil()
+			var s string
+			g.Assert(errors.Is(Load("missing", &s), ErrValueNotFound)).IsTrue()
+			g.Assert(Load("present", &s)).IsNil()
+			g.Assert(s).Equal("value")
+		})
+	})
+}
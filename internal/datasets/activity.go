@@ -0,0 +1,285 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datasets
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/mimiro-io/datahub-cli/internal/login"
+	"github.com/mimiro-io/datahub-cli/internal/utils"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"github.com/tidwall/pretty"
+)
+
+// ActivityCmd analyses the change log of a dataset
+var ActivityCmd = &cobra.Command{
+	Use:   "activity",
+	Short: "Show the change activity of a dataset over time",
+	Long: `Read the change log of a dataset, and show the number of changes per time bucket, how many
+changes created, updated or deleted entities, and which entities were rewritten most often. For example:
+mim dataset activity people.Person --bucket 1h
+or
+mim dataset activity people.Person --bucket 24h --top 20 --json
+`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		format := utils.ResolveFormat(cmd)
+		if format != "term" {
+			pterm.DisableOutput()
+		}
+
+		server, token, err := login.ResolveCredentials()
+		utils.HandleError(err)
+
+		pterm.EnableDebugMessages()
+
+		name, err := cmd.Flags().GetString("name")
+		utils.HandleError(err)
+		if len(args) > 0 {
+			name = args[0]
+		}
+		if name == "" {
+			pterm.Error.Println("You must provide a dataset name")
+			os.Exit(1)
+		}
+		bucket, err := cmd.Flags().GetDuration("bucket")
+		utils.HandleError(err)
+		if bucket <= 0 {
+			pterm.Error.Println("The bucket size must be larger than 0")
+			os.Exit(1)
+		}
+		top, err := cmd.Flags().GetInt("top")
+		utils.HandleError(err)
+		if top < 0 {
+			pterm.Error.Println("The number of top entities can not be negative")
+			os.Exit(1)
+		}
+		buckets, err := cmd.Flags().GetInt("buckets")
+		utils.HandleError(err)
+
+		pterm.DefaultSection.Println("Reading the change log of " + name + " from " + server)
+		a := newActivity(bucket)
+		_, err = readChangeLog(server, token, name, func(entities []*api.Entity) error {
+			a.add(entities)
+			return nil
+		})
+		utils.HandleError(err)
+
+		report, err := a.report(name, top)
+		utils.HandleError(err)
+		if format == "term" {
+			renderActivity(report, buckets)
+			return
+		}
+		out, err := json.Marshal(report)
+		utils.HandleError(err)
+		if format == "pretty" {
+			out = pretty.Color(pretty.Pretty(out), nil)
+		}
+		fmt.Println(string(out))
+	},
+	TraverseChildren: true,
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) != 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return api.GetDatasetsCompletion(toComplete), cobra.ShellCompDirectiveNoFileComp
+	},
+}
+
+func init() {
+	ActivityCmd.Flags().StringP("name", "n", "", "The dataset to analyse")
+	ActivityCmd.Flags().Duration("bucket", time.Hour, "The size of each time bucket, like 15m, 1h or 24h")
+	ActivityCmd.Flags().Int("top", 10, "The number of most rewritten entities to show")
+	ActivityCmd.Flags().Int("buckets", 24, "The number of most recent buckets to show in the chart")
+}
+
+type activityCounts struct {
+	Changes int `json:"changes"`
+	New     int `json:"new"`
+	Updated int `json:"updated"`
+	Deleted int `json:"deleted"`
+}
+
+type activityBucket struct {
+	Start time.Time `json:"start"`
+	activityCounts
+}
+
+type entityActivity struct {
+	ID      string `json:"id"`
+	Changes int    `json:"changes"`
+}
+
+type activityReport struct {
+	Dataset  string           `json:"dataset"`
+	Bucket   string           `json:"bucket"`
+	Entities int              `json:"entities"`
+	Totals   activityCounts   `json:"totals"`
+	Buckets  []activityBucket `json:"buckets"`
+	Top      []entityActivity `json:"top"`
+}
+
+// activity counts the changes in a change log per time bucket and per entity
+type activity struct {
+	bucket   time.Duration
+	totals   activityCounts
+	buckets  map[int64]*activityCounts
+	entities map[string]*entityActivity
+}
+
+func newActivity(bucket time.Duration) *activity {
+	return &activity{
+		bucket:   bucket,
+		buckets:  make(map[int64]*activityCounts),
+		entities: make(map[string]*entityActivity),
+	}
+}
+
+func (a *activity) add(entities []*api.Entity) {
+	for _, e := range entities {
+		key := int64(e.Recorded) / int64(a.bucket) * int64(a.bucket)
+		b, ok := a.buckets[key]
+		if !ok {
+			b = &activityCounts{}
+			a.buckets[key] = b
+		}
+
+		ea, seen := a.entities[e.ID]
+		if !seen {
+			ea = &entityActivity{ID: e.ID}
+			a.entities[e.ID] = ea
+		}
+		ea.Changes++
+
+		counts := []*activityCounts{&a.totals, b}
+		for _, c := range counts {
+			c.Changes++
+			switch {
+			case !seen:
+				c.New++
+			case e.IsDeleted:
+				c.Deleted++
+			default:
+				c.Updated++
+			}
+		}
+	}
+}
+
+// maxActivityBuckets limits how many buckets a report can have once the empty buckets are filled in
+const maxActivityBuckets = 100000
+
+// report returns the buckets in time order, with empty buckets filled in, and the top most changed entities
+func (a *activity) report(dataset string, top int) (activityReport, error) {
+	r := activityReport{
+		Dataset:  dataset,
+		Bucket:   a.bucket.String(),
+		Entities: len(a.entities),
+		Totals:   a.totals,
+		Buckets:  make([]activityBucket, 0),
+		Top:      make([]entityActivity, 0),
+	}
+
+	keys := make([]int64, 0, len(a.buckets))
+	for k := range a.buckets {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	if len(keys) > 0 {
+		step := int64(a.bucket)
+		if n := (keys[len(keys)-1]-keys[0])/step + 1; n > maxActivityBuckets {
+			return r, fmt.Errorf("the changes span %d buckets of %s, which is more than %d, use a larger bucket size",
+				n, a.bucket, maxActivityBuckets)
+		}
+		for k := keys[0]; k <= keys[len(keys)-1]; k += step {
+			b := activityBucket{Start: time.Unix(0, k).UTC()}
+			if c, ok := a.buckets[k]; ok {
+				b.activityCounts = *c
+			}
+			r.Buckets = append(r.Buckets, b)
+		}
+	}
+
+	all := make([]entityActivity, 0, len(a.entities))
+	for _, ea := range a.entities {
+		if ea.Changes > 1 {
+			all = append(all, *ea)
+		}
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Changes != all[j].Changes {
+			return all[i].Changes > all[j].Changes
+		}
+		return all[i].ID < all[j].ID
+	})
+	if top >= 0 && len(all) > top {
+		all = all[:top]
+	}
+	r.Top = append(r.Top, all...)
+	return r, nil
+}
+
+func renderActivity(r activityReport, buckets int) {
+	pct := func(v int) string {
+		if r.Totals.Changes == 0 {
+			return "0.0%"
+		}
+		return fmt.Sprintf("%.1f%%", 100*float64(v)/float64(r.Totals.Changes))
+	}
+	out := [][]string{
+		{"", "Count", "Pct of changes"},
+		{"Changes", fmt.Sprintf("%d", r.Totals.Changes), pct(r.Totals.Changes)},
+		{"New", fmt.Sprintf("%d", r.Totals.New), pct(r.Totals.New)},
+		{"Updated", fmt.Sprintf("%d", r.Totals.Updated), pct(r.Totals.Updated)},
+		{"Deleted", fmt.Sprintf("%d", r.Totals.Deleted), pct(r.Totals.Deleted)},
+	}
+	pterm.DefaultSection.Printf("Activity for %s (%d entities)", r.Dataset, r.Entities)
+	pterm.DefaultTable.WithHasHeader().WithData(out).Render()
+
+	shown := r.Buckets
+	if buckets > 0 && len(shown) > buckets {
+		shown = shown[len(shown)-buckets:]
+	}
+	if len(shown) > 0 {
+		var bars pterm.Bars
+		for _, b := range shown {
+			bars = append(bars, pterm.Bar{
+				Label: b.Start.Format("2006-01-02 15:04"),
+				Value: b.Changes,
+				Style: pterm.NewStyle(pterm.FgLightGreen),
+			})
+		}
+		pterm.DefaultSection.Printf("Changes per %s (last %d of %d buckets)", r.Bucket, len(shown), len(r.Buckets))
+		_ = pterm.DefaultBarChart.WithHorizontal().WithBars(bars).WithShowValue().WithWidth(50).
+			WithHorizontalBarCharacter("┉").Render()
+	}
+
+	if len(r.Top) > 0 {
+		top := [][]string{{"Entity", "Changes"}}
+		for _, ea := range r.Top {
+			top = append(top, []string{ea.ID, fmt.Sprintf("%d", ea.Changes)})
+		}
+		pterm.DefaultSection.Println("Most rewritten entities")
+		pterm.DefaultTable.WithHasHeader().WithData(top).Render()
+	}
+	pterm.Println()
+}
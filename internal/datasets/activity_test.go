@@ -0,0 +1,68 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datasets
+
+import (
+	"testing"
+	"time"
+
+	"github.com/franela/goblin"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+)
+
+func TestActivity(t *testing.T) {
+	g := goblin.Goblin(t)
+	g.Describe("change log activity", func() {
+		hour := uint64(time.Hour)
+		change := func(id string, recorded uint64, deleted bool, name string) *api.Entity {
+			e := api.NewEntity(id)
+			e.Recorded = recorded
+			e.IsDeleted = deleted
+			e.Properties["name"] = name
+			return e
+		}
+
+		a := newActivity(time.Hour)
+		a.add([]*api.Entity{
+			change("a", 10*hour, false, "a1"),
+			change("b", 10*hour+1, false, "b1"),
+			change("a", 10*hour+2, false, "a1"),
+			change("a", 12*hour, false, "a2"),
+			change("b", 12*hour+5, true, "b1"),
+		})
+		r, reportErr := a.report("people", 1)
+
+		g.It("should classify the changes", func() {
+			g.Assert(reportErr).IsNil()
+			g.Assert(r.Totals).Equal(activityCounts{Changes: 5, New: 2, Updated: 2, Deleted: 1})
+			g.Assert(r.Entities).Equal(2)
+		})
+		g.It("should fill in empty buckets", func() {
+			g.Assert(len(r.Buckets)).Equal(3)
+			g.Assert(r.Buckets[0].Changes).Equal(3)
+			g.Assert(r.Buckets[1].Changes).Equal(0)
+			g.Assert(r.Buckets[2].Start).Equal(time.Unix(0, int64(12*hour)).UTC())
+		})
+		g.It("should list the most rewritten entities", func() {
+			g.Assert(r.Top).Equal([]entityActivity{{ID: "a", Changes: 3}})
+		})
+		g.It("should refuse to fill in too many buckets", func() {
+			tiny := newActivity(time.Nanosecond)
+			tiny.add([]*api.Entity{change("a", 0, false, "a1"), change("a", 12*hour, false, "a2")})
+			_, err := tiny.report("people", 1)
+			g.Assert(err == nil).IsFalse()
+		})
+	})
+}
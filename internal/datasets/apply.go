@@ -0,0 +1,435 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datasets
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/mimiro-io/datahub-cli/internal/login"
+	"github.com/mimiro-io/datahub-cli/internal/transform"
+	"github.com/mimiro-io/datahub-cli/internal/utils"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// ApplyCmd creates or updates datasets from a declaration file
+var ApplyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Create or update datasets from a declaration file",
+	Long: `Create or update datasets from a yaml declaration file. For example:
+mim dataset apply -f datasets.yaml
+or
+mim dataset apply -f datasets.yaml --dry-run
+
+The file lists the datasets with their configuration. Transforms are given as paths to
+.js or .ts files, relative to the declaration file, and are compiled like in transform import:
+
+datasets:
+  - name: people.Person
+    publicNamespaces:
+      - http://data.example.io/people/
+  - name: remote.Person
+    proxy:
+      remoteUrl: https://other-hub.example.io/datasets/people.Person
+      authProviderName: other-hub
+      upstreamTransform: transforms/upstream.ts
+      downstreamTransform: transforms/downstream.ts
+  - name: people.Adults
+    virtual:
+      transform: transforms/adults.ts
+
+A dataset that has a proxy or virtual config keeps it, so dropping it from the file is refused, and
+the dataset must be deleted and created again instead.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		server, token, err := login.ResolveCredentials()
+		utils.HandleError(err)
+
+		pterm.EnableDebugMessages()
+
+		file, err := cmd.Flags().GetString("file")
+		utils.HandleError(err)
+		if file == "" && len(args) > 0 {
+			file = args[0]
+		}
+		if file == "" {
+			pterm.Warning.Println("You must provide a declaration file")
+			pterm.Println()
+			os.Exit(1)
+		}
+
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		utils.HandleError(err)
+		confirm, err := cmd.Flags().GetBool("confirm")
+		utils.HandleError(err)
+
+		declarations, err := readDeclarations(file)
+		utils.HandleError(err)
+
+		pterm.DefaultSection.Println("Planning datasets on " + server)
+
+		dm := api.NewDatasetManager(server, token)
+		plan, err := planDatasets(dm, declarations)
+		utils.HandleError(err)
+
+		renderPlan(plan)
+
+		pending := plan.pending()
+		if len(pending) == 0 {
+			pterm.Success.Println("Datasets are up to date")
+			pterm.Println()
+			return
+		}
+		if dryRun {
+			pterm.Println()
+			return
+		}
+
+		if confirm {
+			pterm.DefaultSection.Printf("Apply %d change(s) on %s, please type (y)es or (n)o and then press enter:", len(pending), server)
+			if !utils.AskForConfirmation() {
+				pterm.Println("Aborted!")
+				os.Exit(0)
+			}
+		}
+
+		failed := false
+		for _, step := range pending {
+			err := updateDataset(server, token, step.name, step.config)
+			if err != nil {
+				pterm.Error.Printf("Failed to %s dataset '%s': %s\n", step.action, step.name, err.Error())
+				failed = true
+				continue
+			}
+			pterm.Success.Printf("Dataset '%s' has been %sd\n", step.name, step.action)
+		}
+		pterm.Println()
+		if failed {
+			os.Exit(1)
+		}
+	},
+	TraverseChildren: true,
+}
+
+func init() {
+	ApplyCmd.Flags().StringP("file", "f", "", "The yaml file declaring the datasets")
+	ApplyCmd.Flags().Bool("dry-run", false, "Only show the plan, do not change anything")
+	ApplyCmd.Flags().BoolP("confirm", "C", true, "Default flag to ask for confirmation before applying")
+}
+
+type datasetDeclarations struct {
+	Datasets []datasetDeclaration `yaml:"datasets"`
+}
+
+type datasetDeclaration struct {
+	Name             string              `yaml:"name"`
+	PublicNamespaces []string            `yaml:"publicNamespaces"`
+	Proxy            *proxyDeclaration   `yaml:"proxy"`
+	Virtual          *virtualDeclaration `yaml:"virtual"`
+}
+
+type proxyDeclaration struct {
+	RemoteUrl           string `yaml:"remoteUrl"`
+	AuthProviderName    string `yaml:"authProviderName"`
+	UpstreamTransform   string `yaml:"upstreamTransform"`
+	DownstreamTransform string `yaml:"downstreamTransform"`
+}
+
+type virtualDeclaration struct {
+	Transform string `yaml:"transform"`
+}
+
+const (
+	actionCreate    = "create"
+	actionUpdate    = "update"
+	actionUnchanged = "unchanged"
+)
+
+type planStep struct {
+	action  string
+	name    string
+	changes []string
+	config  *CreateDatasetConfig
+}
+
+type datasetPlan []planStep
+
+func (p datasetPlan) pending() []planStep {
+	steps := make([]planStep, 0)
+	for _, step := range p {
+		if step.action != actionUnchanged {
+			steps = append(steps, step)
+		}
+	}
+	return steps
+}
+
+func readDeclarations(file string) ([]datasetDeclaration, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	decl := &datasetDeclarations{}
+	if err := yaml.Unmarshal(content, decl); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", file, err)
+	}
+	if len(decl.Datasets) == 0 {
+		return nil, fmt.Errorf("no datasets declared in %s", file)
+	}
+
+	// transforms are given relative to the declaration file
+	base := filepath.Dir(file)
+	seen := make(map[string]bool)
+	for i, d := range decl.Datasets {
+		if d.Name == "" {
+			return nil, fmt.Errorf("dataset number %d in %s is missing a name", i+1, file)
+		}
+		if seen[d.Name] {
+			return nil, fmt.Errorf("dataset '%s' is declared more than once", d.Name)
+		}
+		seen[d.Name] = true
+		if d.Proxy != nil {
+			if d.Proxy.RemoteUrl == "" {
+				return nil, fmt.Errorf("dataset '%s' is a proxy dataset, but has no remoteUrl", d.Name)
+			}
+			d.Proxy.UpstreamTransform = relativeTo(base, d.Proxy.UpstreamTransform)
+			d.Proxy.DownstreamTransform = relativeTo(base, d.Proxy.DownstreamTransform)
+		}
+		if d.Virtual != nil {
+			if d.Virtual.Transform == "" {
+				return nil, fmt.Errorf("dataset '%s' is a virtual dataset, but has no transform", d.Name)
+			}
+			d.Virtual.Transform = relativeTo(base, d.Virtual.Transform)
+		}
+	}
+
+	return decl.Datasets, nil
+}
+
+func relativeTo(base string, file string) string {
+	if file == "" || filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(base, file)
+}
+
+// toConfig compiles the transforms of a declaration, and returns the config as it is posted to the datahub
+func (d datasetDeclaration) toConfig() (*CreateDatasetConfig, error) {
+	conf := &CreateDatasetConfig{
+		PublicNamespaces: d.PublicNamespaces,
+	}
+	var err error
+	if d.Proxy != nil {
+		conf.ProxyDatasetConfig = &ProxyDatasetConfig{
+			RemoteUrl:        d.Proxy.RemoteUrl,
+			AuthProviderName: d.Proxy.AuthProviderName,
+		}
+		conf.ProxyDatasetConfig.UpstreamTransform, err = compileTransform(d.Proxy.UpstreamTransform)
+		if err != nil {
+			return nil, err
+		}
+		conf.ProxyDatasetConfig.DownstreamTransform, err = compileTransform(d.Proxy.DownstreamTransform)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if d.Virtual != nil {
+		conf.VirtualDatasetConfig = &VirtualDatasetConfig{}
+		conf.VirtualDatasetConfig.Transform, err = compileTransform(d.Virtual.Transform)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return conf, nil
+}
+
+// compileTransform compiles a transform file and returns it base64 encoded
+func compileTransform(file string) (string, error) {
+	if file == "" {
+		return "", nil
+	}
+	importer := transform.NewImporter(file)
+	code, err := importer.Compile()
+	if err != nil {
+		return "", fmt.Errorf("could not compile transform %s: %w", file, err)
+	}
+	return importer.Encode(code), nil
+}
+
+func planDatasets(dm *api.DatasetManager, declarations []datasetDeclaration) (datasetPlan, error) {
+	existing, err := dm.List()
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool)
+	for _, ds := range existing {
+		names[ds.Name] = true
+	}
+
+	current := make(map[string]*CreateDatasetConfig)
+	for _, d := range declarations {
+		if !names[d.Name] {
+			continue
+		}
+		e, err := dm.Get(d.Name)
+		if err != nil {
+			return nil, err
+		}
+		current[d.Name] = currentConfig(e)
+	}
+	return planSteps(declarations, current)
+}
+
+// planSteps compares the declarations with the config of the datasets that exist, and creates the rest.
+// A declaration that drops the proxy or virtual config of an existing dataset is refused.
+func planSteps(declarations []datasetDeclaration, current map[string]*CreateDatasetConfig) (datasetPlan, error) {
+	plan := make(datasetPlan, 0)
+	for _, d := range declarations {
+		wanted, err := d.toConfig()
+		if err != nil {
+			return nil, err
+		}
+		conf, ok := current[d.Name]
+		if !ok {
+			plan = append(plan, planStep{action: actionCreate, name: d.Name, config: wanted})
+			continue
+		}
+
+		changes := diffConfig(conf, wanted)
+		for _, c := range changes {
+			// updating a dataset only sets the configs that are given, so it can not clear one
+			switch c {
+			case "proxy removed":
+				return nil, fmt.Errorf("dataset %s: removing a proxy config requires recreating the dataset", d.Name)
+			case "virtual removed":
+				return nil, fmt.Errorf("dataset %s: removing a virtual config requires recreating the dataset", d.Name)
+			}
+		}
+		action := actionUpdate
+		if len(changes) == 0 {
+			action = actionUnchanged
+		}
+		plan = append(plan, planStep{action: action, name: d.Name, changes: changes, config: wanted})
+	}
+	return plan, nil
+}
+
+// currentConfig reads the config of an existing dataset back from its core.Dataset entity
+func currentConfig(e *api.Entity) *CreateDatasetConfig {
+	conf := &CreateDatasetConfig{}
+	for k, v := range e.Properties {
+		switch getVal(k) {
+		case "publicNamespaces":
+			if list, ok := v.([]interface{}); ok {
+				for _, ns := range list {
+					conf.PublicNamespaces = append(conf.PublicNamespaces, fmt.Sprintf("%v", ns))
+				}
+			}
+		case "proxyConfig", "proxyDatasetConfig":
+			conf.ProxyDatasetConfig = &ProxyDatasetConfig{}
+			if !remarshal(v, conf.ProxyDatasetConfig) {
+				conf.ProxyDatasetConfig = nil
+			}
+		case "virtualConfig", "virtualDatasetConfig":
+			conf.VirtualDatasetConfig = &VirtualDatasetConfig{}
+			if !remarshal(v, conf.VirtualDatasetConfig) {
+				conf.VirtualDatasetConfig = nil
+			}
+		}
+	}
+	return conf
+}
+
+func remarshal(from interface{}, to interface{}) bool {
+	b, err := json.Marshal(from)
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(b, to) == nil
+}
+
+// diffConfig lists the fields that differ between the current and the wanted config
+func diffConfig(current *CreateDatasetConfig, wanted *CreateDatasetConfig) []string {
+	changes := make([]string, 0)
+	if !sameStrings(current.PublicNamespaces, wanted.PublicNamespaces) {
+		changes = append(changes, "publicNamespaces")
+	}
+
+	cp, wp := current.ProxyDatasetConfig, wanted.ProxyDatasetConfig
+	switch {
+	case cp == nil && wp != nil:
+		changes = append(changes, "proxy added")
+	case cp != nil && wp == nil:
+		changes = append(changes, "proxy removed")
+	case cp != nil && wp != nil:
+		if cp.RemoteUrl != wp.RemoteUrl {
+			changes = append(changes, "proxy.remoteUrl")
+		}
+		if cp.AuthProviderName != wp.AuthProviderName {
+			changes = append(changes, "proxy.authProviderName")
+		}
+		if cp.UpstreamTransform != wp.UpstreamTransform {
+			changes = append(changes, "proxy.upstreamTransform")
+		}
+		if cp.DownstreamTransform != wp.DownstreamTransform {
+			changes = append(changes, "proxy.downstreamTransform")
+		}
+	}
+
+	cv, wv := current.VirtualDatasetConfig, wanted.VirtualDatasetConfig
+	switch {
+	case cv == nil && wv != nil:
+		changes = append(changes, "virtual added")
+	case cv != nil && wv == nil:
+		changes = append(changes, "virtual removed")
+	case cv != nil && wv != nil && cv.Transform != wv.Transform:
+		changes = append(changes, "virtual.transform")
+	}
+	return changes
+}
+
+func sameStrings(a []string, b []string) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func renderPlan(plan datasetPlan) {
+	out := make([][]string, 0)
+	out = append(out, []string{"Action", "Dataset", "Changes"})
+	for _, step := range plan {
+		action := step.action
+		switch step.action {
+		case actionCreate:
+			action = pterm.Green(action)
+		case actionUpdate:
+			action = pterm.Yellow(action)
+		default:
+			action = pterm.Gray(action)
+		}
+		out = append(out, []string{action, step.name, strings.Join(step.changes, ", ")})
+	}
+	pterm.DefaultTable.WithHasHeader().WithData(out).Render()
+	pterm.Println()
+}
@@ -0,0 +1,131 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datasets
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/franela/goblin"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+)
+
+func TestApplyDatasets(t *testing.T) {
+	g := goblin.Goblin(t)
+	g.Describe("dataset declarations", func() {
+		write := func(content string) string {
+			file := filepath.Join(t.TempDir(), "datasets.yaml")
+			g.Assert(os.WriteFile(file, []byte(content), 0644)).IsNil()
+			return file
+		}
+
+		g.It("should read datasets with transforms relative to the file", func() {
+			file := write(`
+datasets:
+  - name: people.Person
+    publicNamespaces: [http://data.example.io/people/]
+  - name: remote.Person
+    proxy:
+      remoteUrl: http://remote.example.io/datasets/people
+      upstreamTransform: transforms/up.ts
+  - name: virtual.Person
+    virtual:
+      transform: /abs/virtual.ts
+`)
+			decls, err := readDeclarations(file)
+			g.Assert(err).IsNil()
+			g.Assert(len(decls)).Equal(3)
+			g.Assert(decls[0].PublicNamespaces).Equal([]string{"http://data.example.io/people/"})
+			g.Assert(decls[1].Proxy.UpstreamTransform).Equal(filepath.Join(filepath.Dir(file), "transforms", "up.ts"))
+			g.Assert(decls[1].Proxy.DownstreamTransform).Equal("")
+			g.Assert(decls[2].Virtual.Transform).Equal("/abs/virtual.ts")
+		})
+		g.It("should refuse invalid declarations", func() {
+			for _, content := range []string{
+				"datasets: []",
+				"datasets:\n  - publicNamespaces: [a]",
+				"datasets:\n  - name: a\n  - name: a",
+				"datasets:\n  - name: a\n    proxy: {authProviderName: x}",
+				"datasets:\n  - name: a\n    virtual: {}",
+				"datasets: [",
+			} {
+				_, err := readDeclarations(write(content))
+				g.Assert(err == nil).IsFalse()
+			}
+		})
+	})
+
+	g.Describe("dataset plan", func() {
+		remote := &ProxyDatasetConfig{RemoteUrl: "http://remote.example.io/datasets/people"}
+
+		g.It("should create, update and leave datasets unchanged", func() {
+			decls := []datasetDeclaration{
+				{Name: "new"},
+				{Name: "changed", PublicNamespaces: []string{"http://a/"}},
+				{Name: "same", Proxy: &proxyDeclaration{RemoteUrl: remote.RemoteUrl}},
+			}
+			plan, err := planSteps(decls, map[string]*CreateDatasetConfig{
+				"changed": {},
+				"same":    {ProxyDatasetConfig: remote},
+				"other":   {},
+			})
+			g.Assert(err).IsNil()
+			g.Assert(len(plan)).Equal(3)
+			g.Assert(plan[0].action).Equal(actionCreate)
+			g.Assert(plan[1].action).Equal(actionUpdate)
+			g.Assert(plan[1].changes).Equal([]string{"publicNamespaces"})
+			g.Assert(plan[2].action).Equal(actionUnchanged)
+			g.Assert(len(plan.pending())).Equal(2)
+		})
+		g.It("should refuse to remove a proxy or virtual config", func() {
+			_, err := planSteps([]datasetDeclaration{{Name: "remote"}}, map[string]*CreateDatasetConfig{
+				"remote": {ProxyDatasetConfig: remote},
+			})
+			g.Assert(err.Error()).Equal("dataset remote: removing a proxy config requires recreating the dataset")
+			_, err = planSteps([]datasetDeclaration{{Name: "virtual"}}, map[string]*CreateDatasetConfig{
+				"virtual": {VirtualDatasetConfig: &VirtualDatasetConfig{Transform: "dA=="}},
+			})
+			g.Assert(err.Error()).Equal("dataset virtual: removing a virtual config requires recreating the dataset")
+		})
+		g.It("should read the current config from the dataset entity", func() {
+			e := api.NewEntity("ns0:people")
+			e.Properties["ns0:publicNamespaces"] = []interface{}{"http://a/"}
+			e.Properties["ns0:proxyDatasetConfig"] = map[string]interface{}{"remoteUrl": remote.RemoteUrl}
+			conf := currentConfig(e)
+			g.Assert(conf.PublicNamespaces).Equal([]string{"http://a/"})
+			g.Assert(conf.ProxyDatasetConfig.RemoteUrl).Equal(remote.RemoteUrl)
+			g.Assert(conf.VirtualDatasetConfig == nil).IsTrue()
+		})
+	})
+
+	g.Describe("dataset config diff", func() {
+		g.It("should find no changes in equal configs", func() {
+			g.Assert(diffConfig(&CreateDatasetConfig{}, &CreateDatasetConfig{PublicNamespaces: []string{}})).Equal([]string{})
+		})
+		g.It("should list changed proxy fields", func() {
+			current := &CreateDatasetConfig{ProxyDatasetConfig: &ProxyDatasetConfig{RemoteUrl: "http://a", AuthProviderName: "x"}}
+			wanted := &CreateDatasetConfig{ProxyDatasetConfig: &ProxyDatasetConfig{RemoteUrl: "http://b", AuthProviderName: "x", UpstreamTransform: "dXA="}}
+			g.Assert(diffConfig(current, wanted)).Equal([]string{"proxy.remoteUrl", "proxy.upstreamTransform"})
+		})
+		g.It("should list added and removed proxy and virtual configs", func() {
+			proxy := &CreateDatasetConfig{ProxyDatasetConfig: &ProxyDatasetConfig{RemoteUrl: "http://a"}}
+			virtual := &CreateDatasetConfig{VirtualDatasetConfig: &VirtualDatasetConfig{Transform: "dA=="}}
+			g.Assert(diffConfig(proxy, virtual)).Equal([]string{"proxy removed", "virtual added"})
+			g.Assert(diffConfig(virtual, proxy)).Equal([]string{"proxy added", "virtual removed"})
+			g.Assert(diffConfig(virtual, &CreateDatasetConfig{VirtualDatasetConfig: &VirtualDatasetConfig{Transform: "dQ=="}})).Equal([]string{"virtual.transform"})
+		})
+	})
+}
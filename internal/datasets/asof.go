@@ -0,0 +1,173 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datasets
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mimiro-io/datahub-cli/internal/login"
+	"github.com/mimiro-io/datahub-cli/internal/utils"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// AsOfCmd rebuilds a dataset as it looked at a point in time from its change log
+var AsOfCmd = &cobra.Command{
+	Use:   "as-of",
+	Short: "Rebuild a dataset as it was at a given time",
+	Long: `Replay the change log of a dataset, and rebuild the dataset as it was at a given time. For each
+entity, the last version recorded at or before the time is kept. Entities that were deleted at
+that time are left out. For example:
+mim dataset as-of people.Person --at 2026-09-01T00:00:00Z > people.json
+or
+mim dataset as-of people.Person --at 2026-09-01 --output people.json
+or
+mim dataset as-of people.Person --at 2026-09-01T12:00:00+02:00 --to people.Person.restored
+
+The snapshot is written to stdout, to a file, or stored into a new dataset.
+`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		server, token, err := login.ResolveCredentials()
+		utils.HandleError(err)
+
+		pterm.EnableDebugMessages()
+
+		name, err := cmd.Flags().GetString("name")
+		utils.HandleError(err)
+		if len(args) > 0 {
+			name = args[0]
+		}
+		atFlag, err := cmd.Flags().GetString("at")
+		utils.HandleError(err)
+		output, err := cmd.Flags().GetString("output")
+		utils.HandleError(err)
+		to, err := cmd.Flags().GetString("to")
+		utils.HandleError(err)
+
+		if name == "" || atFlag == "" {
+			pterm.Error.Println("You must provide a dataset name and a time with --at")
+			os.Exit(1)
+		}
+		if output != "" && to != "" {
+			pterm.Error.Println("Use either --output or --to, not both")
+			os.Exit(1)
+		}
+		at, err := parseTime(atFlag)
+		utils.HandleError(err)
+
+		if to != "" {
+			utils.HandleError(ensureNewDataset(server, token, to))
+		}
+
+		toStdout := output == "" && to == ""
+		if toStdout {
+			pterm.DisableOutput()
+		}
+
+		pterm.DefaultSection.Printf("Rebuilding %s as of %s", name, at.Format(time.RFC3339))
+		snapshot := newAsOfSnapshot(at)
+		ctx, err := readChangeLog(server, token, name, func(entities []*api.Entity) error {
+			snapshot.add(entities)
+			return nil
+		})
+		utils.HandleError(err)
+
+		entities := snapshot.entities()
+		switch {
+		case to != "":
+			err = storeSnapshot(server, token, to, ctx, entities)
+			utils.HandleError(err)
+			pterm.Success.Printf("Stored %d entities in %s\n", len(entities), to)
+		case output != "":
+			err = writeSnapshotFile(output, ctx, entities)
+			utils.HandleError(err)
+			pterm.Success.Printf("Wrote %d entities to %s\n", len(entities), output)
+		default:
+			err = writeSnapshot(os.Stdout, ctx, entities)
+			utils.HandleError(err)
+		}
+		pterm.Println()
+	},
+	TraverseChildren: true,
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) != 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return api.GetDatasetsCompletion(toComplete), cobra.ShellCompDirectiveNoFileComp
+	},
+}
+
+func init() {
+	AsOfCmd.Flags().StringP("name", "n", "", "The dataset to rebuild")
+	AsOfCmd.Flags().String("at", "", "The time to rebuild the dataset at, as RFC3339 or a date like 2026-09-01")
+	AsOfCmd.Flags().StringP("output", "o", "", "Write the snapshot to this file")
+	AsOfCmd.Flags().String("to", "", "Store the snapshot in this new dataset")
+}
+
+// parseTime parses an RFC3339 time, or a date which is taken as midnight UTC
+func parseTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time '%s', use RFC3339 like 2026-09-01T00:00:00Z or a date like 2026-09-01", value)
+}
+
+// asOfSnapshot keeps the last version of each entity recorded at or before a point in time
+type asOfSnapshot struct {
+	at     uint64
+	latest map[string]*api.Entity
+	order  []string
+}
+
+func newAsOfSnapshot(at time.Time) *asOfSnapshot {
+	return &asOfSnapshot{
+		at:     uint64(at.UnixNano()),
+		latest: make(map[string]*api.Entity),
+		order:  make([]string, 0),
+	}
+}
+
+func (s *asOfSnapshot) add(entities []*api.Entity) {
+	for _, e := range entities {
+		if e.Recorded > s.at {
+			continue
+		}
+		if prev, ok := s.latest[e.ID]; ok && prev.Recorded > e.Recorded {
+			continue
+		}
+		if _, ok := s.latest[e.ID]; !ok {
+			s.order = append(s.order, e.ID)
+		}
+		s.latest[e.ID] = e
+	}
+}
+
+// entities returns the entities that existed at the time, in the order they first appeared
+func (s *asOfSnapshot) entities() []*api.Entity {
+	out := make([]*api.Entity, 0, len(s.order))
+	for _, id := range s.order {
+		if e := s.latest[id]; !e.IsDeleted {
+			out = append(out, e)
+		}
+	}
+	return out
+}
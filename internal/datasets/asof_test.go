@@ -0,0 +1,63 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datasets
+
+import (
+	"testing"
+	"time"
+
+	"github.com/franela/goblin"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+)
+
+func TestAsOfSnapshot(t *testing.T) {
+	g := goblin.Goblin(t)
+	g.Describe("point in time snapshots", func() {
+		at := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+		ns := uint64(at.UnixNano())
+		version := func(id string, recorded uint64, deleted bool, name string) *api.Entity {
+			e := api.NewEntity(id)
+			e.Recorded = recorded
+			e.IsDeleted = deleted
+			e.Properties["name"] = name
+			return e
+		}
+
+		g.It("should keep the last version at or before the time", func() {
+			s := newAsOfSnapshot(at)
+			s.add([]*api.Entity{version("a", ns-10, false, "a1"), version("b", ns-5, false, "b1")})
+			s.add([]*api.Entity{version("a", ns, false, "a2"), version("a", ns+1, false, "a3")})
+			es := s.entities()
+			g.Assert(len(es)).Equal(2)
+			g.Assert(es[0].Properties["name"]).Equal("a2")
+			g.Assert(es[1].Properties["name"]).Equal("b1")
+		})
+		g.It("should leave out entities deleted at the time", func() {
+			s := newAsOfSnapshot(at)
+			s.add([]*api.Entity{version("a", ns-10, false, "a1"), version("a", ns-5, true, "a1")})
+			s.add([]*api.Entity{version("b", ns-10, false, "b1"), version("b", ns-5, true, "b1"), version("b", ns+5, false, "b2")})
+			g.Assert(len(s.entities())).Equal(0)
+		})
+		g.It("should parse dates and RFC3339 times", func() {
+			t1, err := parseTime("2026-09-01")
+			g.Assert(err).IsNil()
+			t2, err := parseTime("2026-09-01T02:00:00+02:00")
+			g.Assert(err).IsNil()
+			g.Assert(t1.Equal(t2)).IsTrue()
+			_, err = parseTime("yesterday")
+			g.Assert(err == nil).IsFalse()
+		})
+	})
+}
@@ -0,0 +1,263 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datasets
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/mimiro-io/datahub-cli/internal/login"
+	"github.com/mimiro-io/datahub-cli/internal/utils"
+	"github.com/mimiro-io/datahub-cli/internal/web"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"github.com/tidwall/pretty"
+)
+
+// catalogContentID is the id of the content document that holds the metadata of all datasets
+const catalogContentID = "dataset-catalog"
+
+// DescribeCmd sets or shows the owner, description and tags of a dataset
+var DescribeCmd = &cobra.Command{
+	Use:   "describe",
+	Short: "Set the owner, description and tags of a dataset",
+	Long: `Set the owner, description and tags of a dataset. The metadata of all datasets is kept in the
+content document dataset-catalog, and is shown by dataset get and dataset list. For example:
+mim dataset describe people.Person --owner team-crm --description "People from the CRM" --tags crm,pii
+or, to show the metadata of a dataset:
+mim dataset describe people.Person
+
+Only the given fields are changed. Tags replace the existing tags, use --tags "" to remove them.
+The metadata follows a dataset that is renamed, and is removed when the dataset is deleted.
+Find datasets by tag with:
+mim dataset list --tag pii
+`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		format := utils.ResolveFormat(cmd)
+		if format != "term" {
+			pterm.DisableOutput()
+		}
+
+		server, token, err := login.ResolveCredentials()
+		utils.HandleError(err)
+
+		pterm.EnableDebugMessages()
+
+		name, err := cmd.Flags().GetString("name")
+		utils.HandleError(err)
+		if len(args) > 0 {
+			name = args[0]
+		}
+		if name == "" {
+			pterm.Error.Println("You must provide a dataset name")
+			os.Exit(1)
+		}
+
+		catalog, err := readCatalog(server, token)
+		utils.HandleError(err)
+		meta := catalog.Datasets[name]
+
+		changed := false
+		if cmd.Flags().Changed("owner") {
+			meta.Owner, err = cmd.Flags().GetString("owner")
+			utils.HandleError(err)
+			changed = true
+		}
+		if cmd.Flags().Changed("description") {
+			meta.Description, err = cmd.Flags().GetString("description")
+			utils.HandleError(err)
+			changed = true
+		}
+		if cmd.Flags().Changed("tags") {
+			tags, err := cmd.Flags().GetStringSlice("tags")
+			utils.HandleError(err)
+			meta.Tags = normaliseTags(tags)
+			changed = true
+		}
+
+		if changed {
+			_, err = api.NewDatasetManager(server, token).Get(name)
+			if err != nil {
+				pterm.Error.Printf("Could not find dataset %s: %s\n", name, err.Error())
+				os.Exit(1)
+			}
+			catalog.set(name, meta)
+			err = writeCatalog(server, token, catalog)
+			utils.HandleError(err)
+			pterm.Success.Println("Updated the metadata of " + name)
+		}
+
+		if format != "term" {
+			out, err := json.Marshal(meta)
+			utils.HandleError(err)
+			if format == "pretty" {
+				out = pretty.Color(pretty.Pretty(out), nil)
+			}
+			fmt.Println(string(out))
+			return
+		}
+		pterm.DefaultSection.Println("Dataset: " + name)
+		pterm.DefaultTable.WithHasHeader().WithData(append([][]string{{"Field", "Value"}}, meta.rows()...)).Render()
+		pterm.Println()
+	},
+	TraverseChildren: true,
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) != 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return api.GetDatasetsCompletion(toComplete), cobra.ShellCompDirectiveNoFileComp
+	},
+}
+
+func init() {
+	DescribeCmd.Flags().StringP("name", "n", "", "The dataset to describe")
+	DescribeCmd.Flags().String("owner", "", "The team or person owning the dataset")
+	DescribeCmd.Flags().String("description", "", "What the dataset is for")
+	DescribeCmd.Flags().StringSlice("tags", nil, "A comma separated list of tags")
+}
+
+// datasetMetadata is what the catalog knows about a dataset
+type datasetMetadata struct {
+	Owner       string   `json:"owner,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+}
+
+func (m datasetMetadata) empty() bool {
+	return m.Owner == "" && m.Description == "" && len(m.Tags) == 0
+}
+
+func (m datasetMetadata) hasTags(tags []string) bool {
+	for _, tag := range normaliseTags(tags) {
+		if !containsString(m.Tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m datasetMetadata) rows() [][]string {
+	return [][]string{
+		{"owner", m.Owner},
+		{"description", m.Description},
+		{"tags", strings.Join(m.Tags, ", ")},
+	}
+}
+
+type datasetCatalog struct {
+	Datasets map[string]datasetMetadata `json:"datasets"`
+}
+
+func (c *datasetCatalog) set(name string, meta datasetMetadata) {
+	if meta.empty() {
+		delete(c.Datasets, name)
+		return
+	}
+	c.Datasets[name] = meta
+}
+
+// move moves the metadata of renamed datasets to their new names, and drops the metadata of
+// datasets that are renamed to an empty name. All moves happen at once, so names can be swapped.
+// It returns true if the catalog was changed.
+func (c *datasetCatalog) move(names map[string]string) bool {
+	moved := make(map[string]datasetMetadata)
+	for from, to := range names {
+		if meta, ok := c.Datasets[from]; ok && from != to {
+			moved[from] = meta
+		}
+	}
+	for from := range moved {
+		delete(c.Datasets, from)
+	}
+	for from, meta := range moved {
+		if to := names[from]; to != "" {
+			c.Datasets[to] = meta
+		}
+	}
+	return len(moved) > 0
+}
+
+type catalogContent struct {
+	ID   string          `json:"id"`
+	Data *datasetCatalog `json:"data"`
+}
+
+// readCatalog reads the catalog content document, and returns an empty catalog if there is none yet
+func readCatalog(server string, token string) (*datasetCatalog, error) {
+	empty := &datasetCatalog{Datasets: make(map[string]datasetMetadata)}
+	body, err := web.GetRequest(server, token, "/content/"+catalogContentID)
+	if err != nil {
+		if web.IsNotFound(err) {
+			return empty, nil
+		}
+		return nil, fmt.Errorf("could not read the dataset catalog: %w", err)
+	}
+	c := catalogContent{}
+	if err := json.Unmarshal(body, &c); err != nil {
+		return nil, fmt.Errorf("could not read the dataset catalog: %w", err)
+	}
+	if c.Data == nil {
+		return empty, nil
+	}
+	if c.Data.Datasets == nil {
+		c.Data.Datasets = make(map[string]datasetMetadata)
+	}
+	return c.Data, nil
+}
+
+func writeCatalog(server string, token string, catalog *datasetCatalog) error {
+	body, err := json.Marshal(catalogContent{ID: catalogContentID, Data: catalog})
+	if err != nil {
+		return err
+	}
+	_, err = web.PostRequest(server, token, "/content", body)
+	if err != nil {
+		return fmt.Errorf("could not store the dataset catalog: %w", err)
+	}
+	return nil
+}
+
+// moveCatalogEntries updates the catalog after datasets are renamed or deleted, see datasetCatalog.move
+func moveCatalogEntries(server string, token string, names map[string]string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	catalog, err := readCatalog(server, token)
+	if err != nil {
+		return err
+	}
+	if !catalog.move(names) {
+		return nil
+	}
+	return writeCatalog(server, token, catalog)
+}
+
+// normaliseTags trims and lower cases the tags, and removes empty and repeated tags
+func normaliseTags(tags []string) []string {
+	out := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !containsString(out, tag) {
+			out = append(out, tag)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
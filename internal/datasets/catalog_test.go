@@ -0,0 +1,80 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datasets
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/franela/goblin"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+)
+
+func TestCatalog(t *testing.T) {
+	g := goblin.Goblin(t)
+	g.Describe("dataset catalog", func() {
+		catalog := &datasetCatalog{Datasets: map[string]datasetMetadata{
+			"people.Person": {Owner: "team-crm", Tags: []string{"crm", "pii"}},
+			"crm.Company":   {Owner: "team-crm", Tags: []string{"crm"}},
+		}}
+		sets := []api.Dataset{{Name: "people.Person"}, {Name: "crm.Company"}, {Name: "tmp.a"}}
+
+		g.It("should normalise tags", func() {
+			g.Assert(normaliseTags([]string{" PII", "crm", "", "pii"})).Equal([]string{"crm", "pii"})
+		})
+		g.It("should filter datasets by all given tags", func() {
+			g.Assert(len(filterByTags(sets, catalog, nil))).Equal(3)
+			g.Assert(len(filterByTags(sets, catalog, []string{"CRM"}))).Equal(2)
+			filtered := filterByTags(sets, catalog, []string{"crm", "pii"})
+			g.Assert(len(filtered)).Equal(1)
+			g.Assert(filtered[0].Name).Equal("people.Person")
+		})
+		g.It("should remove datasets without metadata from the catalog", func() {
+			c := &datasetCatalog{Datasets: map[string]datasetMetadata{"tmp.a": {Owner: "me"}}}
+			c.set("tmp.a", datasetMetadata{})
+			g.Assert(len(c.Datasets)).Equal(0)
+		})
+		g.It("should move metadata with renamed and deleted datasets", func() {
+			c := &datasetCatalog{Datasets: map[string]datasetMetadata{
+				"a": {Owner: "team-a"}, "b": {Owner: "team-b"}, "c": {Owner: "team-c"},
+			}}
+			g.Assert(c.move(map[string]string{"a": "b", "b": "a", "c": "", "x": "y"})).IsTrue()
+			g.Assert(c.Datasets).Equal(map[string]datasetMetadata{"a": {Owner: "team-b"}, "b": {Owner: "team-a"}})
+			g.Assert(c.move(map[string]string{"x": "y"})).IsFalse()
+		})
+		g.It("should list the metadata with the dataset in json", func() {
+			out, err := json.Marshal(listedDataset{Dataset: sets[1], datasetMetadata: catalog.Datasets["crm.Company"]})
+			g.Assert(err).IsNil()
+			g.Assert(string(out)).Equal(`{"name":"crm.Company","type":null,"items":0,"owner":"team-crm","tags":["crm"]}`)
+		})
+		g.It("should only start an empty catalog when there is none on the server", func() {
+			status := http.StatusNotFound
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(status)
+			}))
+			defer server.Close()
+
+			c, err := readCatalog(server.URL, "")
+			g.Assert(err).IsNil()
+			g.Assert(len(c.Datasets)).Equal(0)
+
+			status = http.StatusInternalServerError
+			_, err = readCatalog(server.URL, "")
+			g.Assert(err == nil).IsFalse()
+		})
+	})
+}
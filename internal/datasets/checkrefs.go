@@ -0,0 +1,288 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datasets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/mimiro-io/datahub-cli/internal/login"
+	"github.com/mimiro-io/datahub-cli/internal/utils"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"github.com/tidwall/pretty"
+)
+
+// CheckRefsCmd finds references in a dataset that point to entities missing from the target datasets
+var CheckRefsCmd = &cobra.Command{
+	Use:   "check-refs",
+	Short: "Find dangling references from a dataset into other datasets",
+	Long: `Read all entities of a dataset, and check that every entity it references exists, and is not
+deleted, in one of the target datasets. The target datasets are read first to build a local index of
+their entity ids. Dangling references are reported per reference, with examples. For example:
+mim dataset check-refs people.Person --targets places.Place,orgs.Organisation
+or
+mim dataset check-refs people.Person --targets places.Place --predicates ns3:livesIn --examples 10
+
+The command exits with status 1 if any dangling references are found.
+`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		format := utils.ResolveFormat(cmd)
+		if format != "term" {
+			pterm.DisableOutput()
+		}
+
+		server, token, err := login.ResolveCredentials()
+		utils.HandleError(err)
+
+		pterm.EnableDebugMessages()
+
+		name, err := cmd.Flags().GetString("name")
+		utils.HandleError(err)
+		if len(args) > 0 {
+			name = args[0]
+		}
+		targets, err := cmd.Flags().GetStringSlice("targets")
+		utils.HandleError(err)
+		predicates, err := cmd.Flags().GetStringSlice("predicates")
+		utils.HandleError(err)
+		examples, err := cmd.Flags().GetInt("examples")
+		utils.HandleError(err)
+
+		if name == "" || len(targets) == 0 {
+			pterm.Error.Println("You must provide a dataset name and one or more target datasets")
+			os.Exit(1)
+		}
+
+		em := api.NewEntityManager(server, token, context.Background(), api.Entities)
+		index := newRefIndex()
+		for _, target := range targets {
+			pterm.DefaultSection.Println("Indexing " + server + "/datasets/" + target)
+			err = em.ReadAll(target, "", &expandingSink{process: index.add, includeDeleted: true})
+			utils.HandleError(err)
+		}
+
+		pterm.DefaultSection.Println("Checking references in " + server + "/datasets/" + name)
+		checker := newRefChecker(index, examples)
+		sink := &expandingSink{}
+		sink.process = func(e *api.Entity) error {
+			if checker.predicates == nil {
+				checker.predicates = make(map[string]bool)
+				for _, p := range predicates {
+					checker.predicates[sink.expand(p)] = true
+				}
+			}
+			checker.check(e)
+			return nil
+		}
+		err = em.ReadAll(name, "", sink)
+		utils.HandleError(err)
+
+		report := checker.report(name, targets)
+		if format == "term" {
+			renderRefReport(report)
+		} else {
+			out, err := json.Marshal(report)
+			utils.HandleError(err)
+			if format == "pretty" {
+				out = pretty.Color(pretty.Pretty(out), nil)
+			}
+			fmt.Println(string(out))
+		}
+		if report.Dangling > 0 {
+			os.Exit(1)
+		}
+	},
+	TraverseChildren: true,
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) != 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return api.GetDatasetsCompletion(toComplete), cobra.ShellCompDirectiveNoFileComp
+	},
+}
+
+func init() {
+	CheckRefsCmd.Flags().StringP("name", "n", "", "The dataset to check")
+	CheckRefsCmd.Flags().StringSlice("targets", nil, "The datasets the references should point into")
+	CheckRefsCmd.Flags().StringSlice("predicates", nil, "Only check these references, default is all references")
+	CheckRefsCmd.Flags().Int("examples", 5, "The number of examples to show per reference")
+}
+
+// refIndex holds the ids of the entities in the target datasets
+type refIndex struct {
+	live    map[string]bool
+	deleted map[string]bool
+}
+
+func newRefIndex() *refIndex {
+	return &refIndex{live: make(map[string]bool), deleted: make(map[string]bool)}
+}
+
+func (i *refIndex) add(e *api.Entity) error {
+	if e.IsDeleted {
+		if !i.live[e.ID] {
+			i.deleted[e.ID] = true
+		}
+		return nil
+	}
+	i.live[e.ID] = true
+	delete(i.deleted, e.ID)
+	return nil
+}
+
+type danglingRef struct {
+	Entity    string `json:"entity"`
+	Reference string `json:"reference"`
+	Reason    string `json:"reason"`
+}
+
+type predicateReport struct {
+	Predicate  string        `json:"predicate"`
+	References int           `json:"references"`
+	Missing    int           `json:"missing"`
+	Deleted    int           `json:"deleted"`
+	Examples   []danglingRef `json:"examples"`
+}
+
+type refReport struct {
+	Dataset    string            `json:"dataset"`
+	Targets    []string          `json:"targets"`
+	Entities   int               `json:"entities"`
+	References int               `json:"references"`
+	Dangling   int               `json:"dangling"`
+	Predicates []predicateReport `json:"predicates"`
+}
+
+// refChecker counts the references per predicate, and the ones not found in the index
+type refChecker struct {
+	index      *refIndex
+	examples   int
+	predicates map[string]bool
+	entities   int
+	reports    map[string]*predicateReport
+}
+
+func newRefChecker(index *refIndex, examples int) *refChecker {
+	return &refChecker{index: index, examples: examples, reports: make(map[string]*predicateReport)}
+}
+
+func (c *refChecker) check(e *api.Entity) {
+	c.entities++
+	for predicate, value := range e.References {
+		if len(c.predicates) > 0 && !c.predicates[predicate] {
+			continue
+		}
+		r, ok := c.reports[predicate]
+		if !ok {
+			r = &predicateReport{Predicate: predicate, Examples: make([]danglingRef, 0)}
+			c.reports[predicate] = r
+		}
+		for _, ref := range refValues(value) {
+			r.References++
+			reason := ""
+			switch {
+			case c.index.live[ref]:
+				continue
+			case c.index.deleted[ref]:
+				r.Deleted++
+				reason = "deleted"
+			default:
+				r.Missing++
+				reason = "missing"
+			}
+			if len(r.Examples) < c.examples {
+				r.Examples = append(r.Examples, danglingRef{Entity: e.ID, Reference: ref, Reason: reason})
+			}
+		}
+	}
+}
+
+func refValues(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []interface{}:
+		refs := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				refs = append(refs, s)
+			}
+		}
+		return refs
+	}
+	return nil
+}
+
+// report lists the predicates with the most dangling references first
+func (c *refChecker) report(dataset string, targets []string) refReport {
+	r := refReport{
+		Dataset:    dataset,
+		Targets:    targets,
+		Entities:   c.entities,
+		Predicates: make([]predicateReport, 0, len(c.reports)),
+	}
+	for _, p := range c.reports {
+		r.References += p.References
+		r.Dangling += p.Missing + p.Deleted
+		r.Predicates = append(r.Predicates, *p)
+	}
+	sort.Slice(r.Predicates, func(i, j int) bool {
+		a, b := r.Predicates[i], r.Predicates[j]
+		if a.Missing+a.Deleted != b.Missing+b.Deleted {
+			return a.Missing+a.Deleted > b.Missing+b.Deleted
+		}
+		return a.Predicate < b.Predicate
+	})
+	return r
+}
+
+func renderRefReport(r refReport) {
+	out := [][]string{{"Reference", "Checked", "Missing", "Deleted"}}
+	for _, p := range r.Predicates {
+		out = append(out, []string{p.Predicate, fmt.Sprintf("%d", p.References), fmt.Sprintf("%d", p.Missing), fmt.Sprintf("%d", p.Deleted)})
+	}
+	pterm.DefaultSection.Printf("References from %s into %s", r.Dataset, strings.Join(r.Targets, ", "))
+	pterm.DefaultTable.WithHasHeader().WithData(out).Render()
+	pterm.Println()
+
+	for _, p := range r.Predicates {
+		if len(p.Examples) == 0 {
+			continue
+		}
+		examples := [][]string{{"Entity", "References", "Reason"}}
+		for _, ex := range p.Examples {
+			examples = append(examples, []string{ex.Entity, ex.Reference, ex.Reason})
+		}
+		pterm.DefaultSection.Println("Examples for " + p.Predicate)
+		pterm.DefaultTable.WithHasHeader().WithData(examples).Render()
+		pterm.Println()
+	}
+
+	if r.Dangling == 0 {
+		pterm.Success.Printf("All %d references from %d entities were found\n", r.References, r.Entities)
+	} else {
+		pterm.Warning.Printf("%d of %d references from %d entities are dangling\n", r.Dangling, r.References, r.Entities)
+	}
+	pterm.Println()
+}
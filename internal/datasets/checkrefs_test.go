@@ -0,0 +1,59 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datasets
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+)
+
+func TestCheckRefs(t *testing.T) {
+	g := goblin.Goblin(t)
+	g.Describe("dangling references", func() {
+		target := func(id string, deleted bool) *api.Entity {
+			e := api.NewEntity(id)
+			e.IsDeleted = deleted
+			return e
+		}
+		index := newRefIndex()
+		_ = index.add(target("http://ex/place/1", false))
+		_ = index.add(target("http://ex/place/2", true))
+
+		person := api.NewEntity("http://ex/person/1")
+		person.References["http://ex/livesIn"] = []interface{}{"http://ex/place/1", "http://ex/place/2"}
+		person.References["http://ex/bornIn"] = "http://ex/place/3"
+
+		g.It("should report missing and deleted references per predicate", func() {
+			c := newRefChecker(index, 5)
+			c.check(person)
+			r := c.report("people", []string{"places"})
+			g.Assert(r.References).Equal(3)
+			g.Assert(r.Dangling).Equal(2)
+			g.Assert(r.Predicates[0].Predicate).Equal("http://ex/bornIn")
+			g.Assert(r.Predicates[0].Examples).Equal([]danglingRef{{Entity: "http://ex/person/1", Reference: "http://ex/place/3", Reason: "missing"}})
+			g.Assert(r.Predicates[1].Deleted).Equal(1)
+		})
+		g.It("should only check the given predicates", func() {
+			c := newRefChecker(index, 5)
+			c.predicates = map[string]bool{"http://ex/livesIn": true}
+			c.check(person)
+			r := c.report("people", []string{"places"})
+			g.Assert(len(r.Predicates)).Equal(1)
+			g.Assert(r.References).Equal(2)
+		})
+	})
+}
@@ -0,0 +1,396 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datasets
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/mimiro-io/datahub-cli/internal/login"
+	"github.com/mimiro-io/datahub-cli/internal/utils"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"github.com/tidwall/pretty"
+)
+
+// ChecksumCmd computes a checksum of a dataset, and compares checksums
+var ChecksumCmd = &cobra.Command{
+	Use:   "checksum",
+	Short: "Compute and compare dataset checksums",
+	Long: `Compute a checksum of all entities in a dataset. Each entity is hashed with its namespaces expanded
+and its properties and references sorted, so the same data gives the same checksum on any server.
+The entity hashes are grouped into buckets by entity id, and the buckets are hashed into a single
+root hash. Deleted entities are not included.
+
+A dataset on another server is given as <alias>:<dataset>, using a login alias. For example:
+mim dataset checksum people.Person
+mim dataset checksum prod:people.Person --output people.checksum.json
+
+Give two datasets, or a dataset and a saved checksum with --compare, to compare them. If they
+differ, the buckets that differ are listed, and when both datasets are read the differing ids:
+mim dataset checksum prod:people.Person test:people.Person
+mim dataset checksum test:people.Person --compare people.checksum.json
+`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		format := utils.ResolveFormat(cmd)
+		if format != "term" {
+			pterm.DisableOutput()
+		}
+		pterm.EnableDebugMessages()
+
+		buckets, err := cmd.Flags().GetInt("buckets")
+		utils.HandleError(err)
+		if buckets < 1 || buckets > 65536 {
+			pterm.Error.Println("The number of buckets must be between 1 and 65536")
+			os.Exit(1)
+		}
+		output, err := cmd.Flags().GetString("output")
+		utils.HandleError(err)
+		compare, err := cmd.Flags().GetString("compare")
+		utils.HandleError(err)
+		limit, err := cmd.Flags().GetInt("limit")
+		utils.HandleError(err)
+
+		if len(args) == 2 && compare != "" {
+			pterm.Error.Println("Compare either two datasets, or a dataset with a saved checksum")
+			os.Exit(1)
+		}
+
+		checksums := make([]*datasetChecksum, 0, 2)
+		for _, ref := range args {
+			c, err := checksumDataset(ref, buckets)
+			utils.HandleError(err)
+			checksums = append(checksums, c)
+		}
+		if compare != "" {
+			content, err := os.ReadFile(compare)
+			utils.HandleError(err)
+			saved := &checksumSummary{}
+			err = json.Unmarshal(content, saved)
+			utils.HandleError(err)
+			checksums = append(checksums, &datasetChecksum{summary: *saved})
+		}
+
+		if output != "" {
+			content, err := json.MarshalIndent(checksums[0].summary, "", "  ")
+			utils.HandleError(err)
+			err = os.WriteFile(output, content, 0644)
+			utils.HandleError(err)
+			pterm.Success.Println("Wrote checksum to " + output)
+		}
+
+		var result interface{} = checksums[0].summary
+		differ := false
+		if len(checksums) == 2 {
+			cmp, err := compareChecksums(checksums[0], checksums[1], limit)
+			utils.HandleError(err)
+			if format == "term" {
+				renderComparison(cmp)
+			}
+			result = cmp
+			differ = !cmp.Equal
+		} else if format == "term" {
+			renderChecksum(checksums[0].summary)
+		}
+
+		if format != "term" {
+			out, err := json.Marshal(result)
+			utils.HandleError(err)
+			if format == "pretty" {
+				out = pretty.Color(pretty.Pretty(out), nil)
+			}
+			fmt.Println(string(out))
+		}
+		if differ {
+			os.Exit(1)
+		}
+	},
+	TraverseChildren: true,
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return api.GetDatasetsCompletion(toComplete), cobra.ShellCompDirectiveNoFileComp
+	},
+}
+
+func init() {
+	ChecksumCmd.Flags().Int("buckets", 256, "The number of id buckets to group entity hashes in")
+	ChecksumCmd.Flags().StringP("output", "o", "", "Save the checksum of the first dataset to this file")
+	ChecksumCmd.Flags().String("compare", "", "Compare the dataset with a checksum saved with --output")
+	ChecksumCmd.Flags().Int("limit", 20, "The maximum number of differing ids to list")
+}
+
+type checksumBucket struct {
+	Count int    `json:"count"`
+	Hash  string `json:"hash"`
+}
+
+type checksumSummary struct {
+	Dataset  string           `json:"dataset"`
+	Server   string           `json:"server,omitempty"`
+	Entities int              `json:"entities"`
+	Root     string           `json:"root"`
+	Buckets  []checksumBucket `json:"buckets"`
+}
+
+type entityHash struct {
+	id   string
+	hash [sha256.Size]byte
+}
+
+// datasetChecksum holds the checksum summary, and the entity hashes when the dataset was read
+type datasetChecksum struct {
+	summary checksumSummary
+	hashes  [][]entityHash
+}
+
+// datasetRef splits a dataset given as alias:dataset into the login alias and the dataset name
+func datasetRef(ref string) (string, string) {
+	if alias, name, ok := strings.Cut(ref, ":"); ok {
+		return alias, name
+	}
+	return "", ref
+}
+
+func checksumDataset(ref string, buckets int) (*datasetChecksum, error) {
+	alias, name := datasetRef(ref)
+	server, token, err := login.ResolveCredentialsFromAlias(alias)
+	if err != nil {
+		return nil, err
+	}
+	pterm.DefaultSection.Println("Computing checksum of " + server + "/datasets/" + name)
+
+	c := newChecksum(buckets)
+	err = readExpanded(server, token, name, c.add)
+	if err != nil {
+		return nil, err
+	}
+	summary := c.summarise()
+	summary.Dataset = name
+	summary.Server = server
+	return &datasetChecksum{summary: summary, hashes: c.hashes}, nil
+}
+
+func newChecksum(buckets int) *datasetChecksum {
+	return &datasetChecksum{hashes: make([][]entityHash, buckets)}
+}
+
+func (c *datasetChecksum) add(e *api.Entity) error {
+	h, err := canonicalHash(e)
+	if err != nil {
+		return err
+	}
+	b := bucketOf(e.ID, len(c.hashes))
+	c.hashes[b] = append(c.hashes[b], entityHash{id: e.ID, hash: h})
+	return nil
+}
+
+// summarise hashes each bucket from its entity hashes in id order, and the root from the bucket hashes
+func (c *datasetChecksum) summarise() checksumSummary {
+	s := checksumSummary{Buckets: make([]checksumBucket, len(c.hashes))}
+	root := sha256.New()
+	for i, hashes := range c.hashes {
+		sort.Slice(hashes, func(a, b int) bool { return hashes[a].id < hashes[b].id })
+		bucket := sha256.New()
+		for _, h := range hashes {
+			bucket.Write(h.hash[:])
+		}
+		sum := bucket.Sum(nil)
+		root.Write(sum)
+		s.Buckets[i] = checksumBucket{Count: len(hashes), Hash: hex.EncodeToString(sum)}
+		s.Entities += len(hashes)
+	}
+	s.Root = hex.EncodeToString(root.Sum(nil))
+	return s
+}
+
+// canonicalHash hashes the entity id, properties and references. Map keys are sorted by the json
+// encoder, and lists of references are sorted as their order carries no meaning.
+func canonicalHash(e *api.Entity) ([sha256.Size]byte, error) {
+	refs := make(map[string]interface{}, len(e.References))
+	for k, v := range e.References {
+		refs[k] = sortedRefs(v)
+	}
+	content, err := json.Marshal([]interface{}{e.ID, e.Properties, refs})
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(content), nil
+}
+
+func sortedRefs(v interface{}) interface{} {
+	switch list := v.(type) {
+	case []interface{}:
+		refs := make([]string, 0, len(list))
+		for _, item := range list {
+			s, ok := item.(string)
+			if !ok {
+				return v
+			}
+			refs = append(refs, s)
+		}
+		sort.Strings(refs)
+		return refs
+	case []string:
+		refs := append([]string{}, list...)
+		sort.Strings(refs)
+		return refs
+	}
+	return v
+}
+
+func bucketOf(id string, buckets int) int {
+	h := sha256.Sum256([]byte(id))
+	return int(binary.BigEndian.Uint32(h[:4]) % uint32(buckets))
+}
+
+type checksumComparison struct {
+	Equal       bool     `json:"equal"`
+	Left        string   `json:"left"`
+	Right       string   `json:"right"`
+	LeftRoot    string   `json:"leftRoot"`
+	RightRoot   string   `json:"rightRoot"`
+	LeftCount   int      `json:"leftEntities"`
+	RightCount  int      `json:"rightEntities"`
+	Buckets     []int    `json:"differingBuckets"`
+	OnlyLeft    []string `json:"onlyLeft,omitempty"`
+	OnlyRight   []string `json:"onlyRight,omitempty"`
+	Different   []string `json:"different,omitempty"`
+	IdsComplete bool     `json:"idsComplete"`
+}
+
+func compareChecksums(left *datasetChecksum, right *datasetChecksum, limit int) (*checksumComparison, error) {
+	l, r := left.summary, right.summary
+	if len(l.Buckets) != len(r.Buckets) {
+		return nil, fmt.Errorf("the checksums use a different number of buckets (%d and %d), use --buckets to match them", len(l.Buckets), len(r.Buckets))
+	}
+	cmp := &checksumComparison{
+		Equal:      l.Root == r.Root,
+		Left:       l.Server + "/datasets/" + l.Dataset,
+		Right:      r.Server + "/datasets/" + r.Dataset,
+		LeftRoot:   l.Root,
+		RightRoot:  r.Root,
+		LeftCount:  l.Entities,
+		RightCount: r.Entities,
+		Buckets:    make([]int, 0),
+	}
+	for i := range l.Buckets {
+		if l.Buckets[i].Hash != r.Buckets[i].Hash {
+			cmp.Buckets = append(cmp.Buckets, i)
+		}
+	}
+
+	if left.hashes == nil || right.hashes == nil {
+		return cmp, nil
+	}
+	cmp.IdsComplete = true
+	found := 0
+	note := func(list *[]string, id string) {
+		if found >= limit {
+			cmp.IdsComplete = false
+			return
+		}
+		found++
+		*list = append(*list, id)
+	}
+	for _, b := range cmp.Buckets {
+		lh := make(map[string][sha256.Size]byte)
+		for _, h := range left.hashes[b] {
+			lh[h.id] = h.hash
+		}
+		for _, h := range right.hashes[b] {
+			other, ok := lh[h.id]
+			switch {
+			case !ok:
+				note(&cmp.OnlyRight, h.id)
+			case other != h.hash:
+				note(&cmp.Different, h.id)
+			}
+			delete(lh, h.id)
+		}
+		ids := make([]string, 0, len(lh))
+		for id := range lh {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			note(&cmp.OnlyLeft, id)
+		}
+	}
+	return cmp, nil
+}
+
+func renderChecksum(s checksumSummary) {
+	used := 0
+	for _, b := range s.Buckets {
+		if b.Count > 0 {
+			used++
+		}
+	}
+	out := [][]string{
+		{"Dataset", s.Dataset},
+		{"Server", s.Server},
+		{"Entities", fmt.Sprintf("%d", s.Entities)},
+		{"Buckets", fmt.Sprintf("%d (%d in use)", len(s.Buckets), used)},
+		{"Checksum", s.Root},
+	}
+	pterm.DefaultTable.WithData(out).Render()
+	pterm.Println()
+}
+
+func renderComparison(cmp *checksumComparison) {
+	out := [][]string{
+		{"", "Entities", "Checksum"},
+		{cmp.Left, fmt.Sprintf("%d", cmp.LeftCount), cmp.LeftRoot},
+		{cmp.Right, fmt.Sprintf("%d", cmp.RightCount), cmp.RightRoot},
+	}
+	pterm.DefaultTable.WithHasHeader().WithData(out).Render()
+	pterm.Println()
+	if cmp.Equal {
+		pterm.Success.Println("The datasets are equal")
+		pterm.Println()
+		return
+	}
+
+	buckets := make([]string, 0, len(cmp.Buckets))
+	for _, b := range cmp.Buckets {
+		buckets = append(buckets, fmt.Sprintf("%d", b))
+	}
+	pterm.Warning.Printf("The datasets differ in %d bucket(s): %s\n", len(cmp.Buckets), strings.Join(buckets, ", "))
+
+	rows := [][]string{{"Entity", "Difference"}}
+	for _, id := range cmp.OnlyLeft {
+		rows = append(rows, []string{id, "only in " + cmp.Left})
+	}
+	for _, id := range cmp.OnlyRight {
+		rows = append(rows, []string{id, "only in " + cmp.Right})
+	}
+	for _, id := range cmp.Different {
+		rows = append(rows, []string{id, "changed"})
+	}
+	if len(rows) > 1 {
+		pterm.DefaultTable.WithHasHeader().WithData(rows).Render()
+		if !cmp.IdsComplete {
+			pterm.Info.Println("Only the first differences are listed, use --limit to see more")
+		}
+	}
+	pterm.Println()
+}
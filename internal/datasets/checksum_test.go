@@ -0,0 +1,74 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datasets
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+)
+
+func TestChecksum(t *testing.T) {
+	g := goblin.Goblin(t)
+	g.Describe("dataset checksums", func() {
+		entity := func(id string, name string, refs ...interface{}) *api.Entity {
+			e := api.NewEntity(id)
+			e.Properties["http://ex/name"] = name
+			e.References["http://ex/knows"] = refs
+			return e
+		}
+		build := func(entities ...*api.Entity) *datasetChecksum {
+			c := newChecksum(16)
+			for _, e := range entities {
+				g.Assert(c.add(e)).IsNil()
+			}
+			c.summary = c.summarise()
+			return c
+		}
+
+		g.It("should not depend on entity or reference order", func() {
+			a := build(entity("http://ex/1", "a", "http://ex/2", "http://ex/3"), entity("http://ex/2", "b"))
+			b := build(entity("http://ex/2", "b"), entity("http://ex/1", "a", "http://ex/3", "http://ex/2"))
+			g.Assert(a.summary.Root).Equal(b.summary.Root)
+			g.Assert(a.summary.Entities).Equal(2)
+		})
+		g.It("should list the differing ids", func() {
+			a := build(entity("http://ex/1", "a"), entity("http://ex/2", "b"))
+			b := build(entity("http://ex/1", "changed"), entity("http://ex/3", "c"))
+			cmp, err := compareChecksums(a, b, 10)
+			g.Assert(err).IsNil()
+			g.Assert(cmp.Equal).IsFalse()
+			g.Assert(cmp.Different).Equal([]string{"http://ex/1"})
+			g.Assert(cmp.OnlyLeft).Equal([]string{"http://ex/2"})
+			g.Assert(cmp.OnlyRight).Equal([]string{"http://ex/3"})
+			g.Assert(cmp.IdsComplete).IsTrue()
+		})
+		g.It("should compare with a saved checksum by bucket", func() {
+			a := build(entity("http://ex/1", "a"))
+			b := build(entity("http://ex/1", "b"))
+			cmp, err := compareChecksums(a, &datasetChecksum{summary: b.summary}, 10)
+			g.Assert(err).IsNil()
+			g.Assert(cmp.Buckets).Equal([]int{bucketOf("http://ex/1", 16)})
+			g.Assert(cmp.IdsComplete).IsFalse()
+		})
+		g.It("should split login aliases from dataset names", func() {
+			alias, name := datasetRef("prod:people.Person")
+			g.Assert([]string{alias, name}).Equal([]string{"prod", "people.Person"})
+			alias, name = datasetRef("people.Person")
+			g.Assert([]string{alias, name}).Equal([]string{"", "people.Person"})
+		})
+	})
+}
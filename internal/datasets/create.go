@@ -36,6 +36,7 @@ func CreateCmd() *cobra.Command {
 		proxy             bool
 		virtual           bool
 		virtualTransform  string
+		transformFile     string
 		proxyRemoteUrl    string
 		proxyAuthProvider string
 	)
@@ -56,6 +57,11 @@ Optionally, you can specify that the dataset is a proxy dataset:
 
 Optionally, you can specify that the dataset is a virtual dataset:
 	mim dataset create <name> --virtual --transform <BASE64_ENCODED_TRANSFORM>
+
+or compile the virtual dataset transform from a local .js or .ts file, like transform import does:
+	mim dataset create <name> --virtual --transform-file view.ts
+
+Use "mim dataset preview-virtual view.ts --source <dataset>" to try the transform before creating the dataset.
 `,
 		Run: func(cmd *cobra.Command, args []string) {
 			server, token, err := login.ResolveCredentials()
@@ -84,6 +90,14 @@ Optionally, you can specify that the dataset is a virtual dataset:
 				createDatasetConfig.ProxyDatasetConfig.RemoteUrl = proxyRemoteUrl
 				createDatasetConfig.ProxyDatasetConfig.AuthProviderName = proxyAuthProvider
 			}
+			if transformFile != "" {
+				if virtualTransform != "" {
+					utils.HandleError(errors.New("use either transform or transform-file, not both"))
+				}
+				virtual = true
+				virtualTransform, err = compileTransform(transformFile)
+				utils.HandleError(err)
+			}
 			if virtual {
 				createDatasetConfig.VirtualDatasetConfig = &VirtualDatasetConfig{}
 				if virtualTransform == "" {
@@ -123,6 +137,7 @@ Optionally, you can specify that the dataset is a virtual dataset:
 	cmd.Flags().StringVar(&proxyAuthProvider, "proxyAuthProvider", "", "name of token provider to be used with requests against remote")
 	cmd.Flags().BoolVar(&virtual, "virtual", false, "flag dataset as virtual dataset")
 	cmd.Flags().StringVar(&virtualTransform, "transform", "", "base64 encoded transform define virtual dataset")
+	cmd.Flags().StringVar(&transformFile, "transform-file", "", "path to a .js or .ts transform defining the virtual dataset, compiled like transform import")
 
 	return cmd
 }
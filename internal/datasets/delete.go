@@ -15,6 +15,7 @@
 package datasets
 
 import (
+	"context"
 	"fmt"
 	"github.com/mimiro-io/datahub-cli/internal/web"
 	"github.com/mimiro-io/datahub-cli/pkg/api"
@@ -35,6 +36,15 @@ var DeleteCmd = &cobra.Command{
 mim datasets delete --id <id>
 or
 mim jobs delete -i <id>
+
+Several datasets can be deleted at once by giving more names, glob patterns or regular expressions:
+mim dataset delete 'tmp.*' 'test.*' --dry-run
+mim dataset delete --regex '^test\.[0-9]+$'
+
+Before deleting, the jobs and the lineage on the server are checked for anything that depends on
+the datasets. If jobs or downstream datasets depend on them, the delete is refused unless --force
+is given. Use --pause-jobs to pause the affected jobs as part of the delete:
+mim dataset delete people.Person --force --pause-jobs
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		server, token, err := login.ResolveCredentials()
@@ -43,47 +53,124 @@ mim jobs delete -i <id>
 		name, err := cmd.Flags().GetString("name")
 		utils.HandleError(err)
 
-		if len(args) > 0 {
-			// use this as name
-			name = args[0]
-		}
+		selectors := append([]string{name}, args...)
 
-		if name == "" {
-			pterm.Error.Println("You must provide a dataset name")
-			os.Exit(1)
-		}
+		regex, err := cmd.Flags().GetBool("regex")
+		utils.HandleError(err)
+
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		utils.HandleError(err)
 
 		confirm, err := cmd.Flags().GetBool("confirm")
 		utils.HandleError(err)
 
+		force, err := cmd.Flags().GetBool("force")
+		utils.HandleError(err)
+
+		pauseJobs, err := cmd.Flags().GetBool("pause-jobs")
+		utils.HandleError(err)
+
 		pterm.EnableDebugMessages()
 
-		pterm.DefaultSection.Println("Deleting dataset " + server + "/datasets/" + name)
+		dm := api.NewDatasetManager(server, token)
+		selected, err := selectDatasets(dm, selectors, regex)
+		utils.HandleError(err)
 
-		if confirm {
-			pterm.DefaultSection.Printf("Delete dataset with name " + name + " on " + server + ", please type (y)es or (n)o and then press enter:")
-			if utils.AskForConfirmation() {
-				err = web.DeleteRequest(server, token, fmt.Sprintf("/datasets/%s", name))
-				utils.HandleError(err)
+		if len(selected) == 0 {
+			pterm.Error.Println("You must provide a dataset name, or a pattern matching one or more datasets")
+			os.Exit(1)
+		}
+
+		if len(selected) == 1 {
+			pterm.DefaultSection.Println("Deleting dataset " + server + "/datasets/" + selected[0].Name)
+		} else {
+			pterm.DefaultSection.Printf("Deleting %d datasets on %s", len(selected), server)
+			printSelection(selected)
+		}
+
+		names := make([]string, 0, len(selected))
+		for _, ds := range selected {
+			names = append(names, ds.Name)
+		}
+		jm := api.NewJobManager(server, token)
+		rels, err := getLineage(server, token)
+		if err != nil {
+			pterm.Warning.Printf("Could not read the lineage, downstream datasets are not checked: %s\n", err.Error())
+		}
+		deps := findDependants(jm.GetJobs(), rels, names)
+		activeJobs := deps.activeJobs()
 
-				pterm.Success.Println("Deleted dataset")
-				pterm.Println()
+		if !deps.isEmpty() {
+			renderDependants(deps)
+			if pauseJobs && len(activeJobs) > 0 {
+				pterm.Info.Printf("%d job(s) will be paused before the delete\n", len(activeJobs))
+			}
+		}
+
+		if dryRun {
+			pterm.Info.Println("Dry run, nothing was deleted")
+			pterm.Println()
+			return
+		}
+
+		if !deps.isEmpty() && !force {
+			pterm.Error.Println("Refusing to delete datasets that other jobs or datasets depend on, use --force to delete anyway")
+			os.Exit(1)
+		}
+
+		if confirm && !pauseJobs && len(activeJobs) > 0 {
+			pterm.DefaultSection.Printf("Pause the %d affected job(s) as well, please type (y)es or (n)o and then press enter:", len(activeJobs))
+			pauseJobs = utils.AskForConfirmation()
+		}
+
+		if confirm {
+			if len(selected) == 1 {
+				pterm.DefaultSection.Printf("Delete dataset with name " + selected[0].Name + " on " + server + ", please type (y)es or (n)o and then press enter:")
 			} else {
+				pterm.DefaultSection.Printf("Delete these %d datasets on %s, please type (y)es or (n)o and then press enter:", len(selected), server)
+			}
+			if !utils.AskForConfirmation() {
 				pterm.Println("Aborted!")
+				return
 			}
-		} else {
-			err = web.DeleteRequest(server, token, fmt.Sprintf("/datasets/%s", name))
-			utils.HandleError(err)
+		}
 
-			pterm.Success.Println("Deleted dataset")
-			pterm.Println()
+		if pauseJobs {
+			for _, job := range activeJobs {
+				_, err = jm.Operate.Pause(context.Background(), job.Id)
+				if err != nil {
+					pterm.Error.Printf("Could not pause job %s, nothing was deleted: %s\n", jobName(&job), err.Error())
+					os.Exit(1)
+				}
+				pterm.Success.Println("Paused job " + jobName(&job))
+			}
+		}
+
+		failed := false
+		deleted := make(map[string]string)
+		for _, ds := range selected {
+			err = web.DeleteRequest(server, token, fmt.Sprintf("/datasets/%s", ds.Name))
+			if len(selected) == 1 {
+				utils.HandleError(err)
+			}
+			if err != nil {
+				pterm.Error.Printf("Could not delete dataset %s: %s\n", ds.Name, err.Error())
+				failed = true
+				continue
+			}
+			deleted[ds.Name] = ""
+			pterm.Success.Println("Deleted dataset " + ds.Name)
+		}
+		if err := moveCatalogEntries(server, token, deleted); err != nil {
+			pterm.Warning.Printf("Could not remove the metadata of the deleted datasets: %s\n", err.Error())
+		}
+		pterm.Println()
+		if failed {
+			os.Exit(1)
 		}
 	},
 	TraverseChildren: true,
 	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
-		if len(args) != 0 {
-			return nil, cobra.ShellCompDirectiveNoFileComp
-		}
 		return api.GetDatasetsCompletion(toComplete), cobra.ShellCompDirectiveNoFileComp
 	},
 }
@@ -92,4 +179,8 @@ func init() {
 
 	DeleteCmd.Flags().StringP("name", "n", "", "The name of the dataset you want to get delete")
 	DeleteCmd.Flags().BoolP("confirm", "C", true, "Default flag to as for confirmation before delete")
+	DeleteCmd.Flags().Bool("regex", false, "Treat the names as regular expressions matched against all datasets")
+	DeleteCmd.Flags().Bool("dry-run", false, "Only list the datasets that would be deleted")
+	DeleteCmd.Flags().Bool("force", false, "Delete even if jobs or downstream datasets depend on the datasets")
+	DeleteCmd.Flags().Bool("pause-jobs", false, "Pause the jobs that depend on the datasets before deleting")
 }
@@ -0,0 +1,164 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datasets
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mimiro-io/datahub-cli/internal/lineage"
+	"github.com/mimiro-io/datahub-cli/internal/web"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+	"github.com/pterm/pterm"
+)
+
+// dependants are the jobs and downstream datasets that depend on a set of datasets
+type dependants struct {
+	jobs       []jobDependant
+	downstream []datasetDependant
+}
+
+type jobDependant struct {
+	dataset string
+	job     api.Job
+	roles   []string
+}
+
+// datasetDependant is a downstream dataset, with the datasets it is reached from and the shortest path
+type datasetDependant struct {
+	datasets []string
+	name     string
+	path     []string
+}
+
+func (d dependants) isEmpty() bool {
+	return len(d.jobs) == 0 && len(d.downstream) == 0
+}
+
+// activeJobs returns the dependant jobs that are not paused, once per job
+func (d dependants) activeJobs() []api.Job {
+	seen := make(map[string]bool)
+	jobs := make([]api.Job, 0)
+	for _, j := range d.jobs {
+		if j.job.Paused || seen[j.job.Id] {
+			continue
+		}
+		seen[j.job.Id] = true
+		jobs = append(jobs, j.job)
+	}
+	return jobs
+}
+
+func getLineage(server string, token string) ([]lineage.LineageRel, error) {
+	res, err := web.GetRequest(server, token, "/lineage")
+	if err != nil {
+		return nil, err
+	}
+	rels := make([]lineage.LineageRel, 0)
+	err = json.Unmarshal(res, &rels)
+	return rels, err
+}
+
+// findDependants finds the jobs referring to the datasets, and every dataset downstream of them in the lineage graph
+func findDependants(jobs []api.Job, rels []lineage.LineageRel, datasets []string) dependants {
+	deps := dependants{
+		jobs:       make([]jobDependant, 0),
+		downstream: make([]datasetDependant, 0),
+	}
+	targets := make(map[string]bool)
+	for _, ds := range datasets {
+		targets[ds] = true
+	}
+
+	for _, ds := range datasets {
+		for _, job := range jobs {
+			roles := make([]string, 0)
+			for _, ref := range job.DatasetRefs() {
+				if ref.Dataset == ds && !containsString(roles, ref.Role) {
+					roles = append(roles, ref.Role)
+				}
+			}
+			if len(roles) > 0 {
+				deps.jobs = append(deps.jobs, jobDependant{dataset: ds, job: job, roles: roles})
+			}
+		}
+	}
+
+	edges := make(map[string][]string)
+	for _, rel := range rels {
+		if !containsString(edges[rel.From], rel.To) {
+			edges[rel.From] = append(edges[rel.From], rel.To)
+		}
+	}
+	// a dataset downstream of several of the datasets is listed once, with all of them
+	found := make(map[string]int)
+	for _, ds := range datasets {
+		// breadth first, so that we get the shortest path to each downstream dataset
+		visited := map[string]bool{ds: true}
+		queue := [][]string{{ds}}
+		for len(queue) > 0 {
+			path := queue[0]
+			queue = queue[1:]
+			for _, next := range edges[path[len(path)-1]] {
+				if visited[next] {
+					continue
+				}
+				visited[next] = true
+				nextPath := append(append([]string{}, path...), next)
+				if i, ok := found[next]; ok {
+					d := &deps.downstream[i]
+					d.datasets = append(d.datasets, ds)
+					if len(nextPath) < len(d.path) {
+						d.path = nextPath
+					}
+				} else if !targets[next] {
+					found[next] = len(deps.downstream)
+					deps.downstream = append(deps.downstream, datasetDependant{datasets: []string{ds}, name: next, path: nextPath})
+				}
+				queue = append(queue, nextPath)
+			}
+		}
+	}
+	return deps
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func renderDependants(deps dependants) {
+	out := make([][]string, 0)
+	out = append(out, []string{"Dataset", "Dependant", "Kind", "Detail"})
+	for _, j := range deps.jobs {
+		detail := strings.Join(j.roles, ", ")
+		if j.job.Paused {
+			detail += " (paused)"
+		}
+		out = append(out, []string{j.dataset, jobName(&j.job), "job", detail})
+	}
+	for _, d := range deps.downstream {
+		out = append(out, []string{strings.Join(d.datasets, ", "), d.name, "dataset", strings.Join(d.path, " -> ")})
+	}
+	pterm.DefaultSection.Println("Dependencies")
+	pterm.DefaultTable.WithHasHeader().WithData(out).Render()
+	pterm.Println()
+	pterm.Warning.Println(fmt.Sprintf("%d job(s) and %d downstream dataset(s) depend on the datasets", len(deps.jobs), len(deps.downstream)))
+}
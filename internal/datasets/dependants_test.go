@@ -0,0 +1,62 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datasets
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+	"github.com/mimiro-io/datahub-cli/internal/lineage"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+)
+
+func TestFindDependants(t *testing.T) {
+	g := goblin.Goblin(t)
+	g.Describe("dataset dependants", func() {
+		jobs := []api.Job{
+			{Id: "j1", Source: map[string]interface{}{"Type": "DatasetSource", "Name": "a"},
+				Sink: map[string]interface{}{"Type": "DatasetSink", "Name": "b"}},
+			{Id: "j2", Paused: true, Source: map[string]interface{}{"Type": "DatasetSource", "Name": "b"},
+				Sink: map[string]interface{}{"Type": "DatasetSink", "Name": "c"}},
+		}
+		rels := []lineage.LineageRel{{From: "a", To: "b"}, {From: "b", To: "c"}, {From: "c", To: "a"}}
+
+		g.It("should find jobs with their roles", func() {
+			deps := findDependants(jobs, nil, []string{"b"})
+			g.Assert(len(deps.jobs)).Equal(2)
+			g.Assert(deps.jobs[0].roles).Equal([]string{api.RoleSink})
+			g.Assert(deps.jobs[1].roles).Equal([]string{api.RoleSource})
+			g.Assert(len(deps.activeJobs())).Equal(1)
+		})
+		g.It("should follow the lineage transitively and stop at cycles", func() {
+			deps := findDependants(nil, rels, []string{"a"})
+			g.Assert(len(deps.downstream)).Equal(2)
+			g.Assert(deps.downstream[1].path).Equal([]string{"a", "b", "c"})
+		})
+		g.It("should not list the deleted datasets as downstream", func() {
+			deps := findDependants(nil, rels, []string{"a", "b"})
+			g.Assert(len(deps.downstream)).Equal(1)
+			g.Assert(deps.downstream[0].name).Equal("c")
+		})
+		g.It("should list a dataset downstream of several datasets once", func() {
+			deps := findDependants(nil, rels, []string{"a", "b"})
+			g.Assert(deps.downstream[0].datasets).Equal([]string{"a", "b"})
+			g.Assert(deps.downstream[0].path).Equal([]string{"b", "c"})
+		})
+		g.It("should be empty when nothing depends on the dataset", func() {
+			g.Assert(findDependants(jobs, rels, []string{"x"}).isEmpty()).IsTrue()
+		})
+	})
+}
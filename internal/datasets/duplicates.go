@@ -0,0 +1,337 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datasets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/mimiro-io/datahub-cli/internal/login"
+	"github.com/mimiro-io/datahub-cli/internal/utils"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"github.com/tidwall/pretty"
+)
+
+const (
+	owlNamespace = "http://www.w3.org/2002/07/owl#"
+	owlSameAs    = owlNamespace + "sameAs"
+)
+
+// DuplicatesCmd finds entities that share key values
+var DuplicatesCmd = &cobra.Command{
+	Use:   "duplicates",
+	Short: "Find entities that are likely to be the same",
+	Long: `Find groups of entities that share the value of one or more key properties, within a dataset or
+across several datasets. Values are compared in lower case, without white space, dashes or dots at
+the ends. With --match any (the default), entities sharing any of the keys are grouped, also through
+other entities. With --match all, entities must share all the keys. For example:
+mim dataset duplicates people.Person --keys ns3:email,ns3:orgNumber
+or
+mim dataset duplicates crm.Customer erp.Customer --keys ns3:orgNumber --match all
+
+Use --to to store the groups as owl:sameAs references in a new dataset for review:
+mim dataset duplicates crm.Customer erp.Customer --keys ns3:email --to review.SameAs
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		format := utils.ResolveFormat(cmd)
+		if format != "term" {
+			pterm.DisableOutput()
+		}
+
+		server, token, err := login.ResolveCredentials()
+		utils.HandleError(err)
+
+		pterm.EnableDebugMessages()
+
+		name, err := cmd.Flags().GetString("name")
+		utils.HandleError(err)
+		datasets := args
+		if name != "" {
+			datasets = append([]string{name}, args...)
+		}
+		keys, err := cmd.Flags().GetStringSlice("keys")
+		utils.HandleError(err)
+		match, err := cmd.Flags().GetString("match")
+		utils.HandleError(err)
+		limit, err := cmd.Flags().GetInt("limit")
+		utils.HandleError(err)
+		to, err := cmd.Flags().GetString("to")
+		utils.HandleError(err)
+
+		if len(datasets) == 0 || len(keys) == 0 {
+			pterm.Error.Println("You must provide one or more datasets and the keys to compare")
+			os.Exit(1)
+		}
+		if match != "any" && match != "all" {
+			pterm.Error.Println("--match must be any or all")
+			os.Exit(1)
+		}
+		if to != "" {
+			utils.HandleError(ensureNewDataset(server, token, to))
+		}
+
+		finder := newDuplicateFinder(match == "all")
+		em := api.NewEntityManager(server, token, context.Background(), api.Entities)
+		for _, ds := range datasets {
+			pterm.DefaultSection.Println("Reading " + server + "/datasets/" + ds)
+			dataset := ds
+			sink := &expandingSink{}
+			var expandedKeys []string
+			sink.process = func(e *api.Entity) error {
+				if expandedKeys == nil {
+					expandedKeys = make([]string, 0, len(keys))
+					for _, k := range keys {
+						expandedKeys = append(expandedKeys, sink.expand(k))
+					}
+				}
+				finder.add(dataset, e, keys, expandedKeys)
+				return nil
+			}
+			err = em.ReadAll(ds, "", sink)
+			utils.HandleError(err)
+		}
+
+		groups := finder.groups()
+		if to != "" && len(groups) > 0 {
+			ctx, entities := sameAsEntities(groups)
+			err = storeSnapshot(server, token, to, ctx, entities)
+			utils.HandleError(err)
+			pterm.Success.Printf("Stored %d sameAs entities in %s\n", len(entities), to)
+		}
+
+		if format == "term" {
+			renderDuplicates(groups, finder.members, limit)
+			return
+		}
+		out, err := json.Marshal(groups)
+		utils.HandleError(err)
+		if format == "pretty" {
+			out = pretty.Color(pretty.Pretty(out), nil)
+		}
+		fmt.Println(string(out))
+	},
+	TraverseChildren: true,
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return api.GetDatasetsCompletion(toComplete), cobra.ShellCompDirectiveNoFileComp
+	},
+}
+
+func init() {
+	DuplicatesCmd.Flags().StringP("name", "n", "", "The dataset to search")
+	DuplicatesCmd.Flags().StringSlice("keys", nil, "The properties to compare, like ns3:email")
+	DuplicatesCmd.Flags().String("match", "any", "Group entities sharing any of the keys, or all of them")
+	DuplicatesCmd.Flags().Int("limit", 20, "The maximum number of groups to show")
+	DuplicatesCmd.Flags().String("to", "", "Store the groups as owl:sameAs references in this new dataset")
+}
+
+type duplicateMember struct {
+	Dataset string `json:"dataset"`
+	ID      string `json:"id"`
+}
+
+type duplicateGroup struct {
+	Keys    []string          `json:"keys"`
+	Members []duplicateMember `json:"members"`
+}
+
+// duplicateFinder groups entities by normalised key values. Members sharing a value are joined
+// with a union find, so that groups can be linked through different keys.
+type duplicateFinder struct {
+	matchAll bool
+	members  []duplicateMember
+	parent   []int
+	values   map[string]int
+	matched  map[int][]string
+}
+
+func newDuplicateFinder(matchAll bool) *duplicateFinder {
+	return &duplicateFinder{
+		matchAll: matchAll,
+		members:  make([]duplicateMember, 0),
+		parent:   make([]int, 0),
+		values:   make(map[string]int),
+		matched:  make(map[int][]string),
+	}
+}
+
+// add looks up the keys on the entity, either as given or expanded with the dataset namespaces
+func (f *duplicateFinder) add(dataset string, e *api.Entity, keys []string, expandedKeys []string) {
+	found := make([]string, 0, len(keys))
+	values := make([]string, 0, len(keys))
+	for i, key := range keys {
+		v, ok := e.Properties[expandedKeys[i]]
+		if !ok {
+			v, ok = e.Properties[key]
+		}
+		value := normaliseKey(v)
+		if !ok || value == "" {
+			if f.matchAll {
+				return
+			}
+			continue
+		}
+		found = append(found, key)
+		values = append(values, key+"="+value)
+	}
+	if len(values) == 0 {
+		return
+	}
+
+	m := len(f.members)
+	f.members = append(f.members, duplicateMember{Dataset: dataset, ID: e.ID})
+	f.parent = append(f.parent, m)
+	if f.matchAll {
+		values = []string{strings.Join(values, "\x00")}
+		found = []string{strings.Join(found, "+")}
+	}
+	for i, v := range values {
+		if other, ok := f.values[v]; ok {
+			f.union(other, m)
+			f.matched[m] = append(f.matched[m], found[i])
+			f.matched[other] = append(f.matched[other], found[i])
+		} else {
+			f.values[v] = m
+		}
+	}
+}
+
+func (f *duplicateFinder) find(i int) int {
+	for f.parent[i] != i {
+		f.parent[i] = f.parent[f.parent[i]]
+		i = f.parent[i]
+	}
+	return i
+}
+
+func (f *duplicateFinder) union(a int, b int) {
+	ra, rb := f.find(a), f.find(b)
+	if ra != rb {
+		f.parent[rb] = ra
+	}
+}
+
+// groups returns the groups with more than one distinct entity id, largest first
+func (f *duplicateFinder) groups() []duplicateGroup {
+	byRoot := make(map[int]*duplicateGroup)
+	order := make([]int, 0)
+	for i, m := range f.members {
+		if len(f.matched[i]) == 0 {
+			continue
+		}
+		root := f.find(i)
+		g, ok := byRoot[root]
+		if !ok {
+			g = &duplicateGroup{Keys: make([]string, 0), Members: make([]duplicateMember, 0)}
+			byRoot[root] = g
+			order = append(order, root)
+		}
+		g.Members = append(g.Members, m)
+		for _, k := range f.matched[i] {
+			if !containsString(g.Keys, k) {
+				g.Keys = append(g.Keys, k)
+			}
+		}
+	}
+
+	groups := make([]duplicateGroup, 0, len(order))
+	for _, root := range order {
+		g := byRoot[root]
+		ids := make(map[string]bool)
+		for _, m := range g.Members {
+			ids[m.ID] = true
+		}
+		if len(ids) > 1 {
+			sort.Strings(g.Keys)
+			groups = append(groups, *g)
+		}
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return len(groups[i].Members) > len(groups[j].Members) })
+	return groups
+}
+
+// normaliseKey lower cases the value and removes white space, and dashes and dots at the ends
+func normaliseKey(v interface{}) string {
+	var s string
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		s = val
+	default:
+		s = fmt.Sprintf("%v", val)
+	}
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, s)
+	return strings.Trim(s, "-.")
+}
+
+// sameAsEntities creates one entity per group, with owl:sameAs references from the first member to the others
+func sameAsEntities(groups []duplicateGroup) (*api.Entity, []*api.Entity) {
+	compactor := newNamespaceCompactor(map[string]interface{}{"owl": owlNamespace})
+	entities := make([]*api.Entity, 0, len(groups))
+	for _, g := range groups {
+		first := g.Members[0].ID
+		same := make([]interface{}, 0, len(g.Members)-1)
+		seen := map[string]bool{first: true}
+		for _, m := range g.Members[1:] {
+			if !seen[m.ID] {
+				seen[m.ID] = true
+				same = append(same, compactor.compact(m.ID))
+			}
+		}
+		e := api.NewEntity(compactor.compact(first))
+		e.References[compactor.compact(owlSameAs)] = same
+		entities = append(entities, e)
+	}
+	return compactor.context(), entities
+}
+
+func renderDuplicates(groups []duplicateGroup, members []duplicateMember, limit int) {
+	if len(groups) == 0 {
+		pterm.Success.Printf("No duplicates found among %d entities with key values\n", len(members))
+		pterm.Println()
+		return
+	}
+	shown := groups
+	if limit > 0 && len(shown) > limit {
+		shown = shown[:limit]
+	}
+	for i, g := range shown {
+		out := [][]string{{"Dataset", "Entity"}}
+		for _, m := range g.Members {
+			out = append(out, []string{m.Dataset, m.ID})
+		}
+		pterm.DefaultSection.Printf("Group %d, matched on %s", i+1, strings.Join(g.Keys, ", "))
+		pterm.DefaultTable.WithHasHeader().WithData(out).Render()
+	}
+	pterm.Println()
+	total := 0
+	for _, g := range groups {
+		total += len(g.Members)
+	}
+	pterm.Warning.Printf("Found %d groups with %d entities, showing %d groups\n", len(groups), total, len(shown))
+	pterm.Println()
+}
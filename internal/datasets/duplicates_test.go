@@ -0,0 +1,78 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datasets
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+)
+
+func TestDuplicates(t *testing.T) {
+	g := goblin.Goblin(t)
+	g.Describe("duplicate detection", func() {
+		keys := []string{"ns3:email", "ns3:orgNumber"}
+		expanded := []string{"http://ex/email", "http://ex/orgNumber"}
+		entity := func(id string, email string, org string) *api.Entity {
+			e := api.NewEntity(id)
+			if email != "" {
+				e.Properties["http://ex/email"] = email
+			}
+			if org != "" {
+				e.Properties["http://ex/orgNumber"] = org
+			}
+			return e
+		}
+
+		g.It("should normalise values", func() {
+			g.Assert(normaliseKey(" Ola.Nordmann@Example.COM ")).Equal("ola.nordmann@example.com")
+			g.Assert(normaliseKey("123 456 789")).Equal("123456789")
+			g.Assert(normaliseKey(nil)).Equal("")
+		})
+		g.It("should link groups through any of the keys", func() {
+			f := newDuplicateFinder(false)
+			f.add("crm", entity("http://ex/1", "a@x.no", ""), keys, expanded)
+			f.add("erp", entity("http://ex/2", "A@X.no", "123"), keys, expanded)
+			f.add("erp", entity("http://ex/3", "", "1 23"), keys, expanded)
+			f.add("erp", entity("http://ex/4", "b@x.no", "999"), keys, expanded)
+			groups := f.groups()
+			g.Assert(len(groups)).Equal(1)
+			g.Assert(len(groups[0].Members)).Equal(3)
+			g.Assert(groups[0].Keys).Equal([]string{"ns3:email", "ns3:orgNumber"})
+		})
+		g.It("should require all keys with match all", func() {
+			f := newDuplicateFinder(true)
+			f.add("crm", entity("http://ex/1", "a@x.no", "1"), keys, expanded)
+			f.add("crm", entity("http://ex/2", "a@x.no", "2"), keys, expanded)
+			f.add("crm", entity("http://ex/3", "a@x.no", "1"), keys, expanded)
+			groups := f.groups()
+			g.Assert(len(groups)).Equal(1)
+			g.Assert(groups[0].Members).Equal([]duplicateMember{{Dataset: "crm", ID: "http://ex/1"}, {Dataset: "crm", ID: "http://ex/3"}})
+		})
+		g.It("should ignore the same entity in several datasets", func() {
+			f := newDuplicateFinder(false)
+			f.add("a", entity("http://ex/1", "a@x.no", ""), keys, expanded)
+			f.add("b", entity("http://ex/1", "a@x.no", ""), keys, expanded)
+			g.Assert(len(f.groups())).Equal(0)
+		})
+		g.It("should write sameAs entities with a context", func() {
+			ctx, entities := sameAsEntities([]duplicateGroup{{Members: []duplicateMember{{ID: "http://ex/1"}, {ID: "http://ex/2"}}}})
+			g.Assert(ctx.Properties["namespaces"]).Equal(map[string]interface{}{"owl": owlNamespace, "ns1": "http://ex/"})
+			g.Assert(entities[0].ID).Equal("ns1:1")
+			g.Assert(entities[0].References["owl:sameAs"]).Equal([]interface{}{"ns1:2"})
+		})
+	})
+}
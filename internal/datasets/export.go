@@ -0,0 +1,124 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datasets
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/mimiro-io/datahub-cli/internal/login"
+	"github.com/mimiro-io/datahub-cli/internal/utils"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// ExportCmd writes all entities of one or more datasets to files
+var ExportCmd = &cobra.Command{
+	Use:     "export",
+	Aliases: []string{"backup"},
+	Short:   "Export the entities of one or more datasets to files",
+	Long: `Export all entities of one or more datasets to files, one file per dataset named <dataset>.json.
+The files can be loaded again with dataset store. For example:
+mim dataset export people.Person --dir ./backup
+or
+mim dataset backup 'people.*' 'places.*' --dir ./backup --dry-run
+or
+mim dataset export --regex '^(people|places)\.' --dir ./backup
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		server, token, err := login.ResolveCredentials()
+		utils.HandleError(err)
+
+		pterm.EnableDebugMessages()
+
+		name, err := cmd.Flags().GetString("name")
+		utils.HandleError(err)
+		dir, err := cmd.Flags().GetString("dir")
+		utils.HandleError(err)
+		regex, err := cmd.Flags().GetBool("regex")
+		utils.HandleError(err)
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		utils.HandleError(err)
+
+		dm := api.NewDatasetManager(server, token)
+		selected, err := selectDatasets(dm, append([]string{name}, args...), regex)
+		utils.HandleError(err)
+
+		if len(selected) == 0 {
+			pterm.Error.Println("You must provide a dataset name, or a pattern matching one or more datasets")
+			os.Exit(1)
+		}
+
+		pterm.DefaultSection.Printf("Exporting %d dataset(s) from %s to %s", len(selected), server, dir)
+		printSelection(selected)
+
+		if dryRun {
+			pterm.Info.Println("Dry run, nothing was exported")
+			pterm.Println()
+			return
+		}
+
+		err = os.MkdirAll(dir, os.ModePerm)
+		utils.HandleError(err)
+
+		em := api.NewEntityManager(server, token, context.Background(), api.Entities)
+		failed := false
+		for _, ds := range selected {
+			file := filepath.Join(dir, ds.Name+".json")
+			err = exportDataset(em, ds.Name, file)
+			if err != nil {
+				pterm.Error.Printf("Could not export %s: %s\n", ds.Name, err.Error())
+				failed = true
+				continue
+			}
+			pterm.Success.Printf("Exported %s to %s\n", ds.Name, file)
+		}
+		pterm.Println()
+		if failed {
+			os.Exit(1)
+		}
+	},
+	TraverseChildren: true,
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return api.GetDatasetsCompletion(toComplete), cobra.ShellCompDirectiveNoFileComp
+	},
+}
+
+func init() {
+	ExportCmd.Flags().StringP("name", "n", "", "The dataset to export")
+	ExportCmd.Flags().StringP("dir", "d", ".", "The directory to write the dataset files to")
+	ExportCmd.Flags().Bool("regex", false, "Treat the names as regular expressions matched against all datasets")
+	ExportCmd.Flags().Bool("dry-run", false, "Only list the datasets that would be exported")
+}
+
+func exportDataset(em *api.EntityManager, dataset string, file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	w := bufio.NewWriter(f)
+	err = em.ReadAll(dataset, "", &api.RawSink{Out: w})
+	if err != nil {
+		return err
+	}
+	return w.Flush()
+}
@@ -0,0 +1,498 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datasets
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mimiro-io/datahub-cli/internal/login"
+	"github.com/mimiro-io/datahub-cli/internal/utils"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// GenerateCmd generates fake entities from a schema
+var GenerateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Generate test entities from a schema",
+	Long: `Generate fake entities for one or more datasets from a yaml or json schema, and write them to
+entity files, one per dataset, or store them in the datasets. The same schema and seed always
+give the same entities. For example:
+mim dataset generate --schema schema.yaml --count 10000 --dir ./testdata
+or
+mim dataset generate --schema schema.yaml --seed 7 --store
+
+A schema looks like this:
+namespaces:
+  ex: http://data.example.io/
+  rdf: http://www.w3.org/1999/02/22-rdf-syntax-ns#
+datasets:
+  - name: test.Company
+    count: 50
+    id: ex:company-{seq}
+    properties:
+      ex:name: {generator: text, words: 2}
+      ex:orgNumber: {generator: pattern, pattern: "#########"}
+  - name: test.Person
+    id: ex:person-{seq}
+    properties:
+      ex:name: {generator: name}
+      ex:email: {generator: email}
+      ex:age: {generator: int, min: 18, max: 90}
+      ex:country: {generator: choice, values: [NO, SE, DK]}
+      ex:born: {generator: date, from: 1950-01-01, to: 2005-12-31}
+      ex:nickname: {generator: name, optional: 0.7}
+    references:
+      rdf:type: {value: ex:Person}
+      ex:worksAt: {dataset: test.Company}
+
+Generators are value, choice, int, float, bool, name, email, text, uuid, date, datetime and
+pattern, where # is a digit, ? a letter, * a letter or digit and {seq} the entity number.
+References with a dataset point to random entities generated for that dataset. Datasets without
+a count get the --count flag.
+
+Use --infer to create a schema from a sample of an existing dataset:
+mim dataset generate --infer people.Person --sample 1000 > schema.yaml
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		pterm.EnableDebugMessages()
+
+		infer, err := cmd.Flags().GetString("infer")
+		utils.HandleError(err)
+		if infer != "" {
+			sample, err := cmd.Flags().GetInt("sample")
+			utils.HandleError(err)
+			server, token, err := login.ResolveCredentials()
+			utils.HandleError(err)
+			schema, err := inferSchema(server, token, infer, sample)
+			utils.HandleError(err)
+			out, err := yaml.Marshal(schema)
+			utils.HandleError(err)
+			fmt.Print(string(out))
+			return
+		}
+
+		file, err := cmd.Flags().GetString("schema")
+		utils.HandleError(err)
+		count, err := cmd.Flags().GetInt("count")
+		utils.HandleError(err)
+		seed, err := cmd.Flags().GetInt64("seed")
+		utils.HandleError(err)
+		dir, err := cmd.Flags().GetString("dir")
+		utils.HandleError(err)
+		store, err := cmd.Flags().GetBool("store")
+		utils.HandleError(err)
+
+		if file == "" {
+			pterm.Error.Println("You must provide a schema file with --schema, or a dataset to infer a schema from with --infer")
+			os.Exit(1)
+		}
+		schema, err := readGenerateSchema(file)
+		utils.HandleError(err)
+		if !cmd.Flags().Changed("seed") && schema.Seed != 0 {
+			seed = schema.Seed
+		}
+		g, err := newGenerator(schema, count, seed)
+		utils.HandleError(err)
+
+		var server, token string
+		if store {
+			server, token, err = login.ResolveCredentials()
+			utils.HandleError(err)
+		} else {
+			err = os.MkdirAll(dir, os.ModePerm)
+			utils.HandleError(err)
+		}
+
+		ctx := api.NewContextWithNamespaces(g.namespaces)
+		for _, ds := range schema.Datasets {
+			entities := g.generate(ds.Name)
+			if store {
+				err = storeSnapshot(server, token, ds.Name, ctx, entities)
+				utils.HandleError(err)
+				pterm.Success.Printf("Stored %d entities in %s\n", len(entities), ds.Name)
+				continue
+			}
+			out := filepath.Join(dir, ds.Name+".json")
+			err = writeSnapshotFile(out, ctx, entities)
+			utils.HandleError(err)
+			pterm.Success.Printf("Wrote %d entities to %s\n", len(entities), out)
+		}
+		pterm.Println()
+	},
+	TraverseChildren: true,
+}
+
+func init() {
+	GenerateCmd.Flags().String("schema", "", "The yaml or json schema to generate entities from")
+	GenerateCmd.Flags().Int("count", 100, "The number of entities to generate for datasets without a count")
+	GenerateCmd.Flags().Int64("seed", 1, "The random seed")
+	GenerateCmd.Flags().StringP("dir", "d", ".", "The directory to write the entity files to")
+	GenerateCmd.Flags().Bool("store", false, "Store the entities in the datasets instead of writing files")
+	GenerateCmd.Flags().String("infer", "", "Print a schema inferred from a sample of this dataset")
+	GenerateCmd.Flags().Int("sample", 1000, "The number of entities to infer a schema from")
+}
+
+// generateSchema describes the datasets to generate
+type generateSchema struct {
+	Seed       int64                   `yaml:"seed,omitempty"`
+	Namespaces map[string]string       `yaml:"namespaces"`
+	Datasets   []generateDatasetSchema `yaml:"datasets"`
+}
+
+type generateDatasetSchema struct {
+	Name       string                `yaml:"name"`
+	Count      int                   `yaml:"count,omitempty"`
+	ID         string                `yaml:"id"`
+	Properties map[string]*valueSpec `yaml:"properties,omitempty"`
+	References map[string]*valueSpec `yaml:"references,omitempty"`
+}
+
+// valueSpec describes how to generate a property or reference value
+type valueSpec struct {
+	Generator string        `yaml:"generator,omitempty"`
+	Value     interface{}   `yaml:"value,omitempty"`
+	Values    []interface{} `yaml:"values,omitempty"`
+	Min       *float64      `yaml:"min,omitempty"`
+	Max       *float64      `yaml:"max,omitempty"`
+	From      string        `yaml:"from,omitempty"`
+	To        string        `yaml:"to,omitempty"`
+	Pattern   string        `yaml:"pattern,omitempty"`
+	Words     int           `yaml:"words,omitempty"`
+	Dataset   string        `yaml:"dataset,omitempty"`
+	Count     int           `yaml:"count,omitempty"`
+	Optional  float64       `yaml:"optional,omitempty"`
+}
+
+func readGenerateSchema(file string) (*generateSchema, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	schema := &generateSchema{}
+	// yaml is a superset of json, so this reads both
+	if err := yaml.Unmarshal(content, schema); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", file, err)
+	}
+	if len(schema.Datasets) == 0 {
+		return nil, fmt.Errorf("no datasets declared in %s", file)
+	}
+	return schema, nil
+}
+
+// generator creates the entities of the datasets in a schema
+type generator struct {
+	seed       int64
+	datasets   map[string]*generateDatasetSchema
+	namespaces map[string]interface{}
+}
+
+func newGenerator(schema *generateSchema, count int, seed int64) (*generator, error) {
+	g := &generator{
+		seed:       seed,
+		datasets:   make(map[string]*generateDatasetSchema),
+		namespaces: make(map[string]interface{}),
+	}
+	for prefix, ns := range schema.Namespaces {
+		g.namespaces[prefix] = ns
+	}
+	for i := range schema.Datasets {
+		ds := &schema.Datasets[i]
+		if ds.Name == "" {
+			return nil, fmt.Errorf("dataset %d has no name", i+1)
+		}
+		if _, ok := g.datasets[ds.Name]; ok {
+			return nil, fmt.Errorf("dataset %s is declared more than once", ds.Name)
+		}
+		if ds.Count == 0 {
+			ds.Count = count
+		}
+		if ds.Count < 0 {
+			return nil, fmt.Errorf("dataset %s has a negative count", ds.Name)
+		}
+		if ds.ID == "" {
+			if _, ok := g.namespaces["gen"]; !ok {
+				g.namespaces["gen"] = "http://data.mimiro.io/generated/"
+			}
+			ds.ID = "gen:" + ds.Name + "-{seq}"
+		}
+		g.datasets[ds.Name] = ds
+	}
+	for _, ds := range g.datasets {
+		for key, spec := range ds.Properties {
+			if err := checkValueSpec(spec); err != nil {
+				return nil, fmt.Errorf("property %s in %s: %w", key, ds.Name, err)
+			}
+		}
+		for key, spec := range ds.References {
+			if err := checkValueSpec(spec); err != nil {
+				return nil, fmt.Errorf("reference %s in %s: %w", key, ds.Name, err)
+			}
+			if spec == nil || spec.Dataset == "" {
+				continue
+			}
+			target, ok := g.datasets[spec.Dataset]
+			if !ok {
+				return nil, fmt.Errorf("reference %s in %s points to dataset %s, which is not in the schema", key, ds.Name, spec.Dataset)
+			}
+			if target.Count <= 0 {
+				return nil, fmt.Errorf("reference %s in %s points to dataset %s, which has no entities to point to", key, ds.Name, spec.Dataset)
+			}
+		}
+	}
+	return g, nil
+}
+
+// checkValueSpec returns an error for unknown generators, and for ranges that no value can be generated from
+func checkValueSpec(spec *valueSpec) error {
+	if spec == nil {
+		return nil
+	}
+	if spec.Count < 0 {
+		return fmt.Errorf("count must not be negative")
+	}
+	switch spec.Generator {
+	case "", "value", "choice", "int", "float", "bool", "name", "email", "text", "uuid", "date", "datetime", "pattern":
+	default:
+		return fmt.Errorf("unknown generator '%s'", spec.Generator)
+	}
+	if spec.Generator == "date" || spec.Generator == "datetime" {
+		if _, _, err := dateRange(spec); err != nil {
+			return err
+		}
+	}
+	if spec.Generator == "int" || spec.Generator == "float" {
+		min, max := valueRange(spec)
+		if min > max {
+			return fmt.Errorf("min %v is larger than max %v", min, max)
+		}
+		if spec.Generator == "int" && max-min >= math.MaxInt64 {
+			return fmt.Errorf("the range from %v to %v is too large", min, max)
+		}
+	}
+	return nil
+}
+
+// dateRange returns the from and to of a date or datetime spec, which default to 2000-01-01 and 2026-01-01
+func dateRange(spec *valueSpec) (time.Time, time.Time, error) {
+	from := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var err error
+	if spec.From != "" {
+		if from, err = parseTime(spec.From); err != nil {
+			return from, to, fmt.Errorf("from: %w", err)
+		}
+	}
+	if spec.To != "" {
+		if to, err = parseTime(spec.To); err != nil {
+			return from, to, fmt.Errorf("to: %w", err)
+		}
+	}
+	if from.After(to) {
+		return from, to, fmt.Errorf("from %s is after to %s", from.Format(time.RFC3339), to.Format(time.RFC3339))
+	}
+	return from, to, nil
+}
+
+// valueRange returns the min and max of an int or float spec. They default to 0 to 1000 for int and
+// 0 to 1 for float, and a spec with only a min gets a range of the same size starting at it.
+func valueRange(spec *valueSpec) (float64, float64) {
+	min, max := 0.0, 1000.0
+	if spec.Generator == "float" {
+		max = 1
+	}
+	switch {
+	case spec.Min != nil && spec.Max != nil:
+		min, max = *spec.Min, *spec.Max
+	case spec.Min != nil:
+		min, max = *spec.Min, *spec.Min+max
+	case spec.Max != nil:
+		max = *spec.Max
+		if max < min {
+			min = max - 1000
+			if spec.Generator == "float" {
+				min = max - 1
+			}
+		}
+	}
+	return min, max
+}
+
+// generate creates the entities of a dataset. Each dataset has its own random source derived
+// from the seed, so the result does not depend on the order of the datasets.
+func (g *generator) generate(name string) []*api.Entity {
+	ds := g.datasets[name]
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(name))
+	rng := rand.New(rand.NewSource(g.seed ^ int64(h.Sum64())))
+
+	entities := make([]*api.Entity, 0, ds.Count)
+	for seq := 1; seq <= ds.Count; seq++ {
+		e := api.NewEntity(g.id(ds, seq))
+		for _, key := range sortedKeys(ds.Properties) {
+			if v, ok := g.value(rng, ds.Properties[key], seq, false); ok {
+				e.Properties[key] = v
+			}
+		}
+		for _, key := range sortedKeys(ds.References) {
+			if v, ok := g.value(rng, ds.References[key], seq, true); ok {
+				e.References[key] = v
+			}
+		}
+		entities = append(entities, e)
+	}
+	return entities
+}
+
+func (g *generator) id(ds *generateDatasetSchema, seq int) string {
+	return strings.ReplaceAll(ds.ID, "{seq}", strconv.Itoa(seq))
+}
+
+func (g *generator) value(rng *rand.Rand, spec *valueSpec, seq int, reference bool) (interface{}, bool) {
+	if spec == nil || (spec.Optional > 0 && rng.Float64() < spec.Optional) {
+		return nil, false
+	}
+	if spec.Dataset != "" {
+		target := g.datasets[spec.Dataset]
+		if spec.Count <= 1 {
+			return g.id(target, rng.Intn(target.Count)+1), true
+		}
+		refs := make([]interface{}, 0, spec.Count)
+		for i := 0; i < spec.Count; i++ {
+			refs = append(refs, g.id(target, rng.Intn(target.Count)+1))
+		}
+		return refs, true
+	}
+	if spec.Count > 1 {
+		single := *spec
+		single.Count = 0
+		values := make([]interface{}, 0, spec.Count)
+		for i := 0; i < spec.Count; i++ {
+			if v, ok := g.value(rng, &single, seq, reference); ok {
+				values = append(values, v)
+			}
+		}
+		return values, true
+	}
+	return generateValue(rng, spec, seq), true
+}
+
+var (
+	firstNames = []string{"Ada", "Bjørn", "Camilla", "David", "Emma", "Fredrik", "Grace", "Henrik", "Ingrid", "Jonas",
+		"Kari", "Lars", "Maria", "Nils", "Olivia", "Per", "Ragnhild", "Sofie", "Thomas", "Ulla"}
+	lastNames = []string{"Andersen", "Berg", "Dahl", "Eriksen", "Hansen", "Haugen", "Johansen", "Larsen", "Lund",
+		"Nilsen", "Olsen", "Pedersen", "Solberg", "Strand", "Vik"}
+	words = []string{"alpha", "bravo", "delta", "data", "hub", "river", "stone", "green", "north", "harbour",
+		"field", "light", "signal", "forest", "bridge", "cloud", "market", "silver", "valley", "engine"}
+)
+
+func generateValue(rng *rand.Rand, spec *valueSpec, seq int) interface{} {
+	switch spec.Generator {
+	case "", "value":
+		if spec.Value == nil && len(spec.Values) > 0 {
+			return spec.Values[rng.Intn(len(spec.Values))]
+		}
+		return spec.Value
+	case "choice":
+		if len(spec.Values) == 0 {
+			return nil
+		}
+		return spec.Values[rng.Intn(len(spec.Values))]
+	case "int":
+		min, max := valueRange(spec)
+		return int64(min) + rng.Int63n(int64(max)-int64(min)+1)
+	case "float":
+		min, max := valueRange(spec)
+		return math.Round((min+rng.Float64()*(max-min))*1000) / 1000
+	case "bool":
+		return rng.Intn(2) == 1
+	case "name":
+		return firstNames[rng.Intn(len(firstNames))] + " " + lastNames[rng.Intn(len(lastNames))]
+	case "email":
+		first := strings.ToLower(firstNames[rng.Intn(len(firstNames))])
+		last := strings.ToLower(lastNames[rng.Intn(len(lastNames))])
+		return fmt.Sprintf("%s.%s%d@example.com", first, last, seq)
+	case "text":
+		n := spec.Words
+		if n <= 0 {
+			n = 5
+		}
+		out := make([]string, 0, n)
+		for i := 0; i < n; i++ {
+			out = append(out, words[rng.Intn(len(words))])
+		}
+		return strings.Join(out, " ")
+	case "uuid":
+		b := make([]byte, 16)
+		_, _ = rng.Read(b)
+		b[6] = (b[6] & 0x0f) | 0x40
+		b[8] = (b[8] & 0x3f) | 0x80
+		return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+	case "date", "datetime":
+		from, to, _ := dateRange(spec)
+		t := from
+		if to.After(from) {
+			t = from.Add(time.Duration(rng.Int63n(int64(to.Sub(from)))))
+		}
+		if spec.Generator == "date" {
+			return t.Format("2006-01-02")
+		}
+		return t.Format(time.RFC3339)
+	case "pattern":
+		return generatePattern(rng, spec.Pattern, seq)
+	}
+	return nil
+}
+
+// generatePattern replaces # with a digit, ? with a letter, * with a letter or digit, and {seq} with the sequence number
+func generatePattern(rng *rand.Rand, pattern string, seq int) string {
+	const letters = "abcdefghijklmnopqrstuvwxyz"
+	const alnum = letters + "0123456789"
+	pattern = strings.ReplaceAll(pattern, "{seq}", strconv.Itoa(seq))
+	var out strings.Builder
+	for _, r := range pattern {
+		switch r {
+		case '#':
+			out.WriteByte(byte('0' + rng.Intn(10)))
+		case '?':
+			out.WriteByte(letters[rng.Intn(len(letters))])
+		case '*':
+			out.WriteByte(alnum[rng.Intn(len(alnum))])
+		default:
+			out.WriteRune(r)
+		}
+	}
+	return out.String()
+}
+
+func sortedKeys(m map[string]*valueSpec) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,293 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datasets
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+)
+
+// maxChoices is the largest number of distinct values that is inferred as a choice
+const maxChoices = 10
+
+var (
+	emailPattern = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+	datePattern  = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+)
+
+// inferSchema reads a sample of a dataset, and infers a generate schema for it
+func inferSchema(server string, token string, dataset string, sample int) (*generateSchema, error) {
+	entities := make([]*api.Entity, 0)
+	sink := &changeLogSink{process: func(es []*api.Entity) error {
+		for _, e := range es {
+			if !e.IsDeleted {
+				entities = append(entities, e)
+			}
+		}
+		return nil
+	}}
+	em := api.NewEntityManager(server, token, context.Background(), api.Entities)
+	if err := em.Read(dataset, "", sample, false, sink); err != nil {
+		return nil, err
+	}
+
+	schema := &generateSchema{Namespaces: make(map[string]string)}
+	if sink.context != nil {
+		if ns, ok := sink.context.Properties["namespaces"].(map[string]interface{}); ok {
+			for prefix, uri := range ns {
+				if s, ok := uri.(string); ok {
+					schema.Namespaces[prefix] = s
+				}
+			}
+		}
+	}
+	schema.Datasets = []generateDatasetSchema{inferDatasetSchema(dataset, entities)}
+	return schema, nil
+}
+
+// fieldStats collects what a property or reference looks like across the sample
+type fieldStats struct {
+	count    int
+	values   int
+	lists    int
+	ints     int
+	floats   int
+	bools    int
+	strings  int
+	emails   int
+	dates    int
+	times    int
+	words    int
+	min      float64
+	max      float64
+	earliest time.Time
+	latest   time.Time
+	distinct map[string]int
+	samples  []string
+}
+
+func newFieldStats() *fieldStats {
+	return &fieldStats{min: math.Inf(1), max: math.Inf(-1), distinct: make(map[string]int)}
+}
+
+func (f *fieldStats) add(v interface{}) {
+	f.count++
+	values := []interface{}{v}
+	switch list := v.(type) {
+	case []interface{}:
+		f.lists++
+		values = list
+	case []string:
+		f.lists++
+		values = make([]interface{}, 0, len(list))
+		for _, s := range list {
+			values = append(values, s)
+		}
+	}
+	for _, value := range values {
+		f.values++
+		switch val := value.(type) {
+		case bool:
+			f.bools++
+		case float64:
+			if val == math.Trunc(val) {
+				f.ints++
+			} else {
+				f.floats++
+			}
+			f.min = math.Min(f.min, val)
+			f.max = math.Max(f.max, val)
+		case string:
+			f.strings++
+			f.words += len(strings.Fields(val))
+			if emailPattern.MatchString(val) {
+				f.emails++
+			}
+			if datePattern.MatchString(val) {
+				f.dates++
+			}
+			if t, err := time.Parse(time.RFC3339Nano, val); err == nil {
+				f.times++
+				if f.earliest.IsZero() || t.Before(f.earliest) {
+					f.earliest = t
+				}
+				if t.After(f.latest) {
+					f.latest = t
+				}
+			}
+			if t, err := time.Parse("2006-01-02", val); err == nil {
+				if f.earliest.IsZero() || t.Before(f.earliest) {
+					f.earliest = t
+				}
+				if t.After(f.latest) {
+					f.latest = t
+				}
+			}
+		}
+		key := fmt.Sprintf("%v", value)
+		if len(f.distinct) <= maxChoices || f.distinct[key] > 0 {
+			f.distinct[key]++
+		}
+		if len(f.samples) < 100 {
+			f.samples = append(f.samples, key)
+		}
+	}
+}
+
+// spec picks the generator that best fits what was seen
+func (f *fieldStats) spec(entities int, reference bool) *valueSpec {
+	spec := &valueSpec{}
+	if f.count < entities {
+		spec.Optional = math.Round(100*float64(entities-f.count)/float64(entities)) / 100
+	}
+	if f.lists > 0 && f.count > 0 {
+		spec.Count = int(math.Round(float64(f.values) / float64(f.count)))
+	}
+
+	if len(f.distinct) <= maxChoices && f.values >= 2*len(f.distinct) {
+		values := make([]string, 0, len(f.distinct))
+		for v := range f.distinct {
+			values = append(values, v)
+		}
+		sort.Slice(values, func(i, j int) bool {
+			if f.distinct[values[i]] != f.distinct[values[j]] {
+				return f.distinct[values[i]] > f.distinct[values[j]]
+			}
+			return values[i] < values[j]
+		})
+		if len(values) == 1 {
+			spec.Value = f.typed(values[0])
+			return spec
+		}
+		spec.Generator = "choice"
+		for _, v := range values {
+			spec.Values = append(spec.Values, f.typed(v))
+		}
+		return spec
+	}
+
+	switch {
+	case reference:
+		spec.Generator = "pattern"
+		spec.Pattern = commonPrefix(f.samples) + strings.Repeat("#", digitsFor(f.values))
+	case f.bools == f.values:
+		spec.Generator = "bool"
+	case f.ints == f.values:
+		spec.Generator = "int"
+		spec.Min, spec.Max = &f.min, &f.max
+	case f.ints+f.floats == f.values:
+		spec.Generator = "float"
+		spec.Min, spec.Max = &f.min, &f.max
+	case f.emails == f.values:
+		spec.Generator = "email"
+	case f.dates == f.values:
+		spec.Generator = "date"
+		spec.From, spec.To = f.earliest.Format("2006-01-02"), f.latest.Format("2006-01-02")
+	case f.times == f.values:
+		spec.Generator = "datetime"
+		spec.From, spec.To = f.earliest.Format(time.RFC3339), f.latest.Format(time.RFC3339)
+	default:
+		spec.Generator = "text"
+		spec.Words = 1
+		if f.strings > 0 {
+			spec.Words = int(math.Max(1, math.Round(float64(f.words)/float64(f.strings))))
+		}
+	}
+	return spec
+}
+
+// typed returns a choice value as a number or bool if that is what the field holds
+func (f *fieldStats) typed(v string) interface{} {
+	switch {
+	case f.bools == f.values:
+		return v == "true"
+	case f.ints+f.floats == f.values:
+		var n float64
+		if _, err := fmt.Sscan(v, &n); err == nil {
+			return n
+		}
+	}
+	return v
+}
+
+func inferDatasetSchema(name string, entities []*api.Entity) generateDatasetSchema {
+	props := make(map[string]*fieldStats)
+	refs := make(map[string]*fieldStats)
+	ids := make([]string, 0, len(entities))
+	for _, e := range entities {
+		ids = append(ids, e.ID)
+		for k, v := range e.Properties {
+			if props[k] == nil {
+				props[k] = newFieldStats()
+			}
+			props[k].add(v)
+		}
+		for k, v := range e.References {
+			if refs[k] == nil {
+				refs[k] = newFieldStats()
+			}
+			refs[k].add(v)
+		}
+	}
+
+	ds := generateDatasetSchema{
+		Name:       name,
+		Count:      len(entities),
+		ID:         commonPrefix(ids) + "{seq}",
+		Properties: make(map[string]*valueSpec),
+		References: make(map[string]*valueSpec),
+	}
+	for k, f := range props {
+		ds.Properties[k] = f.spec(len(entities), false)
+	}
+	for k, f := range refs {
+		ds.References[k] = f.spec(len(entities), true)
+	}
+	return ds
+}
+
+func commonPrefix(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	prefix := values[0]
+	for _, v := range values[1:] {
+		for !strings.HasPrefix(v, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	for !utf8.ValidString(prefix) {
+		prefix = prefix[:len(prefix)-1]
+	}
+	if len(values) == 1 {
+		// with a single value there is nothing to compare with, keep up to the namespace prefix
+		if i := strings.Index(prefix, ":"); i >= 0 {
+			return prefix[:i+1]
+		}
+	}
+	return prefix
+}
+
+func digitsFor(n int) int {
+	return int(math.Max(1, math.Ceil(math.Log10(float64(n)+1))))
+}
@@ -0,0 +1,160 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datasets
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+	"gopkg.in/yaml.v3"
+)
+
+const testSchema = `
+namespaces:
+  ex: http://data.example.io/
+  rdf: http://www.w3.org/1999/02/22-rdf-syntax-ns#
+datasets:
+  - name: test.Person
+    count: 20
+    id: ex:person-{seq}
+    properties:
+      ex:name: {generator: name}
+      ex:age: {generator: int, min: 18, max: 20}
+      ex:country: {generator: choice, values: [NO, SE]}
+      ex:code: {generator: pattern, pattern: "AB-##"}
+      ex:born: {generator: date, from: 1950-01-01, to: 1950-12-31}
+    references:
+      rdf:type: {value: ex:Person}
+      ex:worksAt: {dataset: test.Company}
+  - name: test.Company
+    count: 3
+    id: ex:company-{seq}
+`
+
+func TestGenerate(t *testing.T) {
+	g := goblin.Goblin(t)
+	g.Describe("test data generation", func() {
+		parse := func() *generateSchema {
+			schema := &generateSchema{}
+			g.Assert(yaml.Unmarshal([]byte(testSchema), schema)).IsNil()
+			return schema
+		}
+
+		g.It("should generate entities from the schema", func() {
+			gen, err := newGenerator(parse(), 100, 1)
+			g.Assert(err).IsNil()
+			people := gen.generate("test.Person")
+			g.Assert(len(people)).Equal(20)
+			g.Assert(people[0].ID).Equal("ex:person-1")
+			for _, p := range people {
+				age := p.Properties["ex:age"].(int64)
+				g.Assert(age >= 18 && age <= 20).IsTrue()
+				g.Assert(p.Properties["ex:code"].(string)[:3]).Equal("AB-")
+				g.Assert(p.Properties["ex:born"].(string)[:4]).Equal("1950")
+				g.Assert(p.References["rdf:type"]).Equal("ex:Person")
+				company := p.References["ex:worksAt"].(string)
+				g.Assert(company == "ex:company-1" || company == "ex:company-2" || company == "ex:company-3").IsTrue()
+			}
+		})
+		g.It("should give the same entities for the same seed", func() {
+			a, _ := newGenerator(parse(), 100, 7)
+			b, _ := newGenerator(parse(), 100, 7)
+			c, _ := newGenerator(parse(), 100, 8)
+			g.Assert(a.generate("test.Person")).Equal(b.generate("test.Person"))
+			g.Assert(a.generate("test.Person")[0].Properties["ex:name"] == c.generate("test.Person")[0].Properties["ex:name"] &&
+				a.generate("test.Person")[1].Properties["ex:name"] == c.generate("test.Person")[1].Properties["ex:name"]).IsFalse()
+		})
+		g.It("should refuse references to unknown datasets", func() {
+			schema := parse()
+			schema.Datasets = schema.Datasets[:1]
+			_, err := newGenerator(schema, 100, 1)
+			g.Assert(err == nil).IsFalse()
+		})
+		g.It("should refuse references to datasets without entities", func() {
+			_, err := newGenerator(parse(), 0, 1)
+			g.Assert(err == nil).IsTrue()
+			schema := parse()
+			schema.Datasets[1].Count = 0
+			_, err = newGenerator(schema, 0, 1)
+			g.Assert(err == nil).IsFalse()
+			_, err = newGenerator(parse(), -1, 1)
+			g.Assert(err == nil).IsTrue()
+			schema = parse()
+			schema.Datasets[0].Count = -1
+			_, err = newGenerator(schema, 100, 1)
+			g.Assert(err == nil).IsFalse()
+		})
+		g.It("should refuse ranges where min is larger than max", func() {
+			schema := parse()
+			min, max := 90.0, 18.0
+			schema.Datasets[0].Properties["ex:age"].Min = &min
+			schema.Datasets[0].Properties["ex:age"].Max = &max
+			_, err := newGenerator(schema, 100, 1)
+			g.Assert(err == nil).IsFalse()
+		})
+		g.It("should refuse unknown generators", func() {
+			schema := parse()
+			schema.Datasets[0].Properties["ex:name"].Generator = "names"
+			_, err := newGenerator(schema, 100, 1)
+			g.Assert(err.Error()).Equal("property ex:name in test.Person: unknown generator 'names'")
+		})
+		g.It("should refuse dates that can not be parsed or where from is after to", func() {
+			schema := parse()
+			schema.Datasets[0].Properties["ex:born"].From = "01.01.1950"
+			_, err := newGenerator(schema, 100, 1)
+			g.Assert(err == nil).IsFalse()
+
+			schema = parse()
+			schema.Datasets[0].Properties["ex:born"].From = "1960-01-01"
+			_, err = newGenerator(schema, 100, 1)
+			g.Assert(err.Error()).Equal("property ex:born in test.Person: from 1960-01-01T00:00:00Z is after to 1950-12-31T00:00:00Z")
+		})
+		g.It("should start the default range at min when only min is given", func() {
+			schema := parse()
+			min := 1950.0
+			schema.Datasets[0].Properties["ex:age"].Min = &min
+			schema.Datasets[0].Properties["ex:age"].Max = nil
+			gen, err := newGenerator(schema, 100, 1)
+			g.Assert(err).IsNil()
+			for _, p := range gen.generate("test.Person") {
+				year := p.Properties["ex:age"].(int64)
+				g.Assert(year >= 1950 && year <= 2950).IsTrue()
+			}
+		})
+		g.It("should infer a schema from entities", func() {
+			entities := make([]*api.Entity, 0)
+			for i, country := range []string{"NO", "SE", "NO", "NO"} {
+				e := api.NewEntity("ex:person-" + string(rune('1'+i)))
+				e.Properties["ex:country"] = country
+				e.Properties["ex:age"] = float64(20 + i)
+				e.Properties["ex:email"] = "a@example.com"
+				if i > 0 {
+					e.Properties["ex:email"] = "b" + string(rune('1'+i)) + "@example.com"
+				}
+				e.References["rdf:type"] = "ex:Person"
+				entities = append(entities, e)
+			}
+			ds := inferDatasetSchema("test.Person", entities)
+			g.Assert(ds.ID).Equal("ex:person-{seq}")
+			g.Assert(ds.Properties["ex:country"].Generator).Equal("choice")
+			g.Assert(ds.Properties["ex:country"].Values).Equal([]interface{}{"NO", "SE"})
+			g.Assert(ds.Properties["ex:age"].Generator).Equal("int")
+			g.Assert(*ds.Properties["ex:age"].Min).Equal(float64(20))
+			g.Assert(ds.Properties["ex:email"].Generator).Equal("email")
+			g.Assert(ds.References["rdf:type"].Value).Equal("ex:Person")
+		})
+	})
+}
@@ -58,7 +58,12 @@ mim dataset get <name>
 
 		e, err := dm.Get(name)
 		utils.HandleError(err)
-		printDataset(e, format)
+
+		var meta datasetMetadata
+		if catalog, err := readCatalog(server, token); err == nil {
+			meta = catalog.Datasets[name]
+		}
+		printDataset(e, meta, format)
 		pterm.Println()
 
 	},
@@ -84,10 +89,15 @@ func propStripper(entity *api.Entity) map[string]interface{} {
 	return singleMap
 }
 
-func printDataset(e *api.Entity, format string) {
+func printDataset(e *api.Entity, meta datasetMetadata, format string) {
 	pterm.DefaultSection.Println("Dataset: " + getVal(e.ID))
 
 	stripped := propStripper(e)
+	if !meta.empty() {
+		stripped["owner"] = meta.Owner
+		stripped["description"] = meta.Description
+		stripped["tags"] = meta.Tags
+	}
 	jd, err := json.Marshal(stripped)
 	utils.HandleError(err)
 
@@ -113,6 +123,9 @@ func printDataset(e *api.Entity, format string) {
 				val,
 			})
 		}
+		if !meta.empty() {
+			out = append(out, meta.rows()...)
+		}
 		pterm.DefaultTable.WithHasHeader().WithData(out).Render()
 		pterm.Println()
 	}
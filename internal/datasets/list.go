@@ -41,6 +41,8 @@ var ListCmd = &cobra.Command{
 	Short:   "List all datasets",
 	Long: `List all datasets. For example:
 mim dataset list
+or, to list the datasets with all the given tags:
+mim dataset list --tag crm,pii
 
 `,
 	Run: func(cmd *cobra.Command, args []string) {
@@ -54,6 +56,9 @@ mim dataset list
 
 		pterm.EnableDebugMessages()
 
+		tags, err := cmd.Flags().GetStringSlice("tag")
+		utils.HandleError(err)
+
 		pterm.DefaultSection.Println("Listing datasets on " + server + "/datasets")
 
 		dm := api.NewDatasetManager(server, token)
@@ -70,15 +75,44 @@ mim dataset list
 		}
 
 		if coreDataset != nil {
-			merged := mergeDatasetDetails(sets, coreDataset)
-			renderDataSets(merged, format)
-		} else {
-			renderDataSets(sets, format)
+			sets = mergeDatasetDetails(sets, coreDataset)
+		}
+
+		catalog, err := readCatalog(server, token)
+		if err != nil {
+			if len(tags) > 0 {
+				utils.HandleError(err)
+			}
+			catalog = &datasetCatalog{Datasets: make(map[string]datasetMetadata)}
 		}
+		renderDataSets(filterByTags(sets, catalog, tags), catalog, format)
 	},
 	TraverseChildren: true,
 }
 
+func init() {
+	ListCmd.Flags().StringSlice("tag", nil, "Only list datasets with all of these tags")
+}
+
+// listedDataset is a dataset with its catalog metadata, as listed in json
+type listedDataset struct {
+	api.Dataset
+	datasetMetadata
+}
+
+func filterByTags(sets []api.Dataset, catalog *datasetCatalog, tags []string) []api.Dataset {
+	if len(tags) == 0 {
+		return sets
+	}
+	out := make([]api.Dataset, 0)
+	for _, set := range sets {
+		if catalog.Datasets[set.Name].hasTags(tags) {
+			out = append(out, set)
+		}
+	}
+	return out
+}
+
 func mergeDatasetDetails(datasets []api.Dataset, coreDataset []api.Entity) []api.Dataset {
 	for i, dataset := range datasets {
 		for _, entity := range coreDataset {
@@ -90,14 +124,19 @@ func mergeDatasetDetails(datasets []api.Dataset, coreDataset []api.Entity) []api
 	return datasets
 }
 
-func renderDataSets(sets []api.Dataset, format string) {
+func renderDataSets(sets []api.Dataset, catalog *datasetCatalog, format string) {
+	listed := make([]listedDataset, 0, len(sets))
+	for _, set := range sets {
+		listed = append(listed, listedDataset{Dataset: set, datasetMetadata: catalog.Datasets[set.Name]})
+	}
+
 	switch format {
 	case "json":
-		out, err := json.Marshal(sets)
+		out, err := json.Marshal(listed)
 		utils.HandleError(err)
 		fmt.Println(string(out))
 	case "pretty":
-		out, err := json.Marshal(sets)
+		out, err := json.Marshal(listed)
 		utils.HandleError(err)
 		f := pretty.Pretty(out)
 		result := pretty.Color(f, nil)
@@ -105,7 +144,12 @@ func renderDataSets(sets []api.Dataset, format string) {
 		fmt.Println(string(result))
 	default:
 		out := make([][]string, 0)
-		out = append(out, []string{"#", "Dir", "Items", "Name"})
+		withMetadata := len(catalog.Datasets) > 0
+		if withMetadata {
+			out = append(out, []string{"#", "Dir", "Items", "Name", "Owner", "Tags"})
+		} else {
+			out = append(out, []string{"#", "Dir", "Items", "Name"})
+		}
 
 		p := message.NewPrinter(language.English)
 
@@ -125,12 +169,17 @@ func renderDataSets(sets []api.Dataset, format string) {
 					t = t + " "
 				}
 			}
-			out = append(out, []string{
+			row := []string{
 				fmt.Sprintf("%d", i+1),
 				t,
 				p.Sprintf("%13d", set.Items),
 				set.Name,
-			})
+			}
+			if withMetadata {
+				meta := catalog.Datasets[set.Name]
+				row = append(row, meta.Owner, strings.Join(meta.Tags, ", "))
+			}
+			out = append(out, row)
 		}
 
 		pterm.DefaultTable.WithHasHeader().WithData(out).Render()
@@ -0,0 +1,271 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datasets
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/mimiro-io/datahub-cli/internal/login"
+	"github.com/mimiro-io/datahub-cli/internal/utils"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// MigrateNamespaceCmd moves the contents of a dataset to new namespaces
+var MigrateNamespaceCmd = &cobra.Command{
+	Use:   "migrate-namespace",
+	Short: "Move the entities of a dataset to new namespaces",
+	Long: `Read all entities of a dataset, and rewrite every id, property key, reference key and value, and
+nested entity that starts with an old namespace to start with the new namespace instead. The
+result is stored in a new dataset with a context for the new namespaces, or written to a file.
+For example:
+mim dataset migrate-namespace crm.Customer --map http://crm.old.io/=http://crm.example.io/ --to crm.Customer2
+or
+mim dataset migrate-namespace crm.Customer --map http://a/=http://b/ --map http://c/=http://d/ --output customers.json
+
+With --tombstone, the old ids of the migrated entities are marked as deleted in the source dataset.
+Use --dry-run to only count what would be changed.
+`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		server, token, err := login.ResolveCredentials()
+		utils.HandleError(err)
+
+		pterm.EnableDebugMessages()
+
+		name, err := cmd.Flags().GetString("name")
+		utils.HandleError(err)
+		if len(args) > 0 {
+			name = args[0]
+		}
+		maps, err := cmd.Flags().GetStringArray("map")
+		utils.HandleError(err)
+		to, err := cmd.Flags().GetString("to")
+		utils.HandleError(err)
+		output, err := cmd.Flags().GetString("output")
+		utils.HandleError(err)
+		tombstone, err := cmd.Flags().GetBool("tombstone")
+		utils.HandleError(err)
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		utils.HandleError(err)
+		confirm, err := cmd.Flags().GetBool("confirm")
+		utils.HandleError(err)
+
+		if name == "" || len(maps) == 0 {
+			pterm.Error.Println("You must provide a dataset name and one or more --map old=new namespaces")
+			os.Exit(1)
+		}
+		if (to == "") == (output == "") && !dryRun {
+			pterm.Error.Println("You must provide either --to or --output")
+			os.Exit(1)
+		}
+		if to == name {
+			pterm.Error.Println("The migrated entities must be stored in a new dataset, not in " + name)
+			os.Exit(1)
+		}
+		mappings, err := parseNamespaceMappings(maps)
+		utils.HandleError(err)
+		if to != "" {
+			utils.HandleError(ensureNewDataset(server, token, to))
+		}
+
+		pterm.DefaultSection.Println("Reading " + server + "/datasets/" + name)
+		sink := &migrateSink{mappings: mappings}
+		em := api.NewEntityManager(server, token, context.Background(), api.Entities)
+		err = em.ReadAll(name, "", sink)
+		utils.HandleError(err)
+		m := sink.migration
+
+		out := [][]string{{"Old namespace", "New namespace", "Values rewritten"}}
+		for _, mapping := range mappings {
+			out = append(out, []string{mapping.from, mapping.to, fmt.Sprintf("%d", m.rewritten[mapping.from])})
+		}
+		pterm.DefaultTable.WithHasHeader().WithData(out).Render()
+		pterm.Println()
+		pterm.Info.Printf("%d of %d entities changed, %d got a new id\n", m.changed, len(sink.entities), len(sink.oldIds))
+
+		if dryRun {
+			pterm.Info.Println("Dry run, nothing was stored")
+			pterm.Println()
+			return
+		}
+
+		ctx := m.compactor.context()
+		if output != "" {
+			err = writeSnapshotFile(output, ctx, sink.entities)
+			utils.HandleError(err)
+			pterm.Success.Printf("Wrote %d entities to %s\n", len(sink.entities), output)
+		} else {
+			err = storeSnapshot(server, token, to, ctx, sink.entities)
+			utils.HandleError(err)
+			pterm.Success.Printf("Stored %d entities in %s\n", len(sink.entities), to)
+		}
+
+		if tombstone && len(sink.oldIds) > 0 {
+			if confirm {
+				pterm.DefaultSection.Printf("Mark %d old ids as deleted in %s, please type (y)es or (n)o and then press enter:", len(sink.oldIds), name)
+				if !utils.AskForConfirmation() {
+					pterm.Println("Aborted!")
+					return
+				}
+			}
+			tombstones := make([]*api.Entity, 0, len(sink.oldIds))
+			for _, id := range sink.oldIds {
+				e := api.NewEntity(id)
+				e.IsDeleted = true
+				tombstones = append(tombstones, e)
+			}
+			err = storeBatches(server, token, name, sink.context, tombstones)
+			utils.HandleError(err)
+			pterm.Success.Printf("Marked %d old ids as deleted in %s\n", len(tombstones), name)
+		}
+		pterm.Println()
+	},
+	TraverseChildren: true,
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) != 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return api.GetDatasetsCompletion(toComplete), cobra.ShellCompDirectiveNoFileComp
+	},
+}
+
+func init() {
+	MigrateNamespaceCmd.Flags().StringP("name", "n", "", "The dataset to migrate")
+	MigrateNamespaceCmd.Flags().StringArray("map", nil, "An old=new namespace pair, can be given more than once")
+	MigrateNamespaceCmd.Flags().String("to", "", "Store the migrated entities in this new dataset")
+	MigrateNamespaceCmd.Flags().StringP("output", "o", "", "Write the migrated entities to this file")
+	MigrateNamespaceCmd.Flags().Bool("tombstone", false, "Mark the old ids as deleted in the source dataset")
+	MigrateNamespaceCmd.Flags().Bool("dry-run", false, "Only count what would be changed")
+	MigrateNamespaceCmd.Flags().BoolP("confirm", "C", true, "Ask for confirmation before marking old ids as deleted")
+}
+
+type namespaceMapping struct {
+	from string
+	to   string
+}
+
+// parseNamespaceMappings parses old=new pairs, longest old namespace first so that it wins over shorter ones
+func parseNamespaceMappings(maps []string) ([]namespaceMapping, error) {
+	mappings := make([]namespaceMapping, 0, len(maps))
+	for _, m := range maps {
+		from, to, ok := strings.Cut(m, "=")
+		if !ok || from == "" || to == "" {
+			return nil, fmt.Errorf("invalid namespace mapping '%s', use old=new", m)
+		}
+		mappings = append(mappings, namespaceMapping{from: from, to: to})
+	}
+	sort.SliceStable(mappings, func(i, j int) bool { return len(mappings[i].from) > len(mappings[j].from) })
+	return mappings, nil
+}
+
+// namespaceMigration rewrites values in old namespaces. Values that did not change are kept as
+// they were, changed values that were prefixed are compacted again against the new context.
+type namespaceMigration struct {
+	mappings  []namespaceMapping
+	expand    func(string) string
+	compactor *namespaceCompactor
+	rewritten map[string]int
+	changed   int
+}
+
+func newNamespaceMigration(mappings []namespaceMapping, namespaces map[string]interface{}) *namespaceMigration {
+	return &namespaceMigration{
+		mappings:  mappings,
+		expand:    api.ValueExpander(namespaces),
+		compactor: newNamespaceCompactor(namespaces),
+		rewritten: make(map[string]int),
+	}
+}
+
+func (m *namespaceMigration) rewrite(value string) string {
+	expanded := m.expand(value)
+	for _, mapping := range m.mappings {
+		if strings.HasPrefix(expanded, mapping.from) {
+			m.rewritten[mapping.from]++
+			uri := mapping.to + strings.TrimPrefix(expanded, mapping.from)
+			if expanded == value { // a full uri, and not a prefixed value
+				return uri
+			}
+			return m.compactor.compact(uri)
+		}
+	}
+	return value
+}
+
+// migrate rewrites the entity in place, and returns true if anything changed
+func (m *namespaceMigration) migrate(e *api.Entity) bool {
+	before := 0
+	for _, n := range m.rewritten {
+		before += n
+	}
+	api.ExpandEntity(e, m.rewrite)
+	after := 0
+	for _, n := range m.rewritten {
+		after += n
+	}
+	if after > before {
+		m.changed++
+		return true
+	}
+	return false
+}
+
+// migrateSink migrates the entities with the context of the source dataset, and keeps the old
+// ids of entities that got a new id
+type migrateSink struct {
+	mappings  []namespaceMapping
+	migration *namespaceMigration
+	context   *api.Entity
+	entities  []*api.Entity
+	oldIds    []string
+}
+
+func (s *migrateSink) Start() {
+	s.entities = make([]*api.Entity, 0)
+	s.oldIds = make([]string, 0)
+	s.context = api.NewContext()
+	s.migration = newNamespaceMigration(s.mappings, nil)
+}
+func (s *migrateSink) End() {}
+
+func (s *migrateSink) ProcessEntities(entities []*api.Entity) error {
+	for _, e := range entities {
+		switch e.ID {
+		case "@context":
+			if ns, ok := e.Properties["namespaces"].(map[string]interface{}); ok {
+				s.context = e
+				s.migration = newNamespaceMigration(s.mappings, ns)
+			}
+		case "@continuation":
+		default:
+			if e.IsDeleted {
+				continue
+			}
+			id := e.ID
+			s.migration.migrate(e)
+			if e.ID != id {
+				s.oldIds = append(s.oldIds, id)
+			}
+			s.entities = append(s.entities, e)
+		}
+	}
+	return nil
+}
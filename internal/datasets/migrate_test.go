@@ -0,0 +1,66 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datasets
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+)
+
+func TestMigrateNamespace(t *testing.T) {
+	g := goblin.Goblin(t)
+	g.Describe("namespace migration", func() {
+		namespaces := map[string]interface{}{"ns1": "http://old.io/", "ns2": "http://other.io/"}
+
+		g.It("should parse mappings with the longest namespace first", func() {
+			mappings, err := parseNamespaceMappings([]string{"http://old.io/=http://new.io/", "http://old.io/a/=http://a.io/"})
+			g.Assert(err).IsNil()
+			g.Assert(mappings[0]).Equal(namespaceMapping{from: "http://old.io/a/", to: "http://a.io/"})
+			_, err = parseNamespaceMappings([]string{"http://old.io/"})
+			g.Assert(err == nil).IsFalse()
+		})
+		g.It("should rewrite ids, keys, values and nested entities", func() {
+			mappings, _ := parseNamespaceMappings([]string{"http://old.io/=http://new.io/"})
+			m := newNamespaceMigration(mappings, namespaces)
+			nested := api.NewEntity("ns1:n1")
+			nested.Properties["ns1:name"] = "nested"
+			e := api.NewEntity("ns1:1")
+			e.Properties["ns1:name"] = "one"
+			e.Properties["ns2:homepage"] = "http://old.io/page"
+			e.Properties["ns2:address"] = nested
+			e.References["ns2:knows"] = []string{"ns1:2", "ns2:3"}
+
+			g.Assert(m.migrate(e)).IsTrue()
+			g.Assert(e.ID).Equal("ns3:1")
+			g.Assert(e.Properties["ns3:name"]).Equal("one")
+			g.Assert(e.Properties["ns2:homepage"]).Equal("http://new.io/page")
+			g.Assert(e.Properties["ns2:address"].(*api.Entity).ID).Equal("ns3:n1")
+			g.Assert(e.References["ns2:knows"]).Equal([]string{"ns3:2", "ns2:3"})
+			g.Assert(m.compactor.context().Properties["namespaces"]).Equal(map[string]interface{}{
+				"ns1": "http://old.io/", "ns2": "http://other.io/", "ns3": "http://new.io/",
+			})
+		})
+		g.It("should leave entities outside the namespaces alone", func() {
+			mappings, _ := parseNamespaceMappings([]string{"http://old.io/=http://new.io/"})
+			m := newNamespaceMigration(mappings, namespaces)
+			e := api.NewEntity("ns2:1")
+			e.Properties["ns2:name"] = "two"
+			g.Assert(m.migrate(e)).IsFalse()
+			g.Assert(m.changed).Equal(0)
+		})
+	})
+}
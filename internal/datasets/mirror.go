@@ -0,0 +1,509 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datasets
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mimiro-io/datahub-cli/internal/login"
+	"github.com/mimiro-io/datahub-cli/internal/utils"
+	"github.com/mimiro-io/datahub-cli/internal/web"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+const (
+	mirrorContextFile  = "_context.json"
+	mirrorManifestFile = ".mim-manifest.json"
+)
+
+// PullCmd writes a dataset to a directory with one file per entity
+var PullCmd = &cobra.Command{
+	Use:   "pull",
+	Short: "Mirror a dataset to a directory with one file per entity",
+	Long: `Write all entities of a dataset to a directory, one file per entity with sorted keys, and the
+namespaces of the dataset in _context.json. The files are stable between pulls, so the directory
+can be kept under version control and changes reviewed as a diff. For example:
+mim dataset pull reference.Country --dir ./data/reference.Country
+
+Files of entities that are no longer in the dataset are removed. A pull will not overwrite local
+changes that have not been pushed, unless --force is given.
+`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		server, token, err := login.ResolveCredentials()
+		utils.HandleError(err)
+
+		pterm.EnableDebugMessages()
+
+		name, err := cmd.Flags().GetString("name")
+		utils.HandleError(err)
+		if len(args) > 0 {
+			name = args[0]
+		}
+		dir, err := cmd.Flags().GetString("dir")
+		utils.HandleError(err)
+		force, err := cmd.Flags().GetBool("force")
+		utils.HandleError(err)
+
+		if name == "" {
+			pterm.Error.Println("You must provide a dataset name")
+			os.Exit(1)
+		}
+		if dir == "" {
+			dir = name
+		}
+
+		previous, err := readManifest(dir)
+		utils.HandleError(err)
+		if previous != nil && previous.Dataset != name && !force {
+			pterm.Error.Printf("%s is a mirror of %s, use --force to pull %s into it\n", dir, previous.Dataset, name)
+			os.Exit(1)
+		}
+		if previous != nil && !force {
+			changes, err := localChanges(dir, previous)
+			utils.HandleError(err)
+			if !changes.empty() {
+				pterm.Error.Printf("%s has %d changed and %d deleted files that are not pushed, use --force to overwrite them\n",
+					dir, len(changes.changed), len(changes.deleted))
+				os.Exit(1)
+			}
+		}
+
+		pterm.DefaultSection.Println("Pulling " + server + "/datasets/" + name + " to " + dir)
+		entities := make([]*api.Entity, 0)
+		sink := &changeLogSink{process: func(es []*api.Entity) error {
+			for _, e := range es {
+				if !e.IsDeleted {
+					entities = append(entities, e)
+				}
+			}
+			return nil
+		}}
+		em := api.NewEntityManager(server, token, context.Background(), api.Entities)
+		err = em.ReadAll(name, "", sink)
+		utils.HandleError(err)
+		if sink.context == nil {
+			sink.context = api.NewContext()
+		}
+
+		manifest, err := writeMirror(dir, name, sink.context, entities, previous)
+		utils.HandleError(err)
+		pterm.Success.Printf("Pulled %d entities to %s\n", len(manifest.Files), dir)
+		pterm.Println()
+	},
+	TraverseChildren: true,
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) != 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return api.GetDatasetsCompletion(toComplete), cobra.ShellCompDirectiveNoFileComp
+	},
+}
+
+// PushCmd sends the entity files that changed since the last pull back to the dataset
+var PushCmd = &cobra.Command{
+	Use:   "push",
+	Short: "Store the changes in a mirror directory back to the dataset",
+	Long: `Store the entity files in a directory written by dataset pull that were added or changed since the
+last pull or push. Files that were removed are stored as deleted entities, unless their entity moved to
+another file, and when the id in a file is edited the old id is deleted. For example:
+mim dataset push --dir ./data/reference.Country
+or
+mim dataset push --dir ./data/reference.Country --dry-run
+
+The dataset is the one the directory was pulled from, unless another dataset is given.
+`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		server, token, err := login.ResolveCredentials()
+		utils.HandleError(err)
+
+		pterm.EnableDebugMessages()
+
+		dir, err := cmd.Flags().GetString("dir")
+		utils.HandleError(err)
+		name, err := cmd.Flags().GetString("name")
+		utils.HandleError(err)
+		if len(args) > 0 {
+			name = args[0]
+		}
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		utils.HandleError(err)
+
+		manifest, err := readManifest(dir)
+		utils.HandleError(err)
+		if manifest == nil {
+			pterm.Error.Printf("%s is not a dataset mirror, use dataset pull first\n", dir)
+			os.Exit(1)
+		}
+		if name == "" {
+			name = manifest.Dataset
+		}
+
+		changes, err := localChanges(dir, manifest)
+		utils.HandleError(err)
+		renderMirrorChanges(changes)
+		if changes.empty() {
+			pterm.Success.Println("Nothing to push")
+			pterm.Println()
+			return
+		}
+		if dryRun {
+			pterm.Info.Println("Dry run, nothing was pushed")
+			pterm.Println()
+			return
+		}
+
+		pterm.DefaultSection.Println("Pushing " + dir + " to " + server + "/datasets/" + name)
+		err = pushMirror(server, token, name, dir, changes)
+		utils.HandleError(err)
+
+		// deleted files go first, as a file whose id was edited is both deleted and changed
+		for _, f := range append(changes.deleted, changes.moved...) {
+			delete(manifest.Files, f.file)
+		}
+		for _, f := range changes.changed {
+			manifest.Files[f.file] = f.entry
+		}
+		manifest.Context = changes.contextHash
+		err = writeManifest(dir, manifest)
+		utils.HandleError(err)
+		pterm.Success.Printf("Pushed %d changed and %d deleted entities to %s\n", len(changes.changed), len(changes.deleted), name)
+		pterm.Println()
+	},
+	TraverseChildren: true,
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) != 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return api.GetDatasetsCompletion(toComplete), cobra.ShellCompDirectiveNoFileComp
+	},
+}
+
+func init() {
+	PullCmd.Flags().StringP("name", "n", "", "The dataset to pull")
+	PullCmd.Flags().StringP("dir", "d", "", "The directory to write the entities to, defaults to the dataset name")
+	PullCmd.Flags().Bool("force", false, "Overwrite local changes that are not pushed")
+
+	PushCmd.Flags().StringP("name", "n", "", "The dataset to push to, defaults to the dataset that was pulled")
+	PushCmd.Flags().StringP("dir", "d", ".", "The mirror directory to push")
+	PushCmd.Flags().Bool("dry-run", false, "Only list the files that would be pushed")
+}
+
+// mirrorManifest records the hash of each entity file as it was last pulled or pushed
+type mirrorManifest struct {
+	Dataset string                 `json:"dataset"`
+	Context string                 `json:"context"`
+	Files   map[string]mirrorEntry `json:"files"`
+}
+
+type mirrorEntry struct {
+	ID   string `json:"id"`
+	Hash string `json:"hash"`
+}
+
+type mirrorFile struct {
+	file  string
+	entry mirrorEntry
+}
+
+type mirrorChanges struct {
+	context     bool
+	contextHash string
+	changed     []mirrorFile
+	deleted     []mirrorFile
+	// moved are removed files whose entity is now in another file, so nothing is deleted for them
+	moved []mirrorFile
+}
+
+func (c *mirrorChanges) empty() bool {
+	return !c.context && len(c.changed) == 0 && len(c.deleted) == 0 && len(c.moved) == 0
+}
+
+// mirrorFileName turns an entity id into a file name. Ids that are not safe as a file name are
+// cleaned up, and get a short hash of the id added to keep them apart.
+func mirrorFileName(id string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, id)
+	if len(name) > 100 {
+		name = name[:100]
+	}
+	if name != id || strings.HasPrefix(name, "_") || strings.HasPrefix(name, ".") {
+		sum := sha256.Sum256([]byte(id))
+		name += "-" + hex.EncodeToString(sum[:4])
+	}
+	return name + ".json"
+}
+
+// canonicalJSON marshals the value with sorted keys and indentation, so that the same entity
+// always gives the same file
+func canonicalJSON(v interface{}) ([]byte, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var generic interface{}
+	if err := decoder.Decode(&generic); err != nil {
+		return nil, err
+	}
+	out, err := json.MarshalIndent(generic, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
+
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// writeMirror writes the context and one file per entity, removes the files of entities that
+// were pulled before but are gone now, and writes the manifest
+func writeMirror(dir string, dataset string, ctx *api.Entity, entities []*api.Entity, previous *mirrorManifest) (*mirrorManifest, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	manifest := &mirrorManifest{Dataset: dataset, Files: make(map[string]mirrorEntry)}
+
+	ctxData, err := canonicalJSON(ctx.Properties)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, mirrorContextFile), ctxData, 0644); err != nil {
+		return nil, err
+	}
+	manifest.Context = hashBytes(ctxData)
+
+	for _, e := range stripRecorded(entities) {
+		data, err := canonicalJSON(e)
+		if err != nil {
+			return nil, err
+		}
+		file := mirrorFileName(e.ID)
+		if other, ok := manifest.Files[file]; ok {
+			return nil, fmt.Errorf("entities %s and %s map to the same file %s", other.ID, e.ID, file)
+		}
+		if err := os.WriteFile(filepath.Join(dir, file), data, 0644); err != nil {
+			return nil, err
+		}
+		manifest.Files[file] = mirrorEntry{ID: e.ID, Hash: hashBytes(data)}
+	}
+
+	if previous != nil {
+		for file := range previous.Files {
+			if _, ok := manifest.Files[file]; !ok {
+				err := os.Remove(filepath.Join(dir, file))
+				if err != nil && !os.IsNotExist(err) {
+					return nil, err
+				}
+			}
+		}
+	}
+	return manifest, writeManifest(dir, manifest)
+}
+
+func readManifest(dir string) (*mirrorManifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, mirrorManifestFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	manifest := &mirrorManifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("could not read %s: %w", mirrorManifestFile, err)
+	}
+	if manifest.Files == nil {
+		manifest.Files = make(map[string]mirrorEntry)
+	}
+	return manifest, nil
+}
+
+func writeManifest(dir string, manifest *mirrorManifest) error {
+	data, err := canonicalJSON(manifest)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, mirrorManifestFile), data, 0644)
+}
+
+// localChanges compares the entity files in the directory with the manifest
+func localChanges(dir string, manifest *mirrorManifest) (*mirrorChanges, error) {
+	changes := &mirrorChanges{changed: make([]mirrorFile, 0), deleted: make([]mirrorFile, 0), moved: make([]mirrorFile, 0)}
+
+	ctxData, err := os.ReadFile(filepath.Join(dir, mirrorContextFile))
+	if err != nil {
+		return nil, err
+	}
+	changes.contextHash = hashBytes(ctxData)
+	changes.context = changes.contextHash != manifest.Context
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	// retired are entities whose id was edited in their file, so the old id must be deleted
+	retired := make([]mirrorFile, 0)
+	for _, path := range paths {
+		file := filepath.Base(path)
+		if file == mirrorContextFile || file == mirrorManifestFile {
+			continue
+		}
+		seen[file] = true
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		hash := hashBytes(data)
+		if known, ok := manifest.Files[file]; ok && known.Hash == hash {
+			continue
+		}
+		id, err := mirrorEntityID(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if known, ok := manifest.Files[file]; ok && known.ID != id {
+			retired = append(retired, mirrorFile{file: file, entry: known})
+		}
+		changes.changed = append(changes.changed, mirrorFile{file: file, entry: mirrorEntry{ID: id, Hash: hash}})
+	}
+
+	// an id that is still in a changed file must not be deleted, as the deletion would be stored
+	// after the entity
+	kept := make(map[string]bool)
+	for _, f := range changes.changed {
+		kept[f.entry.ID] = true
+	}
+	for file, entry := range manifest.Files {
+		if seen[file] {
+			continue
+		}
+		if kept[entry.ID] {
+			changes.moved = append(changes.moved, mirrorFile{file: file, entry: entry})
+		} else {
+			changes.deleted = append(changes.deleted, mirrorFile{file: file, entry: entry})
+		}
+	}
+	for _, f := range retired {
+		if !kept[f.entry.ID] {
+			changes.deleted = append(changes.deleted, f)
+		}
+	}
+	sort.Slice(changes.changed, func(i, j int) bool { return changes.changed[i].file < changes.changed[j].file })
+	sort.Slice(changes.deleted, func(i, j int) bool { return changes.deleted[i].file < changes.deleted[j].file })
+	sort.Slice(changes.moved, func(i, j int) bool { return changes.moved[i].file < changes.moved[j].file })
+	return changes, nil
+}
+
+func mirrorEntityID(data []byte) (string, error) {
+	var e struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(data, &e); err != nil {
+		return "", fmt.Errorf("not a valid entity: %w", err)
+	}
+	if e.ID == "" {
+		return "", fmt.Errorf("the entity has no id")
+	}
+	return e.ID, nil
+}
+
+// pushMirror posts the changed files as they are, and tombstones for the deleted files, with the
+// context of the directory in front of each batch
+func pushMirror(server string, token string, dataset string, dir string, changes *mirrorChanges) error {
+	ctxData, err := os.ReadFile(filepath.Join(dir, mirrorContextFile))
+	if err != nil {
+		return err
+	}
+	items := make([][]byte, 0, len(changes.changed)+len(changes.deleted))
+	for _, f := range changes.changed {
+		data, err := os.ReadFile(filepath.Join(dir, f.file))
+		if err != nil {
+			return err
+		}
+		items = append(items, bytes.TrimSpace(data))
+	}
+	for _, f := range changes.deleted {
+		e := api.NewEntity(f.entry.ID)
+		e.IsDeleted = true
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		items = append(items, data)
+	}
+	// a batch is posted even when only the context changed, so that the namespaces are stored
+	for start := 0; start == 0 || start < len(items); start += storeBatchSize {
+		end := start + storeBatchSize
+		if end > len(items) {
+			end = len(items)
+		}
+		buf := &bytes.Buffer{}
+		buf.WriteString("[")
+		buf.Write(bytes.TrimSpace(ctxData))
+		for _, item := range items[start:end] {
+			buf.WriteString(",")
+			buf.Write(item)
+		}
+		buf.WriteString("]")
+		_, err = web.PostRequest(server, token, "/datasets/"+dataset+"/entities", buf.Bytes())
+		if err != nil {
+			return fmt.Errorf("could not store entities in %s: %w", dataset, err)
+		}
+	}
+	return nil
+}
+
+func renderMirrorChanges(changes *mirrorChanges) {
+	if changes.empty() {
+		return
+	}
+	out := [][]string{{"Change", "File", "Entity"}}
+	if changes.context {
+		out = append(out, []string{"changed", mirrorContextFile, "@context"})
+	}
+	for _, f := range changes.changed {
+		out = append(out, []string{"changed", f.file, f.entry.ID})
+	}
+	for _, f := range changes.deleted {
+		out = append(out, []string{"deleted", f.file, f.entry.ID})
+	}
+	for _, f := range changes.moved {
+		out = append(out, []string{"moved", f.file, f.entry.ID})
+	}
+	pterm.DefaultTable.WithHasHeader().WithData(out).Render()
+	pterm.Println()
+}
@@ -0,0 +1,104 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datasets
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/franela/goblin"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+)
+
+func TestMirror(t *testing.T) {
+	g := goblin.Goblin(t)
+	g.Describe("dataset mirror directories", func() {
+		g.It("should give safe and stable file names", func() {
+			g.Assert(mirrorFileName("country-NO")).Equal("country-NO.json")
+			g.Assert(mirrorFileName("ns1:NO")).Equal(mirrorFileName("ns1:NO"))
+			g.Assert(mirrorFileName("ns1:NO") == mirrorFileName("ns1_NO")).IsFalse()
+			g.Assert(mirrorFileName("_context") == "_context.json").IsFalse()
+		})
+		g.It("should write json with sorted keys", func() {
+			e := api.NewEntity("ns1:NO")
+			e.Properties["ns1:name"] = "Norway"
+			e.Properties["ns1:code"] = "NO"
+			data, err := canonicalJSON(e)
+			g.Assert(err).IsNil()
+			g.Assert(string(data)).Equal("{\n  \"id\": \"ns1:NO\",\n  \"props\": {\n    \"ns1:code\": \"NO\",\n    \"ns1:name\": \"Norway\"\n  },\n  \"refs\": {}\n}\n")
+		})
+		g.It("should find changed, new and deleted files", func() {
+			dir := t.TempDir()
+			entities := []*api.Entity{api.NewEntity("ns1:NO"), api.NewEntity("ns1:SE"), api.NewEntity("ns1:DK")}
+			manifest, err := writeMirror(dir, "test.Country", api.NewContext(), entities, nil)
+			g.Assert(err).IsNil()
+			g.Assert(len(manifest.Files)).Equal(3)
+
+			changes, err := localChanges(dir, manifest)
+			g.Assert(err).IsNil()
+			g.Assert(changes.empty()).IsTrue()
+
+			g.Assert(os.WriteFile(filepath.Join(dir, mirrorFileName("ns1:NO")), []byte(`{"id":"ns1:NO","props":{"ns1:name":"Norge"},"refs":{}}`), 0644)).IsNil()
+			g.Assert(os.WriteFile(filepath.Join(dir, "fi.json"), []byte(`{"id":"ns1:FI","props":{},"refs":{}}`), 0644)).IsNil()
+			g.Assert(os.Remove(filepath.Join(dir, mirrorFileName("ns1:DK")))).IsNil()
+
+			changes, err = localChanges(dir, manifest)
+			g.Assert(err).IsNil()
+			g.Assert(changes.context).IsFalse()
+			g.Assert(len(changes.changed)).Equal(2)
+			g.Assert(changes.changed[0].entry.ID).Equal("ns1:FI")
+			g.Assert(changes.changed[1].entry.ID).Equal("ns1:NO")
+			g.Assert(len(changes.deleted)).Equal(1)
+			g.Assert(changes.deleted[0].entry.ID).Equal("ns1:DK")
+
+			manifest, err = writeMirror(dir, "test.Country", api.NewContext(), entities[:1], manifest)
+			g.Assert(err).IsNil()
+			_, err = os.Stat(filepath.Join(dir, mirrorFileName("ns1:SE")))
+			g.Assert(os.IsNotExist(err)).IsTrue()
+		})
+		g.It("should not delete entities that moved to another file", func() {
+			dir := t.TempDir()
+			entities := []*api.Entity{api.NewEntity("ns1:NO"), api.NewEntity("ns1:SE")}
+			manifest, err := writeMirror(dir, "test.Country", api.NewContext(), entities, nil)
+			g.Assert(err).IsNil()
+
+			g.Assert(os.Rename(filepath.Join(dir, mirrorFileName("ns1:NO")), filepath.Join(dir, "norway.json"))).IsNil()
+			changes, err := localChanges(dir, manifest)
+			g.Assert(err).IsNil()
+			g.Assert(len(changes.changed)).Equal(1)
+			g.Assert(changes.changed[0].entry.ID).Equal("ns1:NO")
+			g.Assert(len(changes.deleted)).Equal(0)
+			g.Assert(len(changes.moved)).Equal(1)
+			g.Assert(changes.moved[0].file).Equal(mirrorFileName("ns1:NO"))
+		})
+		g.It("should delete the old id when the id in a file is edited", func() {
+			dir := t.TempDir()
+			entities := []*api.Entity{api.NewEntity("ns1:NO"), api.NewEntity("ns1:SE")}
+			manifest, err := writeMirror(dir, "test.Country", api.NewContext(), entities, nil)
+			g.Assert(err).IsNil()
+
+			file := mirrorFileName("ns1:NO")
+			g.Assert(os.WriteFile(filepath.Join(dir, file), []byte(`{"id":"ns1:NOR","props":{},"refs":{}}`), 0644)).IsNil()
+			changes, err := localChanges(dir, manifest)
+			g.Assert(err).IsNil()
+			g.Assert(len(changes.changed)).Equal(1)
+			g.Assert(changes.changed[0].entry.ID).Equal("ns1:NOR")
+			g.Assert(len(changes.deleted)).Equal(1)
+			g.Assert(changes.deleted[0].entry.ID).Equal("ns1:NO")
+			g.Assert(changes.deleted[0].file).Equal(file)
+		})
+	})
+}
@@ -0,0 +1,71 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datasets
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+)
+
+// namespaceCompactor turns full URIs back into prefixed values, and builds the context for them.
+// Known namespaces keep their prefix, new namespaces get generated ns<n> prefixes.
+type namespaceCompactor struct {
+	prefixes   map[string]string
+	namespaces map[string]interface{}
+}
+
+func newNamespaceCompactor(known map[string]interface{}) *namespaceCompactor {
+	c := &namespaceCompactor{prefixes: make(map[string]string), namespaces: make(map[string]interface{})}
+	for prefix, ns := range known {
+		if uri, ok := ns.(string); ok {
+			c.prefixes[uri] = prefix
+			c.namespaces[prefix] = uri
+		}
+	}
+	return c
+}
+
+// compact returns the value with its namespace replaced by a prefix. Values that do not look like
+// a URI are returned as they are.
+func (c *namespaceCompactor) compact(value string) string {
+	i := strings.LastIndexAny(value, "/#")
+	if i < 0 || !strings.Contains(value, "://") {
+		return value
+	}
+	ns, local := value[:i+1], value[i+1:]
+	prefix, ok := c.prefixes[ns]
+	if !ok {
+		for n := len(c.namespaces); ; n++ {
+			prefix = fmt.Sprintf("ns%d", n)
+			if _, taken := c.namespaces[prefix]; !taken {
+				break
+			}
+		}
+		c.prefixes[ns] = prefix
+		c.namespaces[prefix] = ns
+	}
+	return prefix + ":" + local
+}
+
+// context returns a context entity with every namespace used so far
+func (c *namespaceCompactor) context() *api.Entity {
+	namespaces := make(map[string]interface{}, len(c.namespaces))
+	for k, v := range c.namespaces {
+		namespaces[k] = v
+	}
+	return api.NewContextWithNamespaces(namespaces)
+}
@@ -0,0 +1,127 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datasets
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mimiro-io/datahub-cli/internal/login"
+	"github.com/mimiro-io/datahub-cli/internal/utils"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+	"github.com/mimiro-io/datahub-cli/pkg/transform"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// PreviewVirtualCmd runs a virtual dataset transform locally against sample entities
+var PreviewVirtualCmd = &cobra.Command{
+	Use:   "preview-virtual",
+	Short: "Preview what a virtual dataset transform would return",
+	Long: `Run a virtual dataset transform locally against entities from a source dataset, and show what
+the virtual dataset would return. For example:
+mim dataset preview-virtual view.ts --source people.Person
+or
+mim dataset preview-virtual --file view.js --source people.Person --limit 50
+
+Queries done by the transform are run against the current server.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		format := utils.ResolveFormat(cmd)
+		if format != "term" { // turn of pterm output
+			pterm.DisableOutput()
+		}
+
+		server, token, err := login.ResolveCredentials()
+		utils.HandleError(err)
+
+		pterm.EnableDebugMessages()
+
+		file, err := cmd.Flags().GetString("file")
+		utils.HandleError(err)
+		if file == "" && len(args) > 0 {
+			file = args[0]
+		}
+		source, err := cmd.Flags().GetString("source")
+		utils.HandleError(err)
+		if file == "" || source == "" {
+			pterm.Warning.Println("You must provide a transform file and a source dataset")
+			pterm.Println()
+			os.Exit(1)
+		}
+
+		limit, err := cmd.Flags().GetInt("limit")
+		utils.HandleError(err)
+		timeout, err := cmd.Flags().GetDuration("timeout")
+		utils.HandleError(err)
+
+		code, err := os.ReadFile(file)
+		utils.HandleError(err)
+
+		pterm.DefaultSection.Println("Reading sample entities from " + server + fmt.Sprintf("/datasets/%s/entities", source))
+
+		em := api.NewEntityManager(server, token, context.Background(), api.Entities)
+		collector := &api.CollectorSink{}
+		err = em.Read(source, "", SaneLimit(format, limit), false, collector)
+		utils.HandleError(err)
+
+		pterm.Success.Printf("Read %d entities, running transform %s\n", len(collector.Entities), file)
+
+		result, err := transform.Run(context.Background(), string(code), collector.Entities, transform.Options{
+			HubURL:  server,
+			Bearer:  token,
+			Timeout: timeout,
+		})
+		utils.HandleError(err)
+
+		failed := false
+		for _, entry := range result.Logs {
+			switch entry.Level {
+			case "error":
+				failed = true
+				pterm.Error.Println(entry.Message)
+			case "warn":
+				pterm.Warning.Println(entry.Message)
+			default:
+				pterm.Info.Println(entry.Message)
+			}
+		}
+
+		pterm.DefaultSection.Printf("Virtual dataset returned %d entities in %dms", len(result.Entities), result.DurationMs)
+
+		s := outputSink(format)
+		s.Start()
+		err = s.ProcessEntities(result.Entities)
+		s.End()
+		utils.HandleError(err)
+
+		if failed {
+			os.Exit(1)
+		}
+	},
+	TraverseChildren: true,
+}
+
+func init() {
+	PreviewVirtualCmd.Flags().StringP("file", "f", "", "The .js or .ts transform defining the virtual dataset")
+	PreviewVirtualCmd.Flags().StringP("source", "s", "", "The dataset to read sample entities from")
+	PreviewVirtualCmd.Flags().Int("limit", 10, "Number of sample entities to run the transform on")
+	PreviewVirtualCmd.Flags().Duration("timeout", 30*time.Second, "Maximum time the transform may run")
+	_ = PreviewVirtualCmd.RegisterFlagCompletionFunc("source", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return api.GetDatasetsCompletion(toComplete), cobra.ShellCompDirectiveNoFileComp
+	})
+}
@@ -15,6 +15,9 @@
 package datasets
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"github.com/mimiro-io/datahub-cli/internal/login"
 	"github.com/mimiro-io/datahub-cli/pkg/api"
 	"os"
@@ -29,7 +32,17 @@ var RenameCmd = &cobra.Command{
 	Use:   "rename",
 	Short: "Rename dataset with given id with a new name",
 	Long: `Rename a dataset with given id with a new name, For example:
-mim dataset rename --name <name> --new-name <newName>
+mim dataset rename --name <name> --newName <newName>
+
+Several datasets can be renamed at once by giving a glob pattern or a regular expression as name.
+The new name is then a template, where {{.Name}} is the old name and {{index .Groups 1}} is the text
+matched by the first wildcard or regex group:
+mim dataset rename --name 'tmp.*' --newName 'archive.{{index .Groups 1}}' --dry-run
+mim dataset rename --regex --name '^test\.(.*)$' --newName 'old.test.{{index .Groups 1}}'
+
+With --update-jobs, all jobs that read from, write to or are triggered by the renamed datasets
+are updated to use the new names as well:
+mim dataset rename --name <name> --newName <newName> --update-jobs
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 
@@ -48,6 +61,15 @@ mim dataset rename --name <name> --new-name <newName>
 			os.Exit(1)
 		}
 
+		regex, err := cmd.Flags().GetBool("regex")
+		utils.HandleError(err)
+
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		utils.HandleError(err)
+
+		updateJobs, err := cmd.Flags().GetBool("update-jobs")
+		utils.HandleError(err)
+
 		confirm, err := cmd.Flags().GetBool("confirm")
 		utils.HandleError(err)
 
@@ -55,24 +77,100 @@ mim dataset rename --name <name> --new-name <newName>
 
 		dm := api.NewDatasetManager(server, token)
 
-		if confirm {
-			pterm.DefaultSection.Printf("Rename dataset with name %s to %s on %s, please type (y)es or (n)o and then press enter:", name, newName, server)
-			if utils.AskForConfirmation() {
-				err = dm.Rename(name, newName)
-				utils.HandleError(err)
+		selected, err := selectDatasets(dm, []string{name}, regex)
+		utils.HandleError(err)
+		datasets, err := dm.List()
+		utils.HandleError(err)
+		existing := make(map[string]bool)
+		for _, ds := range datasets {
+			existing[ds.Name] = true
+		}
+		renames, err := planRenames(selected, newName, existing)
+		utils.HandleError(err)
+
+		if len(renames) == 0 {
+			pterm.Warning.Println("No datasets matched " + name)
+			pterm.Println()
+			os.Exit(1)
+		}
 
-				pterm.Success.Println("Renamed dataset")
-				pterm.Println()
+		if len(renames) > 1 || dryRun {
+			pterm.DefaultSection.Printf("Renaming %d dataset(s) on %s", len(renames), server)
+			renderRenames(renames)
+		}
+
+		jm := api.NewJobManager(server, token)
+		jobUpdates := make([]jobUpdate, 0)
+		if updateJobs {
+			configs, err := jm.ListJobConfigs()
+			utils.HandleError(err)
+			jobUpdates, err = planJobUpdates(configs, renames)
+			utils.HandleError(err)
+			renderJobUpdates(jobUpdates)
+		}
+
+		if dryRun {
+			pterm.Info.Println("Dry run, nothing was renamed")
+			pterm.Println()
+			return
+		}
+
+		if confirm {
+			jobsTxt := ""
+			if len(jobUpdates) > 0 {
+				jobsTxt = fmt.Sprintf(" and update %d job(s)", len(jobUpdates))
+			}
+			if len(renames) == 1 {
+				pterm.DefaultSection.Printf("Rename dataset with name %s to %s%s on %s, please type (y)es or (n)o and then press enter:", renames[0].from, renames[0].to, jobsTxt, server)
 			} else {
+				pterm.DefaultSection.Printf("Rename these %d datasets%s on %s, please type (y)es or (n)o and then press enter:", len(renames), jobsTxt, server)
+			}
+			if !utils.AskForConfirmation() {
 				pterm.Println("Aborted!")
+				return
 			}
-		} else {
-			pterm.DefaultSection.Printf("Renaming dataset %s to %s on %s", name, newName, server)
-			err = dm.Rename(name, newName)
-			utils.HandleError(err)
+		} else if len(renames) == 1 {
+			pterm.DefaultSection.Printf("Renaming dataset %s to %s on %s", renames[0].from, renames[0].to, server)
+		}
 
-			pterm.Success.Println("Renamed dataset")
+		failed := false
+		renamed := make(map[string]string)
+		for _, r := range renames {
+			err = dm.Rename(r.from, r.to)
+			if len(renames) == 1 {
+				utils.HandleError(err)
+			}
+			if err != nil {
+				pterm.Error.Printf("Could not rename dataset %s: %s\n", r.from, err.Error())
+				failed = true
+				continue
+			}
+			renamed[r.from] = r.to
+			pterm.Success.Printf("Renamed dataset %s to %s\n", r.from, r.to)
+		}
+		if err := moveCatalogEntries(server, token, renamed); err != nil {
+			pterm.Warning.Printf("Could not move the metadata of the renamed datasets: %s\n", err.Error())
+		}
+		if failed {
+			if len(jobUpdates) > 0 {
+				pterm.Warning.Println("Not all datasets were renamed, so no jobs were updated")
+			}
 			pterm.Println()
+			os.Exit(1)
+		}
+
+		for _, u := range jobUpdates {
+			err = updateJobConfig(jm, u.after)
+			if err != nil {
+				pterm.Error.Printf("Could not update job %s: %s\n", jobConfigName(u.after), err.Error())
+				failed = true
+				continue
+			}
+			pterm.Success.Printf("Updated job %s\n", jobConfigName(u.after))
+		}
+		pterm.Println()
+		if failed {
+			os.Exit(1)
 		}
 	},
 	TraverseChildren: true,
@@ -88,4 +186,130 @@ func init() {
 	RenameCmd.Flags().StringP("name", "n", "", "The name of the dataset you want to rename")
 	RenameCmd.Flags().StringP("newName", "", "", "The new name for the dataset")
 	RenameCmd.Flags().BoolP("confirm", "C", true, "Default flag to ask for confirmation before rename")
+	RenameCmd.Flags().Bool("regex", false, "Treat the name as a regular expression matched against all datasets")
+	RenameCmd.Flags().Bool("dry-run", false, "Only list the renames that would be done")
+	RenameCmd.Flags().Bool("update-jobs", false, "Also update the jobs referring to the renamed datasets")
+}
+
+type datasetRename struct {
+	from string
+	to   string
+}
+
+// planRenames renders the new name of each selected dataset, and makes sure no two datasets get the same name
+// and that no dataset is renamed to a dataset that already exists
+func planRenames(selected []selectedDataset, newName string, existing map[string]bool) ([]datasetRename, error) {
+	renames := make([]datasetRename, 0)
+	targets := make(map[string]string)
+	for _, ds := range selected {
+		to, err := renderName(newName, ds)
+		if err != nil {
+			return nil, err
+		}
+		if to == "" {
+			return nil, fmt.Errorf("new name for %s is empty", ds.Name)
+		}
+		if other, ok := targets[to]; ok {
+			return nil, fmt.Errorf("both %s and %s would be renamed to %s", other, ds.Name, to)
+		}
+		targets[to] = ds.Name
+		if to == ds.Name {
+			continue
+		}
+		if existing[to] {
+			return nil, fmt.Errorf("%s can not be renamed to %s, as that dataset already exists", ds.Name, to)
+		}
+		renames = append(renames, datasetRename{from: ds.Name, to: to})
+	}
+	return renames, nil
+}
+
+func renderRenames(renames []datasetRename) {
+	out := make([][]string, 0)
+	out = append(out, []string{"Dataset", "New name"})
+	for _, r := range renames {
+		out = append(out, []string{r.from, r.to})
+	}
+	pterm.DefaultTable.WithHasHeader().WithData(out).Render()
+	pterm.Println()
+}
+
+// jobUpdate holds a job config as it is stored on the server, before and after the renames
+type jobUpdate struct {
+	before map[string]interface{}
+	after  map[string]interface{}
+}
+
+// planJobUpdates finds the jobs referring to any of the renamed datasets, and returns them with the new names applied.
+// Each reference is renamed once from its old name, so renaming a to b and b to c moves a job on a to b, not to c.
+func planJobUpdates(configs []map[string]interface{}, renames []datasetRename) ([]jobUpdate, error) {
+	names := make(map[string]string)
+	for _, r := range renames {
+		names[r.from] = r.to
+	}
+	updates := make([]jobUpdate, 0)
+	for _, before := range configs {
+		after, err := cloneJobConfig(before)
+		if err != nil {
+			return nil, err
+		}
+		if api.RenameConfigDatasets(after, names) {
+			updates = append(updates, jobUpdate{before: before, after: after})
+		}
+	}
+	return updates, nil
+}
+
+// cloneJobConfig returns a deep copy of a job config, keeping numbers as they are
+func cloneJobConfig(config map[string]interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	clone := make(map[string]interface{})
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err = decoder.Decode(&clone)
+	return clone, err
+}
+
+// updateJobConfig posts the whole job config back to the server
+func updateJobConfig(jm *api.JobManager, config map[string]interface{}) error {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	_, err = jm.AddJob(data)
+	return err
+}
+
+func renderJobUpdates(updates []jobUpdate) {
+	if len(updates) == 0 {
+		pterm.Info.Println("No jobs refer to the renamed datasets")
+		pterm.Println()
+		return
+	}
+	pterm.DefaultSection.Printf("Updating %d job(s)", len(updates))
+	for _, u := range updates {
+		lines, err := utils.DiffJSON(u.before, u.after)
+		utils.HandleError(err)
+		pterm.DefaultBasicText.WithStyle(pterm.NewStyle(pterm.Bold)).Println(jobConfigName(u.after))
+		utils.RenderDiff(lines, 2)
+		pterm.Println()
+	}
+}
+
+func jobName(job *api.Job) string {
+	if job.Title != "" {
+		return job.Title
+	}
+	return job.Id
+}
+
+func jobConfigName(config map[string]interface{}) string {
+	if title, ok := config["title"].(string); ok && title != "" {
+		return title
+	}
+	id, _ := config["id"].(string)
+	return id
 }
@@ -0,0 +1,322 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datasets
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mimiro-io/datahub-cli/internal/login"
+	"github.com/mimiro-io/datahub-cli/internal/utils"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// noStratum is the stratum of entities without the --by property or reference
+const noStratum = "(none)"
+
+// SampleCmd picks a random sample of entities from a dataset
+var SampleCmd = &cobra.Command{
+	Use:   "sample",
+	Short: "Pick a random sample of entities from a dataset",
+	Long: `Read all entities of a dataset, and pick a random sample of them. The sample is written as an
+entity file that can be loaded with dataset store, or used as test input for transforms.
+
+With --by, the sample is stratified by the value of a property or reference: each value gets a share
+of the sample in proportion to how common it is, and every value gets at least one entity if the
+sample is large enough. Use --seed to get the same sample again. For example:
+mim dataset sample people.Person --size 100 > sample.json
+or
+mim dataset sample people.Person --size 100 --by rdf:type --output sample.json
+or
+mim dataset sample people.Person --size 20 --by http://data.example.io/country --seed 42
+`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		server, token, err := login.ResolveCredentials()
+		utils.HandleError(err)
+
+		pterm.EnableDebugMessages()
+
+		name, err := cmd.Flags().GetString("name")
+		utils.HandleError(err)
+		if len(args) > 0 {
+			name = args[0]
+		}
+		size, err := cmd.Flags().GetInt("size")
+		utils.HandleError(err)
+		by, err := cmd.Flags().GetString("by")
+		utils.HandleError(err)
+		seed, err := cmd.Flags().GetInt64("seed")
+		utils.HandleError(err)
+		output, err := cmd.Flags().GetString("output")
+		utils.HandleError(err)
+
+		if name == "" {
+			pterm.Error.Println("You must provide a dataset name")
+			os.Exit(1)
+		}
+		if size < 1 {
+			pterm.Error.Println("The sample size must be at least 1")
+			os.Exit(1)
+		}
+		if !cmd.Flags().Changed("seed") {
+			seed = time.Now().UnixNano()
+		}
+		if output == "" {
+			pterm.DisableOutput()
+		}
+
+		pterm.DefaultSection.Printf("Sampling %d entities from %s", size, name)
+		s := newSampler(size, seed)
+		sink := &sampleSink{sampler: s, by: by}
+		em := api.NewEntityManager(server, token, context.Background(), api.Entities)
+		err = em.ReadAll(name, "", sink)
+		utils.HandleError(err)
+
+		ctx := sink.context
+		if ctx == nil {
+			ctx = api.NewContext()
+		}
+		sample, allocation := s.sample()
+
+		if output == "" {
+			err = writeSnapshot(os.Stdout, ctx, sample)
+			utils.HandleError(err)
+			return
+		}
+		err = writeSnapshotFile(output, ctx, sample)
+		utils.HandleError(err)
+
+		if by != "" {
+			out := [][]string{{by, "Entities", "Sampled"}}
+			for _, a := range allocation {
+				out = append(out, []string{a.stratum, fmt.Sprintf("%d", a.seen), fmt.Sprintf("%d", a.sampled)})
+			}
+			pterm.DefaultTable.WithHasHeader().WithData(out).Render()
+			pterm.Println()
+		}
+		pterm.Success.Printf("Wrote %d of %d entities to %s (seed %d)\n", len(sample), s.seen, output, seed)
+		pterm.Println()
+	},
+	TraverseChildren: true,
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) != 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return api.GetDatasetsCompletion(toComplete), cobra.ShellCompDirectiveNoFileComp
+	},
+}
+
+func init() {
+	SampleCmd.Flags().StringP("name", "n", "", "The dataset to sample")
+	SampleCmd.Flags().Int("size", 100, "The number of entities to sample")
+	SampleCmd.Flags().String("by", "", "Stratify the sample by this property or reference, like rdf:type")
+	SampleCmd.Flags().Int64("seed", 0, "The random seed, to get the same sample again")
+	SampleCmd.Flags().StringP("output", "o", "", "Write the sample to this file instead of stdout")
+}
+
+// sampleSink hands the entities to the sampler, with the stratum given by the --by key
+type sampleSink struct {
+	sampler *sampler
+	by      string
+	target  string
+	expand  func(string) string
+	context *api.Entity
+}
+
+func (s *sampleSink) Start() {
+	s.expand = api.ValueExpander(nil)
+	s.target = s.by
+}
+func (s *sampleSink) End() {}
+
+func (s *sampleSink) ProcessEntities(entities []*api.Entity) error {
+	for _, e := range entities {
+		switch e.ID {
+		case "@context":
+			s.context = e
+			if ns, ok := e.Properties["namespaces"].(map[string]interface{}); ok {
+				s.expand = api.ValueExpander(ns)
+				s.target = s.expand(s.by)
+			}
+		case "@continuation":
+		default:
+			if e.IsDeleted {
+				continue
+			}
+			s.sampler.add(s.stratum(e), e)
+		}
+	}
+	return nil
+}
+
+// stratum returns the value of the --by property or reference, matched either as written or
+// with the namespace prefixes of the dataset expanded
+func (s *sampleSink) stratum(e *api.Entity) string {
+	if s.by == "" {
+		return ""
+	}
+	for _, values := range []map[string]interface{}{e.Properties, e.References} {
+		for k, v := range values {
+			if k == s.by || s.expand(k) == s.target {
+				return stratumValue(v)
+			}
+		}
+	}
+	return noStratum
+}
+
+func stratumValue(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return noStratum
+	case string:
+		return val
+	case []interface{}:
+		items := make([]string, 0, len(val))
+		for _, item := range val {
+			items = append(items, fmt.Sprintf("%v", item))
+		}
+		sort.Strings(items)
+		return strings.Join(items, ", ")
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
+
+// reservoir keeps a uniform random sample of up to size entities from a stream
+type reservoir struct {
+	seen     int
+	entities []*api.Entity
+}
+
+// sampler keeps a reservoir per stratum. Each reservoir can hold the full sample size, as the
+// share of each stratum is only known when the whole dataset has been read.
+type sampler struct {
+	size   int
+	rng    *rand.Rand
+	seen   int
+	strata map[string]*reservoir
+}
+
+type stratumAllocation struct {
+	stratum string
+	seen    int
+	sampled int
+}
+
+func newSampler(size int, seed int64) *sampler {
+	return &sampler{
+		size:   size,
+		rng:    rand.New(rand.NewSource(seed)),
+		strata: make(map[string]*reservoir),
+	}
+}
+
+func (s *sampler) add(stratum string, e *api.Entity) {
+	s.seen++
+	r, ok := s.strata[stratum]
+	if !ok {
+		r = &reservoir{entities: make([]*api.Entity, 0)}
+		s.strata[stratum] = r
+	}
+	r.seen++
+	if len(r.entities) < s.size {
+		r.entities = append(r.entities, e)
+		return
+	}
+	if i := s.rng.Intn(r.seen); i < s.size {
+		r.entities[i] = e
+	}
+}
+
+// sample picks the entities of each stratum, and returns them in random order
+func (s *sampler) sample() ([]*api.Entity, []stratumAllocation) {
+	allocation := s.allocate()
+	out := make([]*api.Entity, 0, s.size)
+	for _, a := range allocation {
+		r := s.strata[a.stratum]
+		s.rng.Shuffle(len(r.entities), func(i, j int) {
+			r.entities[i], r.entities[j] = r.entities[j], r.entities[i]
+		})
+		out = append(out, r.entities[:a.sampled]...)
+	}
+	s.rng.Shuffle(len(out), func(i, j int) { out[i], out[j] = out[j], out[i] })
+	return out, allocation
+}
+
+// allocate shares the sample size between the strata in proportion to their size, using the
+// largest remainder. If there is room, strata that got nothing are then given one entity, taken
+// from the strata with the largest share.
+func (s *sampler) allocate() []stratumAllocation {
+	strata := make([]stratumAllocation, 0, len(s.strata))
+	for k, r := range s.strata {
+		strata = append(strata, stratumAllocation{stratum: k, seen: r.seen})
+	}
+	sort.Slice(strata, func(i, j int) bool {
+		if strata[i].seen != strata[j].seen {
+			return strata[i].seen > strata[j].seen
+		}
+		return strata[i].stratum < strata[j].stratum
+	})
+	if s.seen <= s.size {
+		for i := range strata {
+			strata[i].sampled = strata[i].seen
+		}
+		return strata
+	}
+
+	remainders := make([]float64, len(strata))
+	given := 0
+	for i := range strata {
+		share := float64(s.size) * float64(strata[i].seen) / float64(s.seen)
+		strata[i].sampled = int(share)
+		remainders[i] = share - float64(strata[i].sampled)
+		given += strata[i].sampled
+	}
+	order := make([]int, len(strata))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return remainders[order[a]] > remainders[order[b]] })
+	for _, i := range order[:s.size-given] {
+		strata[i].sampled++
+	}
+
+	if len(strata) > s.size {
+		return strata
+	}
+	for i := range strata {
+		if strata[i].sampled > 0 {
+			continue
+		}
+		largest := 0
+		for j := range strata {
+			if strata[j].sampled > strata[largest].sampled {
+				largest = j
+			}
+		}
+		strata[largest].sampled--
+		strata[i].sampled++
+	}
+	return strata
+}
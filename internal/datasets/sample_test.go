@@ -0,0 +1,86 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datasets
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/franela/goblin"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+)
+
+func TestSampler(t *testing.T) {
+	g := goblin.Goblin(t)
+	g.Describe("dataset sampling", func() {
+		fill := func(s *sampler, stratum string, n int) {
+			for i := 0; i < n; i++ {
+				s.add(stratum, api.NewEntity(fmt.Sprintf("%s-%d", stratum, i)))
+			}
+		}
+
+		g.It("should sample the requested number of distinct entities", func() {
+			s := newSampler(10, 1)
+			fill(s, "", 1000)
+			sample, _ := s.sample()
+			g.Assert(len(sample)).Equal(10)
+			ids := make(map[string]bool)
+			for _, e := range sample {
+				ids[e.ID] = true
+			}
+			g.Assert(len(ids)).Equal(10)
+		})
+		g.It("should give the same sample for the same seed", func() {
+			a, b := newSampler(5, 42), newSampler(5, 42)
+			fill(a, "", 100)
+			fill(b, "", 100)
+			sa, _ := a.sample()
+			sb, _ := b.sample()
+			g.Assert(sa).Equal(sb)
+		})
+		g.It("should return everything when the dataset is smaller than the sample", func() {
+			s := newSampler(10, 1)
+			fill(s, "a", 3)
+			sample, _ := s.sample()
+			g.Assert(len(sample)).Equal(3)
+		})
+		g.It("should allocate proportionally with at least one per stratum", func() {
+			s := newSampler(10, 1)
+			fill(s, "big", 900)
+			fill(s, "medium", 95)
+			fill(s, "rare", 5)
+			sample, allocation := s.sample()
+			g.Assert(len(sample)).Equal(10)
+			g.Assert(allocation).Equal([]stratumAllocation{
+				{stratum: "big", seen: 900, sampled: 8},
+				{stratum: "medium", seen: 95, sampled: 1},
+				{stratum: "rare", seen: 5, sampled: 1},
+			})
+		})
+		g.It("should read strata from prefixed or expanded keys", func() {
+			sink := &sampleSink{by: "rdf:type"}
+			sink.Start()
+			ctx := api.NewContextWithNamespaces(map[string]interface{}{
+				"ns1": "http://www.w3.org/1999/02/22-rdf-syntax-ns#",
+				"rdf": "http://www.w3.org/1999/02/22-rdf-syntax-ns#",
+			})
+			g.Assert(sink.ProcessEntities([]*api.Entity{ctx})).IsNil()
+			e := api.NewEntity("ns2:1")
+			e.References["ns1:type"] = "ns2:Person"
+			g.Assert(sink.stratum(e)).Equal("ns2:Person")
+			g.Assert(sink.stratum(api.NewEntity("ns2:2"))).Equal(noStratum)
+		})
+	})
+}
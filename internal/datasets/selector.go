@@ -0,0 +1,143 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datasets
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+	"github.com/pterm/pterm"
+)
+
+// selectedDataset is a dataset picked by a selector. Groups holds the full match followed by
+// the text matched by each glob wildcard or regex group, and can be used in name templates.
+type selectedDataset struct {
+	Name   string
+	Groups []string
+}
+
+// isGlob returns true if the selector contains glob wildcards
+func isGlob(selector string) bool {
+	return strings.ContainsAny(selector, "*?")
+}
+
+// globToRegexp converts a glob pattern into an anchored regular expression, where each
+// wildcard becomes a capture group. * matches any number of characters, ? exactly one.
+func globToRegexp(glob string) (*regexp.Regexp, error) {
+	var out strings.Builder
+	out.WriteString("^")
+	literal := strings.Builder{}
+	flush := func() {
+		out.WriteString(regexp.QuoteMeta(literal.String()))
+		literal.Reset()
+	}
+	for _, r := range glob {
+		switch r {
+		case '*':
+			flush()
+			out.WriteString("(.*)")
+		case '?':
+			flush()
+			out.WriteString("(.)")
+		default:
+			literal.WriteRune(r)
+		}
+	}
+	flush()
+	out.WriteString("$")
+	return regexp.Compile(out.String())
+}
+
+// selectDatasets resolves the selectors to datasets on the server. A selector is either a plain
+// dataset name, a glob pattern like tmp.*, or a regular expression when regex is set. Plain
+// names are passed through as they are, patterns are matched against the dataset list.
+func selectDatasets(dm *api.DatasetManager, selectors []string, regex bool) ([]selectedDataset, error) {
+	patterns := make([]*regexp.Regexp, 0)
+	selected := make([]selectedDataset, 0)
+	seen := make(map[string]bool)
+
+	for _, selector := range selectors {
+		if selector == "" {
+			continue
+		}
+		switch {
+		case regex:
+			re, err := regexp.Compile(selector)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regular expression '%s': %w", selector, err)
+			}
+			patterns = append(patterns, re)
+		case isGlob(selector):
+			re, err := globToRegexp(selector)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern '%s': %w", selector, err)
+			}
+			patterns = append(patterns, re)
+		default:
+			if !seen[selector] {
+				seen[selector] = true
+				selected = append(selected, selectedDataset{Name: selector, Groups: []string{selector}})
+			}
+		}
+	}
+
+	if len(patterns) == 0 {
+		return selected, nil
+	}
+
+	datasets, err := dm.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, ds := range datasets {
+		if seen[ds.Name] {
+			continue
+		}
+		for _, re := range patterns {
+			if groups := re.FindStringSubmatch(ds.Name); groups != nil {
+				seen[ds.Name] = true
+				selected = append(selected, selectedDataset{Name: ds.Name, Groups: groups})
+				break
+			}
+		}
+	}
+	return selected, nil
+}
+
+// renderName renders a new dataset name from a template, for example archive.{{.Name}} or
+// prod.{{index .Groups 1}}. Names without template actions are returned as they are.
+func renderName(nameTemplate string, ds selectedDataset) (string, error) {
+	t, err := template.New("name").Option("missingkey=error").Parse(nameTemplate)
+	if err != nil {
+		return "", fmt.Errorf("invalid name template '%s': %w", nameTemplate, err)
+	}
+	out := &bytes.Buffer{}
+	if err := t.Execute(out, ds); err != nil {
+		return "", fmt.Errorf("could not render new name for '%s': %w", ds.Name, err)
+	}
+	return out.String(), nil
+}
+
+func printSelection(selected []selectedDataset) {
+	items := make([]pterm.BulletListItem, 0)
+	for _, ds := range selected {
+		items = append(items, pterm.BulletListItem{Level: 0, Text: ds.Name})
+	}
+	_ = pterm.DefaultBulletList.WithItems(items).Render()
+}
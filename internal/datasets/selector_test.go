@@ -0,0 +1,72 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datasets
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+func TestDatasetSelector(t *testing.T) {
+	g := goblin.Goblin(t)
+	g.Describe("glob patterns", func() {
+		g.It("should match with a capture group per wildcard", func() {
+			re, err := globToRegexp("tmp.*")
+			g.Assert(err).IsNil()
+			g.Assert(re.FindStringSubmatch("tmp.people")).Equal([]string{"tmp.people", "people"})
+			g.Assert(re.MatchString("xtmp.people")).IsFalse()
+		})
+		g.It("should quote regex characters", func() {
+			re, err := globToRegexp("a+b.?")
+			g.Assert(err).IsNil()
+			g.Assert(re.MatchString("a+b.1")).IsTrue()
+			g.Assert(re.MatchString("aab.1")).IsFalse()
+		})
+	})
+	g.Describe("rename templates", func() {
+		g.It("should render names from groups", func() {
+			renames, err := planRenames([]selectedDataset{
+				{Name: "tmp.people", Groups: []string{"tmp.people", "people"}},
+				{Name: "tmp.places", Groups: []string{"tmp.places", "places"}},
+			}, "archive.{{index .Groups 1}}", map[string]bool{"tmp.people": true, "tmp.places": true})
+			g.Assert(err).IsNil()
+			g.Assert(renames).Equal([]datasetRename{
+				{from: "tmp.people", to: "archive.people"},
+				{from: "tmp.places", to: "archive.places"},
+			})
+		})
+		g.It("should refuse renaming two datasets to the same name", func() {
+			_, err := planRenames([]selectedDataset{
+				{Name: "tmp.people", Groups: []string{"tmp.people"}},
+				{Name: "tmp.places", Groups: []string{"tmp.places"}},
+			}, "archive", nil)
+			g.Assert(err == nil).IsFalse()
+		})
+		g.It("should refuse renaming to a dataset that already exists", func() {
+			_, err := planRenames([]selectedDataset{
+				{Name: "tmp.people", Groups: []string{"tmp.people", "people"}},
+			}, "archive.{{index .Groups 1}}", map[string]bool{"tmp.people": true, "archive.people": true})
+			g.Assert(err == nil).IsFalse()
+		})
+		g.It("should refuse renaming to a name that another renamed dataset has", func() {
+			_, err := planRenames([]selectedDataset{
+				{Name: "a", Groups: []string{"a"}},
+				{Name: "b", Groups: []string{"b"}},
+			}, `{{if eq .Name "a"}}b{{else}}c{{end}}`, map[string]bool{"a": true, "b": true})
+			g.Assert(err == nil).IsFalse()
+		})
+	})
+}
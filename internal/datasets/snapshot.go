@@ -0,0 +1,204 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datasets
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mimiro-io/datahub-cli/internal/web"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+)
+
+// storeBatchSize is the number of entities posted to the server in one request
+const storeBatchSize = 1000
+
+// changeLogSink hands each batch of changes to a callback, and keeps the context and the continuation token
+type changeLogSink struct {
+	context *api.Entity
+	token   string
+	count   int
+	process func(entities []*api.Entity) error
+}
+
+func (s *changeLogSink) Start() {}
+func (s *changeLogSink) End()   {}
+
+func (s *changeLogSink) ProcessEntities(entities []*api.Entity) error {
+	es := make([]*api.Entity, 0, len(entities))
+	for _, e := range entities {
+		switch e.ID {
+		case "@context":
+			s.context = e
+		case "@continuation":
+			if token, ok := e.Properties["token"].(string); ok {
+				s.token = token
+			}
+		default:
+			es = append(es, e)
+		}
+	}
+	s.count += len(es)
+	return s.process(es)
+}
+
+// readChangeLog streams the full change log of a dataset to process, following continuation
+// tokens until the server has no more changes. It returns the context of the dataset.
+func readChangeLog(server string, token string, dataset string, process func(entities []*api.Entity) error) (*api.Entity, error) {
+	em := api.NewEntityManager(server, token, context.Background(), api.Changes)
+	sink := &changeLogSink{process: process}
+	since := ""
+	for {
+		sink.count = 0
+		err := em.ReadAll(dataset, since, sink)
+		if err != nil {
+			return nil, err
+		}
+		if sink.count == 0 || sink.token == "" || sink.token == since {
+			break
+		}
+		since = sink.token
+	}
+	if sink.context == nil {
+		sink.context = api.NewContext()
+	}
+	return sink.context, nil
+}
+
+// expandingSink expands the namespace prefixes of each entity with the context of the dataset,
+// and hands the entities to a callback. Deleted entities are skipped unless includeDeleted is set.
+type expandingSink struct {
+	expand         func(string) string
+	process        func(e *api.Entity) error
+	includeDeleted bool
+}
+
+func (s *expandingSink) Start() {
+	s.expand = api.ValueExpander(nil)
+}
+func (s *expandingSink) End() {}
+
+func (s *expandingSink) ProcessEntities(entities []*api.Entity) error {
+	for _, e := range entities {
+		switch e.ID {
+		case "@context":
+			if ns, ok := e.Properties["namespaces"].(map[string]interface{}); ok {
+				s.expand = api.ValueExpander(ns)
+			}
+		case "@continuation":
+		default:
+			if e.IsDeleted && !s.includeDeleted {
+				continue
+			}
+			api.ExpandEntity(e, s.expand)
+			if err := s.process(e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readExpanded streams all entities of a dataset that are not deleted, with namespaces expanded
+func readExpanded(server string, token string, dataset string, process func(e *api.Entity) error) error {
+	em := api.NewEntityManager(server, token, context.Background(), api.Entities)
+	return em.ReadAll(dataset, "", &expandingSink{process: process})
+}
+
+// writeSnapshot writes the context and the entities as a json array, in the same format as dataset store reads
+func writeSnapshot(w io.Writer, ctx *api.Entity, entities []*api.Entity) error {
+	s := &api.RawSink{Out: w}
+	s.Start()
+	err := s.ProcessEntities(append([]*api.Entity{ctx}, stripRecorded(entities)...))
+	s.End()
+	return err
+}
+
+// writeSnapshotFile writes the context and the entities to a file
+func writeSnapshotFile(file string, ctx *api.Entity, entities []*api.Entity) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	w := bufio.NewWriter(f)
+	err = writeSnapshot(w, ctx, entities)
+	if err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// ensureNewDataset returns an error if the dataset already exists
+func ensureNewDataset(server string, token string, name string) error {
+	datasets, err := api.NewDatasetManager(server, token).List()
+	if err != nil {
+		return err
+	}
+	for _, ds := range datasets {
+		if ds.Name == name {
+			return fmt.Errorf("dataset %s already exists, choose a new dataset to store the entities in", name)
+		}
+	}
+	return nil
+}
+
+// storeSnapshot creates the dataset if needed, and stores the entities in it in batches
+func storeSnapshot(server string, token string, dataset string, ctx *api.Entity, entities []*api.Entity) error {
+	err := updateDataset(server, token, dataset, &CreateDatasetConfig{})
+	if err != nil {
+		return fmt.Errorf("could not create dataset %s: %w", dataset, err)
+	}
+	return storeBatches(server, token, dataset, ctx, entities)
+}
+
+// storeBatches stores the entities in an existing dataset in batches
+func storeBatches(server string, token string, dataset string, ctx *api.Entity, entities []*api.Entity) error {
+	for start := 0; start < len(entities); start += storeBatchSize {
+		end := start + storeBatchSize
+		if end > len(entities) {
+			end = len(entities)
+		}
+		buf := &bytes.Buffer{}
+		err := writeSnapshot(buf, ctx, entities[start:end])
+		if err != nil {
+			return err
+		}
+		_, err = web.PostRequest(server, token, "/datasets/"+dataset+"/entities", buf.Bytes())
+		if err != nil {
+			return fmt.Errorf("could not store entities in %s: %w", dataset, err)
+		}
+	}
+	return nil
+}
+
+// stripRecorded returns copies of the entities without the recorded timestamp, as that is set
+// by the server when the entities are stored
+func stripRecorded(entities []*api.Entity) []*api.Entity {
+	out := make([]*api.Entity, 0, len(entities))
+	for _, e := range entities {
+		c := *e
+		c.Recorded = 0
+		out = append(out, &c)
+	}
+	return out
+}
@@ -0,0 +1,232 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mimiro-io/datahub-cli/internal/login"
+	"github.com/mimiro-io/datahub-cli/internal/stats"
+	"github.com/mimiro-io/datahub-cli/internal/web"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+	"github.com/pterm/pterm"
+)
+
+// snapshot is the state of the hub as of the last refresh
+type snapshot struct {
+	server      string
+	up          bool
+	refreshed   time.Time
+	took        time.Duration
+	jobs        []api.JobOutputViewItem
+	running     []api.JobStatus
+	hasStats    bool
+	datasetRows map[string][7]int64
+}
+
+type exporter struct {
+	alias   string
+	mu      sync.RWMutex
+	current snapshot
+}
+
+// StartExporter serves the state of the hub behind the login alias as Prometheus metrics on /metrics,
+// refreshed from the hub on the given interval
+func StartExporter(alias string, port string, interval time.Duration) error {
+	x := &exporter{alias: alias}
+	x.refresh()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			x.refresh()
+		}
+	}()
+
+	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+	e.GET("/metrics", func(c echo.Context) error {
+		x.mu.RLock()
+		body := renderMetrics(x.current)
+		x.mu.RUnlock()
+		return c.Blob(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(body))
+	})
+	e.GET("/", func(c echo.Context) error {
+		return c.String(http.StatusOK, "mim exporter, see /metrics\n")
+	})
+	return e.Start(":" + port)
+}
+
+// refresh reads jobs, running jobs and statistics from the hub. When the jobs can not be read, the
+// previous values are kept and the hub is reported as down.
+func (x *exporter) refresh() {
+	started := time.Now()
+	next := snapshot{refreshed: started}
+
+	server, token, err := login.ResolveCredentialsFromAlias(x.alias)
+	if err == nil {
+		next.server = server
+		jm := api.NewJobManager(server, token)
+		next.jobs, err = jm.ListJobsWithHistory()
+		if err == nil {
+			next.running, err = jm.GetJobStatus("")
+		}
+	}
+	if err == nil {
+		body, statsErr := web.GetRequest(server, token, "/statistics")
+		if statsErr == nil {
+			next.datasetRows, statsErr = datasetRows(body)
+		}
+		if statsErr != nil {
+			pterm.Warning.Printf("Could not read statistics from %s: %s\n", server, statsErr)
+		}
+		next.hasStats = statsErr == nil
+	}
+	next.took = time.Since(started)
+	next.up = err == nil
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if err != nil {
+		pterm.Warning.Printf("Could not refresh from the hub: %s\n", err)
+		x.current.up = false
+		x.current.refreshed = next.refreshed
+		x.current.took = next.took
+		return
+	}
+	x.current = next
+}
+
+// datasetRows reads the statistics document, which holds nested maps that ToRows expects
+func datasetRows(body []byte) (rows map[string][7]int64, err error) {
+	result := make(map[string]any)
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("unexpected statistics format: %v", r)
+		}
+	}()
+	return stats.ToRows(result), nil
+}
+
+type metric struct {
+	name string
+	help string
+	rows []string
+}
+
+func (m *metric) add(value float64, labels ...string) {
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labels[i], escapeLabel(labels[i+1])))
+	}
+	row := m.name
+	if len(pairs) > 0 {
+		row += "{" + strings.Join(pairs, ",") + "}"
+	}
+	m.rows = append(m.rows, row+" "+strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+func flag(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// renderMetrics writes the snapshot in the Prometheus text format, with every metric as a gauge
+func renderMetrics(s snapshot) string {
+	up := &metric{name: "datahub_up", help: "Whether the last refresh could read the jobs from the hub"}
+	refreshed := &metric{name: "datahub_exporter_last_refresh_timestamp_seconds", help: "When the exporter last refreshed from the hub"}
+	took := &metric{name: "datahub_exporter_refresh_duration_seconds", help: "How long the last refresh took"}
+	up.add(flag(s.up), "server", s.server)
+	if !s.refreshed.IsZero() {
+		refreshed.add(float64(s.refreshed.Unix()))
+	}
+	took.add(s.took.Seconds())
+
+	duration := &metric{name: "datahub_job_last_duration_seconds", help: "How long the last run of the job took"}
+	processed := &metric{name: "datahub_job_last_processed", help: "The number of entities processed in the last run of the job"}
+	lastRun := &metric{name: "datahub_job_last_run_timestamp_seconds", help: "When the last run of the job started"}
+	lastError := &metric{name: "datahub_job_last_error", help: "Whether the last run of the job ended with an error"}
+	paused := &metric{name: "datahub_job_paused", help: "Whether the job is paused"}
+	running := &metric{name: "datahub_job_running", help: "Whether the job is running"}
+
+	isRunning := make(map[string]bool)
+	for _, r := range s.running {
+		isRunning[r.JobId] = true
+	}
+	jobs := append([]api.JobOutputViewItem{}, s.jobs...)
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Job.Id < jobs[j].Job.Id })
+	for _, item := range jobs {
+		labels := []string{"job", item.Job.Id, "title", item.Job.Title}
+		paused.add(flag(item.Job.Paused), labels...)
+		running.add(flag(isRunning[item.Job.Id]), labels...)
+		if h := item.History; h != nil {
+			duration.add(h.End.Sub(h.Start).Seconds(), labels...)
+			processed.add(float64(h.Processed), labels...)
+			lastRun.add(float64(h.Start.Unix()), labels...)
+			lastError.add(flag(h.LastError != ""), labels...)
+		}
+	}
+
+	changes := &metric{name: "datahub_dataset_changes", help: "The number of changes in the dataset"}
+	entities := &metric{name: "datahub_dataset_entities", help: "The number of entities in the dataset"}
+	refs := &metric{name: "datahub_dataset_refs", help: "The number of refs in the dataset"}
+	size := &metric{name: "datahub_dataset_size_bytes", help: "The storage used by the dataset"}
+	statsUp := &metric{name: "datahub_statistics_available", help: "Whether the last refresh could read the statistics from the hub"}
+	statsUp.add(flag(s.hasStats))
+	names := make([]string, 0, len(s.datasetRows))
+	for name := range s.datasetRows {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		row := s.datasetRows[name]
+		changes.add(float64(row[0]), "dataset", name)
+		entities.add(float64(row[1]), "dataset", name)
+		refs.add(float64(row[2]), "dataset", name)
+		size.add(float64(row[3]), "dataset", name, "kind", "keys")
+		size.add(float64(row[4]), "dataset", name, "kind", "values")
+		size.add(float64(row[5]), "dataset", name, "kind", "refs")
+	}
+
+	b := &strings.Builder{}
+	for _, m := range []*metric{up, refreshed, took, duration, processed, lastRun, lastError, paused, running, statsUp, changes, entities, refs, size} {
+		if len(m.rows) == 0 {
+			continue
+		}
+		fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s gauge\n", m.name, m.help, m.name)
+		for _, row := range m.rows {
+			b.WriteString(row + "\n")
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,70 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/franela/goblin"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+)
+
+func TestExporter(t *testing.T) {
+	g := goblin.Goblin(t)
+	g.Describe("metrics", func() {
+		start := time.Date(2026, 10, 1, 10, 0, 0, 0, time.UTC)
+		s := snapshot{
+			server:    "http://hub",
+			up:        true,
+			refreshed: start,
+			hasStats:  true,
+			jobs: []api.JobOutputViewItem{
+				{Job: api.Job{Id: "b", Title: `say "hi"`, Paused: true}},
+				{Job: api.Job{Id: "a", Title: "A"}, History: &api.JobHistory{Start: start, End: start.Add(90 * time.Second), Processed: 42, LastError: "boom"}},
+			},
+			running:     []api.JobStatus{{JobId: "a"}},
+			datasetRows: map[string][7]int64{"people": {12, 10, 3, 270, 4000, 30}},
+		}
+
+		g.It("should write jobs and datasets as gauges", func() {
+			out := renderMetrics(s)
+			for _, line := range []string{
+				`datahub_up{server="http://hub"} 1`,
+				"# TYPE datahub_job_last_duration_seconds gauge",
+				`datahub_job_last_duration_seconds{job="a",title="A"} 90`,
+				`datahub_job_last_processed{job="a",title="A"} 42`,
+				`datahub_job_last_error{job="a",title="A"} 1`,
+				`datahub_job_running{job="a",title="A"} 1`,
+				`datahub_job_paused{job="b",title="say \"hi\""} 1`,
+				`datahub_dataset_entities{dataset="people"} 10`,
+				`datahub_dataset_size_bytes{dataset="people",kind="values"} 4000`,
+			} {
+				g.Assert(strings.Contains(out, line+"\n")).IsTrue(line)
+			}
+			g.Assert(strings.Index(out, `job="a"`) < strings.Index(out, `job="b"`)).IsTrue()
+			g.Assert(strings.Contains(out, `datahub_job_last_processed{job="b"`)).IsFalse()
+		})
+
+		g.It("should read the statistics document", func() {
+			rows, err := datasetRows([]byte(`{"entity":{"DATASET_LATEST_ENTITIES":{"people":{"keys":10,"size-keys":100,"size-values":0}}}}`))
+			g.Assert(err).IsNil()
+			g.Assert(rows["people"][1]).Equal(int64(10))
+			_, err = datasetRows([]byte(`{"entity":{"DATASET_LATEST_ENTITIES":{"people":"oops"}}}`))
+			g.Assert(err == nil).IsFalse()
+		})
+	})
+}
@@ -0,0 +1,484 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mimiro-io/datahub-cli/internal/login"
+	"github.com/mimiro-io/datahub-cli/internal/transform"
+	"github.com/mimiro-io/datahub-cli/internal/utils"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// ApplyCmd makes the jobs on the server match the job configs in a directory
+var ApplyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Create, update or delete jobs to match a directory of job configs",
+	Long: `Read the job configs in a directory, and create or update the jobs on the server to match them.
+A job config x.json is paired with the transform x.ts or x.js next to it, which is compiled like in
+transform import. For example:
+mim jobs apply -d ./jobs
+or
+mim jobs apply -d ./jobs --dry-run
+
+The plan shows the jobs that will be created, updated or deleted, with a diff of the config and the
+transform of the jobs that change. Jobs on the server that have no config in the directory are only
+deleted with --prune. A job that is paused or resumed on the server keeps that state, unless its
+config sets paused.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		server, token, err := login.ResolveCredentials()
+		utils.HandleError(err)
+
+		pterm.EnableDebugMessages()
+
+		dir, err := cmd.Flags().GetString("dir")
+		utils.HandleError(err)
+		if dir == "" && len(args) > 0 {
+			dir = args[0]
+		}
+		if dir == "" {
+			pterm.Error.Println("You must provide a directory with job configs")
+			os.Exit(1)
+		}
+		prune, err := cmd.Flags().GetBool("prune")
+		utils.HandleError(err)
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		utils.HandleError(err)
+		confirm, err := cmd.Flags().GetBool("confirm")
+		utils.HandleError(err)
+
+		files, err := findJobFiles(dir)
+		utils.HandleError(err)
+		wanted, err := loadJobs(files)
+		utils.HandleError(err)
+
+		pterm.DefaultSection.Println("Planning jobs on " + server)
+		jm := api.NewJobManager(server, token)
+		current, err := jm.ListJobConfigs()
+		utils.HandleError(err)
+		plan := planJobs(current, wanted, prune)
+		renderJobPlan(plan)
+
+		pending := plan.pending()
+		if unmanaged := plan.unmanaged(); unmanaged > 0 {
+			pterm.Info.Printf("%d job(s) on the server have no config in %s, use --prune to delete them\n", unmanaged, dir)
+		}
+		if len(pending) == 0 {
+			pterm.Success.Println("Jobs are up to date")
+			pterm.Println()
+			return
+		}
+		if dryRun {
+			pterm.Println()
+			return
+		}
+
+		if confirm {
+			pterm.DefaultSection.Printf("Apply %d change(s) on %s, please type (y)es or (n)o and then press enter:", len(pending), server)
+			if !utils.AskForConfirmation() {
+				pterm.Println("Aborted!")
+				os.Exit(0)
+			}
+		}
+
+		failed := false
+		for _, step := range pending {
+			err := applyJobStep(jm, step)
+			if err != nil {
+				pterm.Error.Printf("Failed to %s job '%s': %s\n", step.action, step.title(), err.Error())
+				failed = true
+				continue
+			}
+			pterm.Success.Printf("Job '%s' has been %sd\n", step.title(), step.action)
+		}
+		pterm.Println()
+		if failed {
+			os.Exit(1)
+		}
+	},
+	TraverseChildren: true,
+}
+
+func init() {
+	ApplyCmd.Flags().StringP("dir", "d", "", "The directory with the job configs and transforms")
+	ApplyCmd.Flags().Bool("prune", false, "Delete jobs on the server that have no config in the directory")
+	ApplyCmd.Flags().Bool("dry-run", false, "Only show the plan, do not change anything")
+	ApplyCmd.Flags().BoolP("confirm", "C", true, "Default flag to ask for confirmation before applying")
+}
+
+const (
+	actionCreate    = "create"
+	actionUpdate    = "update"
+	actionDelete    = "delete"
+	actionUnchanged = "unchanged"
+	actionUnmanaged = "unmanaged"
+)
+
+// jobFile is a job config, and the transform next to it if there is one
+type jobFile struct {
+	config    string
+	transform string
+}
+
+// localJob is a job config read from a file. The config is kept as it was read, with only the
+// transform added, so that fields the Job type does not have are stored as well.
+type localJob struct {
+	job    *api.Job
+	config map[string]interface{}
+}
+
+// jobStep is a change to a job. The config is what is posted, and current is the config on the
+// server, both as they are stored so that fields the Job type does not have are compared as well.
+type jobStep struct {
+	action     string
+	config     map[string]interface{}
+	current    map[string]interface{}
+	changes    []string
+	configDiff []utils.DiffLine
+	codeDiff   []utils.DiffLine
+}
+
+func (s jobStep) id() string {
+	if s.config != nil {
+		return configString(s.config, "id")
+	}
+	return configString(s.current, "id")
+}
+
+func (s jobStep) title() string {
+	config := s.config
+	if config == nil {
+		config = s.current
+	}
+	if title := configString(config, "title"); title != "" {
+		return title
+	}
+	return configString(config, "id")
+}
+
+func configString(config map[string]interface{}, key string) string {
+	v, _ := config[key].(string)
+	return v
+}
+
+type jobPlan []jobStep
+
+func (p jobPlan) pending() []jobStep {
+	steps := make([]jobStep, 0)
+	for _, step := range p {
+		if step.action != actionUnchanged && step.action != actionUnmanaged {
+			steps = append(steps, step)
+		}
+	}
+	return steps
+}
+
+func (p jobPlan) unmanaged() int {
+	n := 0
+	for _, step := range p {
+		if step.action == actionUnmanaged {
+			n++
+		}
+	}
+	return n
+}
+
+// findJobFiles finds the json job configs in the directory and its sub directories, and pairs each
+// with a .ts or .js transform with the same name
+func findJobFiles(dir string) ([]jobFile, error) {
+	files := make([]jobFile, 0)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && (strings.HasPrefix(d.Name(), ".") || d.Name() == "node_modules") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) != ".json" || d.Name() == "package.json" || d.Name() == "tsconfig.json" {
+			return nil
+		}
+		f := jobFile{config: path}
+		base := strings.TrimSuffix(path, ".json")
+		for _, ext := range []string{".ts", ".js"} {
+			if _, err := os.Stat(base + ext); err == nil {
+				f.transform = base + ext
+				break
+			}
+		}
+		files = append(files, f)
+		return nil
+	})
+	return files, err
+}
+
+// loadJobs reads the job configs, and compiles their transforms
+func loadJobs(files []jobFile) ([]localJob, error) {
+	jobs := make([]localJob, 0, len(files))
+	seen := make(map[string]string)
+	for _, f := range files {
+		content, err := os.ReadFile(f.config)
+		if err != nil {
+			return nil, err
+		}
+		job := &api.Job{}
+		if err := json.Unmarshal(content, job); err != nil {
+			return nil, fmt.Errorf("could not parse %s: %w", f.config, err)
+		}
+		config := make(map[string]interface{})
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.UseNumber()
+		if err := decoder.Decode(&config); err != nil {
+			return nil, fmt.Errorf("could not parse %s: %w", f.config, err)
+		}
+		if job.Id == "" {
+			return nil, fmt.Errorf("the job in %s has no id", f.config)
+		}
+		if other, ok := seen[job.Id]; ok {
+			return nil, fmt.Errorf("job id '%s' is used in both %s and %s", job.Id, other, f.config)
+		}
+		seen[job.Id] = f.config
+
+		if f.transform != "" {
+			importer := transform.NewImporter(f.transform)
+			code, err := importer.Compile()
+			if err != nil {
+				return nil, fmt.Errorf("could not compile transform %s: %w", f.transform, err)
+			}
+			if job.Transform == nil {
+				job.Transform = make(map[string]interface{})
+			}
+			job.Transform["Type"] = "JavascriptTransform"
+			job.Transform["Code"] = importer.Encode(code)
+			tfr, ok := config["transform"].(map[string]interface{})
+			if !ok {
+				tfr = make(map[string]interface{})
+				config["transform"] = tfr
+			}
+			tfr["Type"] = "JavascriptTransform"
+			tfr["Code"] = importer.Encode(code)
+		}
+		jobs = append(jobs, localJob{job: job, config: config})
+	}
+	return jobs, nil
+}
+
+// planJobs compares the wanted job configs with the job configs on the server. A job whose config
+// does not set paused keeps the paused state it has on the server.
+func planJobs(current []map[string]interface{}, wanted []localJob, prune bool) jobPlan {
+	byId := make(map[string]map[string]interface{})
+	for _, c := range current {
+		byId[configString(c, "id")] = c
+	}
+
+	plan := make(jobPlan, 0)
+	managed := make(map[string]bool)
+	for _, w := range wanted {
+		managed[w.job.Id] = true
+		cur, ok := byId[w.job.Id]
+		if !ok {
+			plan = append(plan, jobStep{action: actionCreate, config: w.config})
+			continue
+		}
+
+		config := w.config
+		paused, known := cur["paused"]
+		if _, ok := config["paused"]; !ok && known {
+			config = make(map[string]interface{}, len(w.config)+1)
+			for k, v := range w.config {
+				config[k] = v
+			}
+			config["paused"] = paused
+		}
+		step := jobStep{action: actionUnchanged, config: config, current: cur, changes: make([]string, 0)}
+		configDiff, _ := utils.DiffJSON(withoutTransformCode(withoutEmptyFields(cur, config)), withoutTransformCode(config))
+		if utils.HasChanges(configDiff) {
+			step.changes = append(step.changes, "config")
+			step.configDiff = configDiff
+		}
+		codeDiff := diffCode(transformCode(cur), transformCode(config))
+		if utils.HasChanges(codeDiff) {
+			step.changes = append(step.changes, "transform")
+			step.codeDiff = codeDiff
+		}
+		if len(step.changes) > 0 {
+			step.action = actionUpdate
+		}
+		plan = append(plan, step)
+	}
+
+	removed := make([]jobStep, 0)
+	for _, c := range current {
+		if managed[configString(c, "id")] {
+			continue
+		}
+		action := actionUnmanaged
+		if prune {
+			action = actionDelete
+		}
+		removed = append(removed, jobStep{action: action, current: c})
+	}
+	sort.Slice(removed, func(i, j int) bool { return removed[i].title() < removed[j].title() })
+	return append(plan, removed...)
+}
+
+// withoutEmptyFields returns a copy of the config on the server without the empty fields the wanted
+// config leaves out, as the server fills in the fields a job config does not set
+func withoutEmptyFields(current, wanted map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(current))
+	for k, v := range current {
+		if _, ok := wanted[k]; !ok && isEmptyValue(v) {
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
+
+func isEmptyValue(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case bool:
+		return !v
+	case float64:
+		return v == 0
+	case json.Number:
+		f, err := v.Float64()
+		return err == nil && f == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	case []interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+// withoutTransformCode returns a copy of the config without the code of the transform, which is
+// diffed on its own
+func withoutTransformCode(config map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(config))
+	for k, v := range config {
+		out[k] = v
+	}
+	if tfr, ok := config["transform"].(map[string]interface{}); ok {
+		rest := make(map[string]interface{}, len(tfr))
+		for k, v := range tfr {
+			if k != "Code" {
+				rest[k] = v
+			}
+		}
+		out["transform"] = rest
+	}
+	return out
+}
+
+// transformCode returns the decoded transform of a job config, or an empty string if it has none
+func transformCode(config map[string]interface{}) string {
+	tfr, ok := config["transform"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	code, ok := tfr["Code"].(string)
+	if !ok {
+		return ""
+	}
+	out, err := base64.StdEncoding.DecodeString(code)
+	if err != nil {
+		return code
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// diffCode diffs two transforms, without the empty line of a missing transform
+func diffCode(before string, after string) []utils.DiffLine {
+	lines := make([]utils.DiffLine, 0)
+	for _, l := range utils.Diff(before, after) {
+		if l.Text == "" && (l.Op == "-" && before == "" || l.Op == "+" && after == "") {
+			continue
+		}
+		lines = append(lines, l)
+	}
+	return lines
+}
+
+func applyJobStep(jm *api.JobManager, step jobStep) error {
+	switch step.action {
+	case actionCreate, actionUpdate:
+		config, err := json.Marshal(step.config)
+		if err != nil {
+			return err
+		}
+		_, err = jm.AddJob(config)
+		return err
+	case actionDelete:
+		return jm.DeleteJob(step.id())
+	}
+	return nil
+}
+
+func renderJobPlan(plan jobPlan) {
+	out := make([][]string, 0)
+	out = append(out, []string{"Action", "Id", "Title", "Changes"})
+	for _, step := range plan {
+		action := step.action
+		switch step.action {
+		case actionCreate:
+			action = pterm.Green(action)
+		case actionUpdate:
+			action = pterm.Yellow(action)
+		case actionDelete:
+			action = pterm.Red(action)
+		default:
+			action = pterm.Gray(action)
+		}
+		out = append(out, []string{action, step.id(), step.title(), strings.Join(step.changes, ", ")})
+	}
+	pterm.DefaultTable.WithHasHeader().WithData(out).Render()
+	pterm.Println()
+
+	for _, step := range plan {
+		if step.action != actionUpdate {
+			continue
+		}
+		pterm.DefaultSection.Println("Changes to " + step.title())
+		if step.configDiff != nil {
+			utils.RenderDiff(step.configDiff, 2)
+		}
+		if step.codeDiff != nil {
+			if step.configDiff != nil {
+				pterm.Println()
+			}
+			utils.RenderDiff(step.codeDiff, 2)
+		}
+		pterm.Println()
+	}
+}
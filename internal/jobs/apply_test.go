@@ -0,0 +1,135 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/franela/goblin"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+)
+
+func TestApply(t *testing.T) {
+	g := goblin.Goblin(t)
+	g.Describe("job apply", func() {
+		code := func(js string) map[string]interface{} {
+			return map[string]interface{}{"Type": "JavascriptTransform", "Code": base64.StdEncoding.EncodeToString([]byte(js))}
+		}
+		jobs := []api.Job{
+			{Id: "a", Title: "A", Source: map[string]interface{}{"Type": "DatasetSource", "Name": "x"}},
+			{Id: "b", Title: "B", Transform: code("function transform_entities(entities) { return entities; }")},
+			{Id: "c", Title: "C"},
+			{Id: "p", Title: "P", Paused: true},
+		}
+		raw := func(job *api.Job) map[string]interface{} {
+			data, err := json.Marshal(job)
+			g.Assert(err).IsNil()
+			config := make(map[string]interface{})
+			g.Assert(json.Unmarshal(data, &config)).IsNil()
+			return config
+		}
+		current := make([]map[string]interface{}, 0, len(jobs))
+		for i := range jobs {
+			current = append(current, raw(&jobs[i]))
+		}
+		local := func(jobs ...*api.Job) []localJob {
+			out := make([]localJob, 0, len(jobs))
+			for _, job := range jobs {
+				out = append(out, localJob{job: job, config: raw(job)})
+			}
+			return out
+		}
+
+		g.It("should pair configs with transforms", func() {
+			dir := t.TempDir()
+			g.Assert(os.WriteFile(filepath.Join(dir, "a.json"), []byte(`{"id":"a"}`), 0644)).IsNil()
+			g.Assert(os.WriteFile(filepath.Join(dir, "a.ts"), []byte(``), 0644)).IsNil()
+			g.Assert(os.Mkdir(filepath.Join(dir, "sub"), 0755)).IsNil()
+			g.Assert(os.WriteFile(filepath.Join(dir, "sub", "b.json"), []byte(`{"id":"b"}`), 0644)).IsNil()
+			g.Assert(os.WriteFile(filepath.Join(dir, "package.json"), []byte(`{}`), 0644)).IsNil()
+
+			files, err := findJobFiles(dir)
+			g.Assert(err).IsNil()
+			g.Assert(len(files)).Equal(2)
+			g.Assert(files[0].transform).Equal(filepath.Join(dir, "a.ts"))
+			g.Assert(files[1].transform).Equal("")
+		})
+		g.It("should keep fields the job type does not have", func() {
+			dir := t.TempDir()
+			g.Assert(os.WriteFile(filepath.Join(dir, "a.json"), []byte(`{"id":"a","custom":{"batch":12}}`), 0644)).IsNil()
+			files, err := findJobFiles(dir)
+			g.Assert(err).IsNil()
+			jobs, err := loadJobs(files)
+			g.Assert(err).IsNil()
+			g.Assert(jobs[0].job.Id).Equal("a")
+			g.Assert(jobs[0].config["custom"]).Equal(map[string]interface{}{"batch": json.Number("12")})
+		})
+		g.It("should plan creates, updates and deletes", func() {
+			wanted := local(
+				&api.Job{Id: "a", Title: "A", Source: map[string]interface{}{"Type": "DatasetSource", "Name": "y"}},
+				&api.Job{Id: "b", Title: "B", Transform: code("function transform_entities(entities) { return []; }")},
+				&api.Job{Id: "d", Title: "D"},
+				&jobs[3],
+			)
+			plan := planJobs(current, wanted, false)
+			g.Assert(len(plan)).Equal(5)
+			g.Assert(plan[0].action).Equal(actionUpdate)
+			g.Assert(plan[0].changes).Equal([]string{"config"})
+			g.Assert(plan[1].action).Equal(actionUpdate)
+			g.Assert(plan[1].changes).Equal([]string{"transform"})
+			g.Assert(plan[2].action).Equal(actionCreate)
+			g.Assert(plan[3].action).Equal(actionUnchanged)
+			g.Assert(plan[4].action).Equal(actionUnmanaged)
+			g.Assert(len(plan.pending())).Equal(3)
+
+			plan = planJobs(current, wanted, true)
+			g.Assert(plan[4].action).Equal(actionDelete)
+			g.Assert(plan[4].id()).Equal("c")
+		})
+		g.It("should leave matching jobs unchanged", func() {
+			wanted := local(&jobs[0], &jobs[1], &jobs[2], &jobs[3])
+			g.Assert(len(planJobs(current, wanted, true).pending())).Equal(0)
+		})
+		g.It("should only change paused when the config sets it", func() {
+			wanted := []localJob{{job: &api.Job{Id: "p", Title: "P"}, config: map[string]interface{}{"id": "p", "title": "P"}}}
+			plan := planJobs(current[3:], wanted, false)
+			g.Assert(plan[0].action).Equal(actionUnchanged)
+			g.Assert(plan[0].config["paused"]).Equal(true)
+			g.Assert(wanted[0].config["paused"] == nil).IsTrue()
+
+			wanted[0].config["paused"] = false
+			plan = planJobs(current[3:], wanted, false)
+			g.Assert(plan[0].action).Equal(actionUpdate)
+			g.Assert(plan[0].changes).Equal([]string{"config"})
+		})
+		g.It("should update a job when only a field the job type does not have differs", func() {
+			server := raw(&jobs[0])
+			server["custom"] = map[string]interface{}{"batch": json.Number("10")}
+			wanted := local(&jobs[0])
+			wanted[0].config["custom"] = map[string]interface{}{"batch": json.Number("12")}
+			plan := planJobs([]map[string]interface{}{server}, wanted, false)
+			g.Assert(plan[0].action).Equal(actionUpdate)
+			g.Assert(plan[0].changes).Equal([]string{"config"})
+
+			wanted[0].config["custom"] = map[string]interface{}{"batch": json.Number("10")}
+			plan = planJobs([]map[string]interface{}{server}, wanted, false)
+			g.Assert(plan[0].action).Equal(actionUnchanged)
+		})
+	})
+}
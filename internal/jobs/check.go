@@ -0,0 +1,319 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/mimiro-io/datahub-cli/internal/utils"
+	"github.com/mimiro-io/datahub-cli/internal/web"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"github.com/tidwall/pretty"
+)
+
+// CheckCmd checks that jobs are healthy, for use in monitoring and CI
+var CheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check that jobs run on time and without errors",
+	Long: `Check the jobs on the server, and exit with 2 if any of them fail a check, so it can be used as a
+Nagios check or a gate in CI. A job fails when its last run ended with an error, when it has not run
+on time for its cron schedule, or when it is paused and has not run for longer than --max-paused.
+For example:
+mim jobs check
+or
+mim jobs check --filter "tags=crm" --grace 30m
+or
+mim jobs check --junit report.xml
+
+A cron job is late when its next run after the last one should have started more than --grace ago,
+which is one period of the schedule when not given. With --max-age, every job must also have run
+within that time, which covers jobs with only onchange triggers. The filters are the same as in
+jobs list.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		format := utils.ResolveFormat(cmd)
+		junit, err := cmd.Flags().GetString("junit")
+		utils.HandleError(err)
+		if format != "term" || junit == "-" {
+			pterm.DisableOutput()
+		}
+
+		server := web.GetServer()
+
+		pterm.EnableDebugMessages()
+
+		filter, err := cmd.Flags().GetString("filter")
+		utils.HandleError(err)
+		filterMode, err := cmd.Flags().GetString("filterMode")
+		utils.HandleError(err)
+		opts := checkOptions{}
+		opts.grace, err = cmd.Flags().GetDuration("grace")
+		utils.HandleError(err)
+		opts.maxAge, err = cmd.Flags().GetDuration("max-age")
+		utils.HandleError(err)
+		opts.maxPaused, err = cmd.Flags().GetDuration("max-paused")
+		utils.HandleError(err)
+
+		client, err := web.NewClient(server)
+		utils.HandleError(err)
+		jobsRaw, err := client.GetRaw("/jobs")
+		utils.HandleError(err)
+		historyRaw, err := client.GetRaw("/jobs/_/history")
+		utils.HandleError(err)
+		statusRaw, err := client.GetRaw("/jobs/_/status")
+		utils.HandleError(err)
+
+		jobs, err := listJobs(jobsRaw, historyRaw)
+		utils.HandleError(err)
+		if filter != "" {
+			jobs, err = filterJobs(jobs, filter, filterMode)
+			utils.HandleError(err)
+		}
+		status := make([]api.JobStatus, 0)
+		err = json.Unmarshal(statusRaw, &status)
+		utils.HandleError(err)
+		opts.running = make(map[string]bool)
+		for _, s := range status {
+			opts.running[s.JobId] = true
+		}
+
+		now := time.Now()
+		results := checkJobs(jobs, opts, now)
+		failed := failedJobs(results)
+
+		if junit != "" {
+			out := os.Stdout
+			if junit != "-" {
+				out, err = os.Create(junit)
+				utils.HandleError(err)
+			}
+			err = writeJUnit(out, results, now)
+			utils.HandleError(err)
+			if junit != "-" {
+				utils.HandleError(out.Close())
+			}
+		}
+
+		switch {
+		case junit == "-":
+		case format != "term":
+			out, err := json.Marshal(checkReport{Jobs: len(jobs), Failed: failed, Results: results})
+			utils.HandleError(err)
+			if format == "pretty" {
+				out = pretty.Color(pretty.Pretty(out), nil)
+			}
+			fmt.Println(string(out))
+		default:
+			renderCheck(results, len(jobs), failed)
+		}
+
+		if failed > 0 {
+			os.Exit(2)
+		}
+	},
+	TraverseChildren: true,
+}
+
+func init() {
+	CheckCmd.Flags().String("filter", "", "Only check jobs matching a filter query, like in jobs list")
+	CheckCmd.Flags().String("filterMode", "exclusive", "Filter mode used by the filter flag, exclusive or inclusive")
+	CheckCmd.Flags().Duration("grace", 0, "How late a cron job may be before it fails, one period of its schedule by default")
+	CheckCmd.Flags().Duration("max-age", 0, "Fail jobs that have not run within this time, like 24h")
+	CheckCmd.Flags().Duration("max-paused", 24*time.Hour, "Fail paused jobs that have not run within this time, 0 fails all paused jobs")
+	CheckCmd.Flags().String("junit", "", "Write the results as a JUnit XML report to this file, or - for stdout")
+}
+
+const (
+	checkError    = "error"
+	checkSchedule = "schedule"
+	checkPaused   = "paused"
+)
+
+type checkOptions struct {
+	grace     time.Duration
+	maxAge    time.Duration
+	maxPaused time.Duration
+	running   map[string]bool
+}
+
+type checkResult struct {
+	Job     string `json:"job"`
+	Title   string `json:"title"`
+	Check   string `json:"check"`
+	Passed  bool   `json:"passed"`
+	Message string `json:"message,omitempty"`
+}
+
+type checkReport struct {
+	Jobs    int           `json:"jobs"`
+	Failed  int           `json:"failed"`
+	Results []checkResult `json:"results"`
+}
+
+// checkJobs runs the error, schedule and paused checks on each job
+func checkJobs(jobs []api.JobOutput, opts checkOptions, now time.Time) []checkResult {
+	results := make([]checkResult, 0, len(jobs)*3)
+	for _, o := range jobs {
+		job, history := o.Job, o.History
+		result := func(check string, message string) checkResult {
+			return checkResult{Job: job.Id, Title: job.Title, Check: check, Passed: message == "", Message: message}
+		}
+
+		message := ""
+		if history != nil && history.LastError != "" {
+			message = "last run failed: " + truncateError(history.LastError, 200)
+		}
+		results = append(results, result(checkError, message))
+
+		message = ""
+		if !job.Paused && !opts.running[job.Id] {
+			message = lateMessage(job, history, opts, now)
+		}
+		results = append(results, result(checkSchedule, message))
+
+		message = ""
+		if job.Paused {
+			switch {
+			case opts.maxPaused == 0:
+				message = "job is paused"
+			case history == nil:
+				message = "job is paused and has never run"
+			case now.Sub(history.End) > opts.maxPaused:
+				message = fmt.Sprintf("job is paused and has not run since %s", utils.Date(history.End))
+			}
+		}
+		results = append(results, result(checkPaused, message))
+	}
+	return results
+}
+
+// lateMessage explains why a job has not run on time, or returns an empty string if it has
+func lateMessage(job api.Job, history *api.JobHistory, opts checkOptions, now time.Time) string {
+	if opts.maxAge > 0 {
+		if history == nil {
+			return "job has never run"
+		}
+		if now.Sub(history.End) > opts.maxAge {
+			return fmt.Sprintf("job has not run since %s", utils.Date(history.End))
+		}
+	}
+
+	var expected, following time.Time
+	for _, t := range job.Triggers {
+		if t.TriggerType != api.TriggerCron {
+			continue
+		}
+		schedule, err := api.ParseSchedule(t.Schedule)
+		if err != nil {
+			return fmt.Sprintf("invalid schedule '%s': %s", t.Schedule, err)
+		}
+		if history == nil {
+			return "job has a schedule but has never run"
+		}
+		next := schedule.Next(history.Start)
+		if !next.IsZero() && (expected.IsZero() || next.Before(expected)) {
+			expected, following = next, schedule.Next(next)
+		}
+	}
+	if expected.IsZero() {
+		return ""
+	}
+	grace := opts.grace
+	if grace == 0 {
+		grace = following.Sub(expected)
+	}
+	if now.After(expected.Add(grace)) {
+		return fmt.Sprintf("job should have run at %s, last run started %s", utils.Date(expected), utils.Date(history.Start))
+	}
+	return ""
+}
+
+func failedJobs(results []checkResult) int {
+	failed := make(map[string]bool)
+	for _, r := range results {
+		if !r.Passed {
+			failed[r.Job] = true
+		}
+	}
+	return len(failed)
+}
+
+func renderCheck(results []checkResult, jobs int, failed int) {
+	if failed == 0 {
+		fmt.Printf("OK - %d job(s) passed all checks\n", jobs)
+		return
+	}
+	fmt.Printf("CRITICAL - %d of %d job(s) failed checks\n", failed, jobs)
+	pterm.Println()
+	out := [][]string{{"Id", "Title", "Check", "Problem"}}
+	for _, r := range results {
+		if !r.Passed {
+			out = append(out, []string{r.Job, r.Title, pterm.Red(r.Check), r.Message})
+		}
+	}
+	pterm.DefaultTable.WithHasHeader().WithData(out).Render()
+	pterm.Println()
+}
+
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name      string      `xml:"name,attr"`
+	Tests     int         `xml:"tests,attr"`
+	Failures  int         `xml:"failures,attr"`
+	Timestamp string      `xml:"timestamp,attr"`
+	Cases     []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnit writes a test case for each check of each job, with the job id as the class name
+func writeJUnit(w io.Writer, results []checkResult, now time.Time) error {
+	suite := junitSuite{Name: "mim jobs check", Tests: len(results), Timestamp: now.UTC().Format("2006-01-02T15:04:05")}
+	for _, r := range results {
+		c := junitCase{ClassName: r.Job, Name: r.Check}
+		if !r.Passed {
+			suite.Failures++
+			c.Failure = &junitFailure{Message: r.Message, Type: r.Check, Text: r.Title + ": " + r.Message}
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+	out, err := xml.MarshalIndent(junitSuites{Suites: []junitSuite{suite}}, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s%s\n", xml.Header, out)
+	return err
+}
@@ -0,0 +1,78 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/franela/goblin"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+)
+
+func TestCheck(t *testing.T) {
+	g := goblin.Goblin(t)
+	g.Describe("jobs check", func() {
+		now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+		ran := func(ago time.Duration, lastError string) *api.JobHistory {
+			return &api.JobHistory{Start: now.Add(-ago), End: now.Add(-ago + time.Minute), LastError: lastError}
+		}
+		hourly := []api.JobTrigger{{TriggerType: api.TriggerCron, Schedule: "0 * * * *"}}
+		failedChecks := func(results []checkResult) []string {
+			out := make([]string, 0)
+			for _, r := range results {
+				if !r.Passed {
+					out = append(out, r.Job+" "+r.Check)
+				}
+			}
+			return out
+		}
+
+		g.It("should fail jobs with errors, late schedules and long pauses", func() {
+			jobs := []api.JobOutput{
+				{Job: api.Job{Id: "ok", Triggers: hourly}, History: ran(30*time.Minute, "")},
+				{Job: api.Job{Id: "broken", Triggers: hourly}, History: ran(30*time.Minute, "boom")},
+				{Job: api.Job{Id: "late", Triggers: hourly}, History: ran(3*time.Hour, "")},
+				{Job: api.Job{Id: "never", Triggers: hourly}},
+				{Job: api.Job{Id: "running", Triggers: hourly}, History: ran(3*time.Hour, "")},
+				{Job: api.Job{Id: "paused", Triggers: hourly, Paused: true}, History: ran(48*time.Hour, "")},
+				{Job: api.Job{Id: "onchange"}, History: ran(48*time.Hour, "")},
+			}
+			opts := checkOptions{maxPaused: 24 * time.Hour, running: map[string]bool{"running": true}}
+			results := checkJobs(jobs, opts, now)
+			g.Assert(failedChecks(results)).Equal([]string{"broken error", "late schedule", "never schedule", "paused paused"})
+			g.Assert(failedJobs(results)).Equal(4)
+		})
+
+		g.It("should use the grace and max age when given", func() {
+			jobs := []api.JobOutput{
+				{Job: api.Job{Id: "late", Triggers: hourly}, History: ran(3*time.Hour, "")},
+				{Job: api.Job{Id: "onchange"}, History: ran(48*time.Hour, "")},
+			}
+			g.Assert(failedChecks(checkJobs(jobs, checkOptions{grace: 4 * time.Hour}, now))).Equal([]string{})
+			g.Assert(failedChecks(checkJobs(jobs, checkOptions{grace: 4 * time.Hour, maxAge: 24 * time.Hour}, now))).Equal([]string{"onchange schedule"})
+		})
+
+		g.It("should write a JUnit report", func() {
+			out := &bytes.Buffer{}
+			results := []checkResult{{Job: "a", Check: checkError, Passed: true}, {Job: "b", Check: checkError, Message: "last run failed: boom"}}
+			g.Assert(writeJUnit(out, results, now)).IsNil()
+			g.Assert(strings.Contains(out.String(), `<testsuite name="mim jobs check" tests="2" failures="1"`)).IsTrue()
+			g.Assert(strings.Contains(out.String(), `<failure message="last run failed: boom" type="error">`)).IsTrue()
+		})
+	})
+}
@@ -0,0 +1,222 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mimiro-io/datahub-cli/internal/transform"
+	"github.com/mimiro-io/datahub-cli/internal/utils"
+	"github.com/mimiro-io/datahub-cli/internal/web"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// ExportCmd writes job configs and their transforms to a directory
+var ExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export job configs and transforms to a directory",
+	Long: `Export jobs to a directory, with the config of each job in <id>.json and its transform in <id>.js.
+The transform code is left out of the config, and is written like in transform export, so the
+directory can be kept in version control and deployed again with jobs apply. For example:
+mim jobs export --all -o ./jobs
+or
+mim jobs export --filter "tags=crm" -o ./jobs
+or
+mim jobs export job-one job-two -o ./jobs
+
+The filters are the same as in jobs list.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		server := web.GetServer()
+
+		pterm.EnableDebugMessages()
+
+		dir, err := cmd.Flags().GetString("output")
+		utils.HandleError(err)
+		all, err := cmd.Flags().GetBool("all")
+		utils.HandleError(err)
+		filter, err := cmd.Flags().GetString("filter")
+		utils.HandleError(err)
+		filterMode, err := cmd.Flags().GetString("filterMode")
+		utils.HandleError(err)
+
+		if dir == "" {
+			pterm.Error.Println("You must provide a directory to export to with --output")
+			os.Exit(1)
+		}
+		if !all && filter == "" && len(args) == 0 {
+			pterm.Error.Println("You must provide the jobs to export, a --filter, or --all")
+			os.Exit(1)
+		}
+
+		client, err := web.NewClient(server)
+		utils.HandleError(err)
+		jobs, err := client.GetRaw("/jobs")
+		utils.HandleError(err)
+		history, err := client.GetRaw("/jobs/_/history")
+		utils.HandleError(err)
+
+		output, err := listJobs(jobs, history)
+		utils.HandleError(err)
+		if filter != "" {
+			output, err = filterJobs(output, filter, filterMode)
+			utils.HandleError(err)
+		}
+		if len(args) > 0 {
+			output = selectJobs(output, args)
+		}
+		if len(output) == 0 {
+			pterm.Warning.Println("No jobs matched")
+			pterm.Println()
+			return
+		}
+
+		configs, err := api.ParseJobConfigs(jobs)
+		utils.HandleError(err)
+		byId := make(map[string]map[string]interface{}, len(configs))
+		for _, c := range configs {
+			byId[configString(c, "id")] = c
+		}
+		ids := make([]string, 0, len(output))
+		for _, o := range output {
+			ids = append(ids, o.Job.Id)
+		}
+		names, err := jobFileNames(ids)
+		utils.HandleError(err)
+
+		pterm.DefaultSection.Printf("Exporting %d job(s) from %s to %s", len(output), server, dir)
+		err = os.MkdirAll(dir, os.ModePerm)
+		utils.HandleError(err)
+
+		out := [][]string{{"Id", "Title", "Config", "Transform"}}
+		for _, o := range output {
+			files, err := exportJob(dir, names[o.Job.Id], byId[o.Job.Id])
+			utils.HandleError(err)
+			out = append(out, []string{o.Job.Id, o.Job.Title, files[0], files[1]})
+		}
+		pterm.DefaultTable.WithHasHeader().WithData(out).Render()
+		pterm.Println()
+		pterm.Success.Printf("Exported %d job(s) to %s\n", len(output), dir)
+		pterm.Println()
+	},
+	TraverseChildren: true,
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return api.GetJobsCompletion(toComplete), cobra.ShellCompDirectiveNoFileComp
+	},
+}
+
+func init() {
+	ExportCmd.Flags().StringP("output", "o", "", "The directory to write the jobs to")
+	ExportCmd.Flags().Bool("all", false, "Export all jobs")
+	ExportCmd.Flags().String("filter", "", "Only export jobs matching a filter query, like in jobs list")
+	ExportCmd.Flags().String("filterMode", "exclusive", "Filter mode used by the filter flag, exclusive or inclusive")
+}
+
+// selectJobs keeps the jobs with one of the given ids or titles
+func selectJobs(jobs []api.JobOutput, idsOrTitles []string) []api.JobOutput {
+	out := make([]api.JobOutput, 0)
+	for _, o := range jobs {
+		for _, s := range idsOrTitles {
+			if o.Job.Id == s || o.Job.Title == s {
+				out = append(out, o)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// exportJob writes the job config as it is stored on the server to name.json. If the job has a
+// transform, it is written to name.js, and its code and type are left out of the config. It returns
+// the names of the files written, with an empty name if the job has no transform.
+func exportJob(dir string, name string, config map[string]interface{}) ([2]string, error) {
+	var files [2]string
+	tfr, _ := config["transform"].(map[string]interface{})
+	js, err := transform.DecodeTransform(&api.Job{Transform: tfr})
+	if err != nil {
+		return files, fmt.Errorf("could not decode the transform of %s: %w", configString(config, "id"), err)
+	}
+
+	if js != "" {
+		rest := make(map[string]interface{}, len(tfr))
+		for k, v := range tfr {
+			if k != "Code" && k != "Type" {
+				rest[k] = v
+			}
+		}
+		stripped := make(map[string]interface{}, len(config))
+		for k, v := range config {
+			stripped[k] = v
+		}
+		delete(stripped, "transform")
+		if len(rest) > 0 {
+			stripped["transform"] = rest
+		}
+		config = stripped
+	}
+	var data bytes.Buffer
+	encoder := json.NewEncoder(&data)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(config); err != nil {
+		return files, err
+	}
+
+	files[0] = name + ".json"
+	if err := os.WriteFile(filepath.Join(dir, files[0]), data.Bytes(), 0644); err != nil {
+		return files, err
+	}
+	if js != "" {
+		files[1] = name + ".js"
+		if err := os.WriteFile(filepath.Join(dir, files[1]), []byte(strings.TrimSpace(js)+"\n"), 0644); err != nil {
+			return files, err
+		}
+	}
+	return files, nil
+}
+
+// jobFileNames gives each job id the file name it is exported to. It fails if two ids end up with
+// the same file name, also when they only differ in case, so that no job overwrites another.
+func jobFileNames(ids []string) (map[string]string, error) {
+	names := make(map[string]string, len(ids))
+	taken := make(map[string]string, len(ids))
+	for _, id := range ids {
+		name := jobFileName(id)
+		if other, ok := taken[strings.ToLower(name)]; ok && other != id {
+			return nil, fmt.Errorf("jobs '%s' and '%s' would both be exported to %s.json", other, id, name)
+		}
+		taken[strings.ToLower(name)] = id
+		names[id] = name
+	}
+	return names, nil
+}
+
+// jobFileName makes a job id safe to use as a file name
+func jobFileName(id string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|', ' ':
+			return '_'
+		}
+		return r
+	}, id)
+}
@@ -0,0 +1,82 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/franela/goblin"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+)
+
+func TestExport(t *testing.T) {
+	g := goblin.Goblin(t)
+	g.Describe("job export", func() {
+		g.It("should write the config without the code, and the transform next to it", func() {
+			dir := t.TempDir()
+			code := "function transform_entities(entities) {\n  return entities;\n}\n"
+			config := map[string]interface{}{"id": "crm/person", "title": "Person", "custom": json.Number("12"), "transform": map[string]interface{}{
+				"Type":        "JavascriptTransform",
+				"Code":        base64.StdEncoding.EncodeToString([]byte(code)),
+				"Parallelism": json.Number("2"),
+			}}
+			files, err := exportJob(dir, "crm_person", config)
+			g.Assert(err).IsNil()
+			g.Assert(files).Equal([2]string{"crm_person.json", "crm_person.js"})
+
+			js, err := os.ReadFile(filepath.Join(dir, "crm_person.js"))
+			g.Assert(err).IsNil()
+			g.Assert(string(js)).Equal("export " + code)
+
+			data, err := os.ReadFile(filepath.Join(dir, "crm_person.json"))
+			g.Assert(err).IsNil()
+			written, err := api.ParseJobConfigs([]byte("[" + string(data) + "]"))
+			g.Assert(err).IsNil()
+			g.Assert(written[0]["transform"]).Equal(map[string]interface{}{"Parallelism": json.Number("2")})
+			g.Assert(written[0]["custom"]).Equal(json.Number("12"))
+			g.Assert(config["transform"].(map[string]interface{})["Code"] != nil).IsTrue()
+		})
+		g.It("should only write the fields the job has", func() {
+			dir := t.TempDir()
+			files, err := exportJob(dir, "copy", map[string]interface{}{"id": "copy", "transform": map[string]interface{}{"Type": "HttpTransform", "Url": "http://x"}})
+			g.Assert(err).IsNil()
+			g.Assert(files).Equal([2]string{"copy.json", ""})
+
+			data, err := os.ReadFile(filepath.Join(dir, "copy.json"))
+			g.Assert(err).IsNil()
+			g.Assert(string(data)).Equal("{\n  \"id\": \"copy\",\n  \"transform\": {\n    \"Type\": \"HttpTransform\",\n    \"Url\": \"http://x\"\n  }\n}\n")
+		})
+		g.It("should refuse jobs that would be exported to the same file", func() {
+			names, err := jobFileNames([]string{"a/b", "c"})
+			g.Assert(err).IsNil()
+			g.Assert(names["a/b"]).Equal("a_b")
+
+			_, err = jobFileNames([]string{"a b", "a_b"})
+			g.Assert(err.Error()).Equal("jobs 'a b' and 'a_b' would both be exported to a_b.json")
+			_, err = jobFileNames([]string{"Person", "person"})
+			g.Assert(err == nil).IsFalse()
+		})
+		g.It("should select jobs by id or title", func() {
+			jobs := []api.JobOutput{{Job: api.Job{Id: "a", Title: "A"}}, {Job: api.Job{Id: "b", Title: "B"}}, {Job: api.Job{Id: "c", Title: "C"}}}
+			selected := selectJobs(jobs, []string{"a", "C"})
+			g.Assert(len(selected)).Equal(2)
+			g.Assert(selected[1].Job.Id).Equal("c")
+		})
+	})
+}
@@ -0,0 +1,228 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+	"github.com/pterm/pterm"
+)
+
+// followPollInterval is how often the server is asked which of the followed jobs are still running
+const followPollInterval = 5 * time.Second
+
+// followStartPolls is how many polls a job may go without being seen running or a new history
+// entry, before it is taken to have finished, so that a job the server ran too fast to be seen
+// does not keep the follow view open
+const followStartPolls = 12
+
+const (
+	followStarting = "starting"
+	followRunning  = "running"
+	followFinished = "finished"
+	followFailed   = "failed"
+	followTimedOut = "timed out"
+)
+
+// followedJob is the state of one job in the follow view
+type followedJob struct {
+	id        string
+	title     string
+	started   time.Time
+	previous  time.Time
+	polls     int
+	ended     time.Time
+	state     string
+	processed int
+	lastError string
+}
+
+func (f *followedJob) done() bool {
+	return f.state == followFinished || f.state == followFailed || f.state == followTimedOut
+}
+
+func (f *followedJob) elapsed(now time.Time) time.Duration {
+	if !f.ended.IsZero() {
+		return f.ended.Sub(f.started)
+	}
+	return now.Sub(f.started)
+}
+
+// update moves a job that is no longer running to finished or failed, using its last history entry.
+// The history entry the job had before it was run belongs to an earlier run, so a job that has not
+// been seen running stays starting until a history entry that started after it shows up. The start
+// times are both written by the server, so this holds when the clocks differ.
+func (f *followedJob) update(running map[string]bool, histories map[string]api.JobHistory, now time.Time) {
+	if f.done() || running[f.id] {
+		if !f.done() {
+			f.state = followRunning
+		}
+		return
+	}
+	history, ok := histories[f.id]
+	fresh := ok && history.Start.After(f.previous)
+	if !fresh && f.state == followStarting {
+		f.polls++
+		if !ok || f.polls < followStartPolls {
+			return
+		}
+	}
+	f.ended = now
+	f.state = followFinished
+	if !fresh {
+		return
+	}
+	f.processed = history.Processed
+	f.lastError = history.LastError
+	if !history.Start.IsZero() && history.End.After(history.Start) {
+		f.ended = f.started.Add(history.End.Sub(history.Start))
+	}
+	if history.LastError != "" {
+		f.state = followFailed
+	}
+}
+
+// runAndFollow starts the jobs that are not already running, and follows all of them in a live table
+// until they are done or the timeout is reached. It returns false if any job failed or timed out.
+func runAndFollow(jm *api.JobManager, ids []api.JobId, jobType string, timeout time.Duration) bool {
+	now := time.Now()
+	previous := make(map[string]time.Time)
+	histories, historyErr := jm.ListJobHistories()
+	for _, h := range histories {
+		previous[h.Id] = h.Start
+	}
+	followed := make([]*followedJob, 0, len(ids))
+	for _, id := range ids {
+		f := &followedJob{id: id.Id, title: id.Title, started: now, previous: previous[id.Id], state: followStarting}
+		running, err := jm.GetJobStatus(id.Id)
+		if err == nil {
+			err = historyErr
+		}
+		if err == nil && len(running) > 0 {
+			f.state = followRunning
+			f.started = running[0].Started
+		} else if err == nil {
+			_, err = jm.Operate.Run(context.Background(), id.Id, jobType)
+		}
+		if err != nil {
+			f.state = followFailed
+			f.ended = now
+			f.lastError = err.Error()
+		}
+		followed = append(followed, f)
+	}
+
+	area, _ := pterm.DefaultArea.Start()
+	deadline := time.Time{}
+	if timeout > 0 {
+		deadline = now.Add(timeout)
+	}
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	lastPoll := time.Time{}
+	for {
+		now = time.Now()
+		if now.Sub(lastPoll) >= followPollInterval {
+			lastPoll = now
+			pollFollowed(jm, followed, now)
+		}
+		if !deadline.IsZero() && now.After(deadline) {
+			for _, f := range followed {
+				if !f.done() {
+					f.state = followTimedOut
+					f.ended = now
+				}
+			}
+		}
+		area.Update(renderFollowed(followed, now))
+		if allDone(followed) {
+			break
+		}
+		<-ticker.C
+	}
+	_ = area.Stop()
+	pterm.Println()
+
+	ok := true
+	for _, f := range followed {
+		if f.state != followFinished {
+			ok = false
+		}
+	}
+	return ok
+}
+
+// pollFollowed asks for the running jobs, and reads the history when a followed job has stopped
+func pollFollowed(jm *api.JobManager, followed []*followedJob, now time.Time) {
+	status, err := jm.GetJobStatus("")
+	if err != nil {
+		return // try again on the next poll
+	}
+	running := make(map[string]bool)
+	for _, s := range status {
+		running[s.JobId] = true
+	}
+
+	histories := make(map[string]api.JobHistory)
+	for _, f := range followed {
+		if !f.done() && !running[f.id] {
+			list, err := jm.ListJobHistories()
+			if err != nil {
+				return // try again on the next poll
+			}
+			for _, h := range list {
+				histories[h.Id] = h
+			}
+			break
+		}
+	}
+	for _, f := range followed {
+		f.update(running, histories, now)
+	}
+}
+
+func allDone(followed []*followedJob) bool {
+	for _, f := range followed {
+		if !f.done() {
+			return false
+		}
+	}
+	return true
+}
+
+func renderFollowed(followed []*followedJob, now time.Time) string {
+	out := [][]string{{"Job", "Title", "State", "Elapsed", "Processed", "Last error"}}
+	for _, f := range followed {
+		state := f.state
+		switch f.state {
+		case followFinished:
+			state = pterm.Green(f.state)
+		case followFailed, followTimedOut:
+			state = pterm.Red(f.state)
+		case followRunning:
+			state = pterm.Cyan(f.state)
+		}
+		processed := ""
+		if f.done() {
+			processed = strconv.Itoa(f.processed)
+		}
+		out = append(out, []string{f.id, f.title, state, f.elapsed(now).Round(time.Second).String(), processed, f.lastError})
+	}
+	table, _ := pterm.DefaultTable.WithHasHeader().WithData(out).Srender()
+	return table
+}
@@ -0,0 +1,107 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/franela/goblin"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+)
+
+func TestFollow(t *testing.T) {
+	g := goblin.Goblin(t)
+	g.Describe("following jobs", func() {
+		started := time.Date(2026, 10, 1, 10, 0, 0, 0, time.UTC)
+		now := started.Add(2 * time.Minute)
+
+		g.It("should keep running jobs running", func() {
+			f := &followedJob{id: "a", started: started, state: followStarting}
+			f.update(map[string]bool{"a": true}, nil, now)
+			g.Assert(f.state).Equal(followRunning)
+			g.Assert(f.elapsed(now)).Equal(2 * time.Minute)
+		})
+
+		g.It("should read the outcome from the history when a job stops", func() {
+			histories := map[string]api.JobHistory{
+				"a": {Id: "a", Start: started, End: started.Add(time.Minute), Processed: 10},
+				"b": {Id: "b", Start: started, End: started.Add(time.Minute), Processed: 3, LastError: "boom"},
+			}
+			a := &followedJob{id: "a", started: started, state: followRunning}
+			b := &followedJob{id: "b", started: started, state: followRunning}
+			a.update(map[string]bool{}, histories, now)
+			b.update(map[string]bool{}, histories, now)
+			g.Assert(a.state).Equal(followFinished)
+			g.Assert(a.processed).Equal(10)
+			g.Assert(a.elapsed(now)).Equal(time.Minute)
+			g.Assert(b.state).Equal(followFailed)
+			g.Assert(b.lastError).Equal("boom")
+			g.Assert(allDone([]*followedJob{a, b})).IsTrue()
+		})
+
+		g.It("should ignore the history of an earlier run", func() {
+			previous := started.Add(-time.Hour)
+			histories := map[string]api.JobHistory{
+				"a": {Id: "a", Start: previous, End: previous.Add(time.Minute), LastError: "old"},
+			}
+			f := &followedJob{id: "a", started: started, previous: previous, state: followStarting}
+			f.update(map[string]bool{}, histories, now)
+			g.Assert(f.state).Equal(followStarting)
+			g.Assert(f.lastError).Equal("")
+
+			histories["a"] = api.JobHistory{Id: "a", Start: started.Add(time.Second), End: started.Add(time.Minute), Processed: 4}
+			f.update(map[string]bool{}, histories, now)
+			g.Assert(f.state).Equal(followFinished)
+			g.Assert(f.processed).Equal(4)
+		})
+
+		g.It("should take a new history entry when the server clock is behind", func() {
+			previous := started.Add(-time.Hour)
+			histories := map[string]api.JobHistory{
+				"a": {Id: "a", Start: started.Add(-10 * time.Minute), End: started.Add(-9 * time.Minute), Processed: 7},
+			}
+			f := &followedJob{id: "a", started: started, previous: previous, state: followStarting}
+			f.update(map[string]bool{}, histories, now)
+			g.Assert(f.state).Equal(followFinished)
+			g.Assert(f.processed).Equal(7)
+		})
+
+		g.It("should finish a job that is not seen running after a number of polls", func() {
+			previous := started.Add(-time.Hour)
+			histories := map[string]api.JobHistory{"a": {Id: "a", Start: previous, LastError: "old"}}
+			f := &followedJob{id: "a", started: started, previous: previous, state: followStarting}
+			for i := 1; i < followStartPolls; i++ {
+				f.update(map[string]bool{}, histories, now)
+			}
+			g.Assert(f.state).Equal(followStarting)
+			f.update(map[string]bool{}, histories, now)
+			g.Assert(f.state).Equal(followFinished)
+			g.Assert(f.lastError).Equal("")
+
+			f = &followedJob{id: "b", started: started, state: followStarting}
+			for i := 0; i < 2*followStartPolls; i++ {
+				f.update(map[string]bool{}, histories, now)
+			}
+			g.Assert(f.state).Equal(followStarting)
+		})
+
+		g.It("should not change jobs that are done", func() {
+			f := &followedJob{id: "a", started: started, state: followTimedOut, ended: now}
+			f.update(map[string]bool{}, map[string]api.JobHistory{"a": {Id: "a"}}, now.Add(time.Minute))
+			g.Assert(f.state).Equal(followTimedOut)
+		})
+	})
+}
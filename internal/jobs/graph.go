@@ -0,0 +1,518 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/mimiro-io/datahub-cli/internal/login"
+	"github.com/mimiro-io/datahub-cli/internal/utils"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// GraphCmd shows how jobs and datasets feed each other
+var GraphCmd = &cobra.Command{
+	Use:   "graph",
+	Short: "Show which jobs feed which datasets and jobs",
+	Long: `Build a graph of jobs and datasets from the job configs. A dataset points to the jobs that read it
+as their source, as a MultiSource dependency or through an onchange trigger, and a job points to the
+dataset it writes to. Loops in the graph are reported. For example:
+mim jobs graph
+or
+mim jobs graph -d ./jobs --format mermaid > jobs.mmd
+or
+mim jobs graph --format dot | dot -Tsvg > jobs.svg
+
+The format is tree (the default), dot or mermaid.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		pterm.EnableDebugMessages()
+
+		dir, err := cmd.Flags().GetString("dir")
+		utils.HandleError(err)
+		format, err := cmd.Flags().GetString("format")
+		utils.HandleError(err)
+		if format != "tree" && format != "dot" && format != "mermaid" {
+			pterm.Error.Println("The format must be tree, dot or mermaid")
+			os.Exit(1)
+		}
+
+		var jobs []api.Job
+		if dir != "" {
+			files, err := findJobFiles(dir)
+			utils.HandleError(err)
+			jobs, err = readJobConfigs(files)
+			utils.HandleError(err)
+		} else {
+			server, token, err := login.ResolveCredentials()
+			utils.HandleError(err)
+			jobs = api.NewJobManager(server, token).GetJobs()
+		}
+
+		graph := buildJobGraph(jobs)
+		switch format {
+		case "dot":
+			graph.writeDot(os.Stdout)
+		case "mermaid":
+			graph.writeMermaid(os.Stdout)
+		default:
+			pterm.DefaultSection.Printf("%d jobs and %d datasets", graph.count(nodeJob), graph.count(nodeDataset))
+			err = pterm.DefaultTree.WithRoot(graph.tree()).Render()
+			utils.HandleError(err)
+			pterm.Println()
+		}
+
+		if cycles := graph.cycles(); len(cycles) > 0 {
+			for _, cycle := range cycles {
+				labels := make([]string, 0, len(cycle)+1)
+				for _, key := range append(cycle, cycle[0]) {
+					labels = append(labels, graph.nodes[key].String())
+				}
+				pterm.Warning.Println("Loop: " + strings.Join(labels, " -> "))
+			}
+			pterm.Println()
+		}
+	},
+	TraverseChildren: true,
+}
+
+func init() {
+	GraphCmd.Flags().StringP("dir", "d", "", "Build the graph from the job configs in this directory instead of the server")
+	GraphCmd.Flags().String("format", "tree", "The output format, tree, dot or mermaid")
+}
+
+// readJobConfigs reads the job configs without compiling their transforms
+func readJobConfigs(files []jobFile) ([]api.Job, error) {
+	jobs := make([]api.Job, 0, len(files))
+	for _, f := range files {
+		content, err := os.ReadFile(f.config)
+		if err != nil {
+			return nil, err
+		}
+		job := api.Job{}
+		if err := json.Unmarshal(content, &job); err != nil {
+			return nil, fmt.Errorf("could not parse %s: %w", f.config, err)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+const (
+	nodeJob     = "job"
+	nodeDataset = "dataset"
+)
+
+type graphNode struct {
+	kind  string
+	name  string
+	title string
+	job   *api.Job
+}
+
+func (n *graphNode) String() string {
+	if n.kind == nodeJob && n.title != "" && n.title != n.name {
+		return fmt.Sprintf("job %s (%s)", n.title, n.name)
+	}
+	return n.kind + " " + n.name
+}
+
+// jobGraph has job and dataset nodes, keyed by kind and name, with the roles of each edge
+type jobGraph struct {
+	nodes map[string]*graphNode
+	edges map[string]map[string][]string
+	in    map[string]map[string]bool
+}
+
+func nodeKey(kind string, name string) string {
+	return kind + ":" + name
+}
+
+func buildJobGraph(jobs []api.Job) *jobGraph {
+	g := &jobGraph{
+		nodes: make(map[string]*graphNode),
+		edges: make(map[string]map[string][]string),
+		in:    make(map[string]map[string]bool),
+	}
+	for i := range jobs {
+		job := &jobs[i]
+		jobKey := g.add(&graphNode{kind: nodeJob, name: job.Id, title: job.Title, job: job})
+		for _, ref := range job.DatasetRefs() {
+			dsKey := g.add(&graphNode{kind: nodeDataset, name: ref.Dataset})
+			if ref.Role == api.RoleSink {
+				g.link(jobKey, dsKey, ref.Role)
+			} else {
+				g.link(dsKey, jobKey, ref.Role)
+			}
+		}
+	}
+	return g
+}
+
+func (g *jobGraph) add(n *graphNode) string {
+	key := nodeKey(n.kind, n.name)
+	if _, ok := g.nodes[key]; !ok {
+		g.nodes[key] = n
+	}
+	return key
+}
+
+func (g *jobGraph) link(from string, to string, role string) {
+	if g.edges[from] == nil {
+		g.edges[from] = make(map[string][]string)
+	}
+	if g.in[to] == nil {
+		g.in[to] = make(map[string]bool)
+	}
+	g.in[to][from] = true
+	for _, r := range g.edges[from][to] {
+		if r == role {
+			return
+		}
+	}
+	g.edges[from][to] = append(g.edges[from][to], role)
+}
+
+func (g *jobGraph) count(kind string) int {
+	n := 0
+	for _, node := range g.nodes {
+		if node.kind == kind {
+			n++
+		}
+	}
+	return n
+}
+
+func (g *jobGraph) keys() []string {
+	keys := make([]string, 0, len(g.nodes))
+	for k := range g.nodes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (g *jobGraph) successors(key string) []string {
+	out := make([]string, 0, len(g.edges[key]))
+	for k := range g.edges[key] {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// roots are the nodes nothing points to, such as the datasets that are loaded from outside
+func (g *jobGraph) roots() []string {
+	roots := make([]string, 0)
+	for _, key := range g.keys() {
+		if len(g.in[key]) == 0 {
+			roots = append(roots, key)
+		}
+	}
+	return roots
+}
+
+// cycles returns one loop for each group of nodes that can reach each other, found with Tarjan's algorithm
+func (g *jobGraph) cycles() [][]string {
+	index := make(map[string]int)
+	low := make(map[string]int)
+	onStack := make(map[string]bool)
+	stack := make([]string, 0)
+	groups := make([][]string, 0)
+	next := 0
+
+	var visit func(key string)
+	visit = func(key string) {
+		index[key], low[key] = next, next
+		next++
+		stack = append(stack, key)
+		onStack[key] = true
+		for _, s := range g.successors(key) {
+			if _, seen := index[s]; !seen {
+				visit(s)
+				low[key] = min(low[key], low[s])
+			} else if onStack[s] {
+				low[key] = min(low[key], index[s])
+			}
+		}
+		if low[key] == index[key] {
+			group := make([]string, 0)
+			for {
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[top] = false
+				group = append(group, top)
+				if top == key {
+					break
+				}
+			}
+			if len(group) > 1 || g.edges[key][key] != nil {
+				groups = append(groups, group)
+			}
+		}
+	}
+	for _, key := range g.keys() {
+		if _, seen := index[key]; !seen {
+			visit(key)
+		}
+	}
+
+	cycles := make([][]string, 0, len(groups))
+	for _, group := range groups {
+		sort.Strings(group)
+		cycles = append(cycles, g.loopWithin(group))
+	}
+	sort.Slice(cycles, func(i, j int) bool { return cycles[i][0] < cycles[j][0] })
+	return cycles
+}
+
+// loopWithin finds the shortest loop from the first node of the group back to itself
+func (g *jobGraph) loopWithin(group []string) []string {
+	members := make(map[string]bool)
+	for _, k := range group {
+		members[k] = true
+	}
+	start := group[0]
+	prev := map[string]string{}
+	queue := []string{start}
+	for len(queue) > 0 {
+		key := queue[0]
+		queue = queue[1:]
+		for _, s := range g.successors(key) {
+			if !members[s] {
+				continue
+			}
+			if s == start {
+				path := []string{key}
+				for path[0] != start {
+					path = append([]string{prev[path[0]]}, path...)
+				}
+				return path
+			}
+			if _, seen := prev[s]; !seen {
+				prev[s] = key
+				queue = append(queue, s)
+			}
+		}
+	}
+	return group
+}
+
+// tree renders the graph from its roots. Nodes that are reached more than once are only expanded
+// the first time, and nodes that are only part of loops get their own root.
+func (g *jobGraph) tree() pterm.TreeNode {
+	expanded := make(map[string]bool)
+	var build func(key string, path map[string]bool) pterm.TreeNode
+	build = func(key string, path map[string]bool) pterm.TreeNode {
+		node := pterm.TreeNode{Text: g.label(key)}
+		if path[key] {
+			node.Text += pterm.Red(" (loop)")
+			return node
+		}
+		if expanded[key] && len(g.edges[key]) > 0 {
+			node.Text += pterm.Gray(" (see above)")
+			return node
+		}
+		expanded[key] = true
+		path[key] = true
+		for _, s := range g.successors(key) {
+			child := build(s, path)
+			if roles := g.edges[key][s]; g.nodes[key].kind == nodeDataset && !(len(roles) == 1 && roles[0] == api.RoleSource) {
+				child.Text += pterm.Gray(" [" + strings.Join(roles, ", ") + "]")
+			}
+			node.Children = append(node.Children, child)
+		}
+		delete(path, key)
+		return node
+	}
+
+	root := pterm.TreeNode{}
+	for _, key := range g.roots() {
+		root.Children = append(root.Children, build(key, map[string]bool{}))
+	}
+	for _, key := range g.keys() {
+		if !expanded[key] {
+			root.Children = append(root.Children, build(key, map[string]bool{}))
+		}
+	}
+	return root
+}
+
+func (g *jobGraph) label(key string) string {
+	n := g.nodes[key]
+	if n.kind == nodeJob {
+		text := pterm.Cyan(n.name)
+		if n.title != "" && n.title != n.name {
+			text = pterm.Cyan(n.title) + pterm.Gray(" ("+n.name+")")
+		}
+		if n.job != nil && n.job.Paused {
+			text += pterm.Yellow(" paused")
+		}
+		return text
+	}
+	return n.name
+}
+
+func (g *jobGraph) writeDot(w io.Writer) {
+	_, _ = fmt.Fprintln(w, "digraph jobs {")
+	_, _ = fmt.Fprintln(w, "  rankdir=LR;")
+	for _, key := range g.keys() {
+		n := g.nodes[key]
+		shape := "ellipse"
+		label := n.name
+		if n.kind == nodeJob {
+			shape = "box"
+			if n.title != "" {
+				label = n.title
+			}
+		}
+		_, _ = fmt.Fprintf(w, "  %q [label=%q, shape=%s];\n", key, label, shape)
+	}
+	for _, from := range g.keys() {
+		for _, to := range g.successors(from) {
+			roles := g.edges[from][to]
+			if len(roles) == 1 && (roles[0] == api.RoleSource || roles[0] == api.RoleSink) {
+				_, _ = fmt.Fprintf(w, "  %q -> %q;\n", from, to)
+			} else {
+				_, _ = fmt.Fprintf(w, "  %q -> %q [label=%q];\n", from, to, strings.Join(roles, ", "))
+			}
+		}
+	}
+	_, _ = fmt.Fprintln(w, "}")
+}
+
+func (g *jobGraph) writeMermaid(w io.Writer) {
+	ids := make(map[string]string)
+	_, _ = fmt.Fprintln(w, "flowchart LR")
+	for i, key := range g.keys() {
+		n := g.nodes[key]
+		ids[key] = fmt.Sprintf("n%d", i)
+		label := strings.ReplaceAll(n.name, "\"", "'")
+		if n.kind == nodeJob {
+			if n.title != "" {
+				label = strings.ReplaceAll(n.title, "\"", "'")
+			}
+			_, _ = fmt.Fprintf(w, "  %s[\"%s\"]\n", ids[key], label)
+		} else {
+			_, _ = fmt.Fprintf(w, "  %s([\"%s\"])\n", ids[key], label)
+		}
+	}
+	for _, from := range g.keys() {
+		for _, to := range g.successors(from) {
+			roles := g.edges[from][to]
+			if len(roles) == 1 && (roles[0] == api.RoleSource || roles[0] == api.RoleSink) {
+				_, _ = fmt.Fprintf(w, "  %s --> %s\n", ids[from], ids[to])
+			} else {
+				_, _ = fmt.Fprintf(w, "  %s -->|%s| %s\n", ids[from], strings.Join(roles, ", "), ids[to])
+			}
+		}
+	}
+}
+
+// reachable returns the nodes that can be reached from key, following edges forwards or backwards
+func (g *jobGraph) reachable(key string, forward bool) map[string]bool {
+	seen := map[string]bool{key: true}
+	queue := []string{key}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		next := make([]string, 0)
+		if forward {
+			next = g.successors(current)
+		} else {
+			for k := range g.in[current] {
+				next = append(next, k)
+			}
+		}
+		for _, k := range next {
+			if !seen[k] {
+				seen[k] = true
+				queue = append(queue, k)
+			}
+		}
+	}
+	return seen
+}
+
+// jobOrder returns the ids of the jobs among the given nodes, with every job after the jobs that
+// feed it. Jobs that are not ordered by the graph keep the order of their ids.
+func (g *jobGraph) jobOrder(keys map[string]bool) ([]string, error) {
+	indegree := make(map[string]int)
+	for key := range keys {
+		for from := range g.in[key] {
+			if keys[from] {
+				indegree[key]++
+			}
+		}
+	}
+	ready := make([]string, 0)
+	for key := range keys {
+		if indegree[key] == 0 {
+			ready = append(ready, key)
+		}
+	}
+
+	order := make([]string, 0)
+	visited := 0
+	for len(ready) > 0 {
+		sort.Strings(ready)
+		key := ready[0]
+		ready = ready[1:]
+		visited++
+		if n := g.nodes[key]; n.kind == nodeJob {
+			order = append(order, n.name)
+		}
+		for _, s := range g.successors(key) {
+			if !keys[s] {
+				continue
+			}
+			indegree[s]--
+			if indegree[s] == 0 {
+				ready = append(ready, s)
+			}
+		}
+	}
+	if visited < len(keys) {
+		return nil, fmt.Errorf("the jobs can not be ordered, as they form a loop")
+	}
+	return order, nil
+}
+
+// chain returns the job and the jobs downstream and/or upstream of it, in the order they should run
+func (g *jobGraph) chain(id string, downstream bool, upstream bool) ([]string, error) {
+	start := nodeKey(nodeJob, id)
+	if _, ok := g.nodes[start]; !ok {
+		return nil, fmt.Errorf("job '%s' not found", id)
+	}
+	keys := map[string]bool{start: true}
+	if downstream {
+		for k := range g.reachable(start, true) {
+			keys[k] = true
+		}
+	}
+	if upstream {
+		for k := range g.reachable(start, false) {
+			keys[k] = true
+		}
+	}
+	return g.jobOrder(keys)
+}
@@ -0,0 +1,91 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/franela/goblin"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+)
+
+func TestGraph(t *testing.T) {
+	g := goblin.Goblin(t)
+	g.Describe("job graph", func() {
+		job := func(id string, source string, sink string) api.Job {
+			return api.Job{
+				Id:     id,
+				Source: map[string]interface{}{"Type": "DatasetSource", "Name": source},
+				Sink:   map[string]interface{}{"Type": "DatasetSink", "Name": sink},
+			}
+		}
+
+		g.It("should link datasets to the jobs that read them and jobs to their sinks", func() {
+			multi := job("m", "b", "c")
+			multi.Source = map[string]interface{}{
+				"Type": "MultiSource", "Name": "b",
+				"Dependencies": []interface{}{map[string]interface{}{"dataset": "x"}},
+			}
+			multi.Triggers = []api.JobTrigger{{TriggerType: "onchange", MonitoredDataset: "b"}}
+			graph := buildJobGraph([]api.Job{job("j", "a", "b"), multi})
+
+			g.Assert(graph.count(nodeJob)).Equal(2)
+			g.Assert(graph.count(nodeDataset)).Equal(4)
+			g.Assert(graph.successors("dataset:a")).Equal([]string{"job:j"})
+			g.Assert(graph.successors("job:j")).Equal([]string{"dataset:b"})
+			g.Assert(graph.edges["dataset:b"]["job:m"]).Equal([]string{api.RoleSource, api.RoleTrigger})
+			g.Assert(graph.edges["dataset:x"]["job:m"]).Equal([]string{api.RoleDependency})
+			g.Assert(graph.roots()).Equal([]string{"dataset:a", "dataset:x"})
+			g.Assert(len(graph.cycles())).Equal(0)
+		})
+
+		g.It("should find loops", func() {
+			graph := buildJobGraph([]api.Job{job("j1", "a", "b"), job("j2", "b", "a"), job("j3", "c", "c"), job("j4", "b", "d")})
+			cycles := graph.cycles()
+			g.Assert(len(cycles)).Equal(2)
+			g.Assert(cycles[0]).Equal([]string{"dataset:a", "job:j1", "dataset:b", "job:j2"})
+			g.Assert(cycles[1]).Equal([]string{"dataset:c", "job:j3"})
+		})
+
+		g.It("should order the jobs up and down stream of a job", func() {
+			graph := buildJobGraph([]api.Job{job("c", "z", "w"), job("b", "y", "z"), job("a", "x", "y"), job("other", "q", "r")})
+			order, err := graph.chain("b", true, false)
+			g.Assert(err).IsNil()
+			g.Assert(order).Equal([]string{"b", "c"})
+			order, _ = graph.chain("b", false, true)
+			g.Assert(order).Equal([]string{"a", "b"})
+			order, _ = graph.chain("b", true, true)
+			g.Assert(order).Equal([]string{"a", "b", "c"})
+
+			_, err = buildJobGraph([]api.Job{job("j1", "a", "b"), job("j2", "b", "a")}).chain("j1", true, false)
+			g.Assert(err == nil).IsFalse()
+			_, err = graph.chain("missing", true, false)
+			g.Assert(err == nil).IsFalse()
+		})
+
+		g.It("should write dot and mermaid", func() {
+			graph := buildJobGraph([]api.Job{job("j", "a", "b")})
+			dot := &bytes.Buffer{}
+			graph.writeDot(dot)
+			g.Assert(strings.Contains(dot.String(), `"dataset:a" -> "job:j";`)).IsTrue()
+			mermaid := &bytes.Buffer{}
+			graph.writeMermaid(mermaid)
+			g.Assert(strings.Contains(mermaid.String(), "n0 --> n2")).IsTrue()
+			g.Assert(strings.Contains(mermaid.String(), `n2["j"]`)).IsTrue()
+		})
+	})
+}
@@ -29,10 +29,12 @@ import (
 
 // StatusCmd represents the staus command on a job
 var HistoryCmd = &cobra.Command{
-	Use:     "history",
-	Short:   "history for a job",
-	Long:    "history for a job",
-	Example: "mim jobs history --id <jobid>",
+	Use:   "history",
+	Short: "history for a job",
+	Long: `Show the last run of a job. With --trend, the runs recorded locally with jobs history record are
+shown instead, with how the duration and processed count change over time, and runs much slower than
+the median flagged.`,
+	Example: "mim jobs history --id <jobid>\nmim jobs history <jobid> --trend --last 50",
 	Run: func(cmd *cobra.Command, args []string) {
 		format := utils.ResolveFormat(cmd)
 		if format != "term" { // turn of pterm output
@@ -58,6 +60,29 @@ var HistoryCmd = &cobra.Command{
 		jm := api.NewJobManager(server, token)
 		id := jm.ResolveId(idOrTitle)
 
+		trend, err := cmd.Flags().GetBool("trend")
+		utils.HandleError(err)
+		if trend {
+			last, err := cmd.Flags().GetInt("last")
+			utils.HandleError(err)
+			factor, err := cmd.Flags().GetFloat64("slow-factor")
+			utils.HandleError(err)
+
+			pterm.DefaultSection.Printf("Recorded runs of job with id: " + id + " (" + idOrTitle + ") on " + server)
+			store, err := openHistoryStore(historyStorePath())
+			utils.HandleError(err)
+			runs, err := store.runs(server, id)
+			_ = store.close()
+			utils.HandleError(err)
+			if len(runs) == 0 {
+				pterm.Warning.Println("No runs are recorded for this job, record them with: mim jobs history record")
+				pterm.Println()
+				return
+			}
+			renderTrend(buildTrend(id, runs, last, factor), format)
+			return
+		}
+
 		pterm.DefaultSection.Printf("Get history of job with id: " + id + " (" + idOrTitle + ") on " + server)
 
 		hist, err := jm.GetJobHistoryForId(id)
@@ -77,6 +102,10 @@ var HistoryCmd = &cobra.Command{
 
 func init() {
 	HistoryCmd.Flags().StringP("id", "i", "", "The name of the job you want to get status on")
+	HistoryCmd.Flags().Bool("trend", false, "Show the locally recorded runs of the job over time")
+	HistoryCmd.Flags().Int("last", 30, "The number of recorded runs to show with --trend")
+	HistoryCmd.Flags().Float64("slow-factor", 2, "Flag runs that took this many times the median duration with --trend")
+	HistoryCmd.AddCommand(HistoryRecordCmd)
 }
 
 func renderHistory(history api.JobHistory, format string) {
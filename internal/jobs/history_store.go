@@ -0,0 +1,194 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mimiro-io/datahub-cli/internal/login"
+	"github.com/mimiro-io/datahub-cli/internal/utils"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+	"github.com/pterm/pterm"
+	"github.com/rotisserie/eris"
+	"github.com/spf13/cobra"
+	bolt "go.etcd.io/bbolt"
+)
+
+// HistoryRecordCmd keeps the job history of the server in a local store
+var HistoryRecordCmd = &cobra.Command{
+	Use:   "record",
+	Short: "Record the job history of the server locally",
+	Long: `The server only keeps the last run of each job. This command adds the runs that are not recorded yet
+to a local store in ~/.mim/history.db, so it can be run from cron, or kept running with --watch, to build
+up the history that jobs history --trend shows. For example:
+mim jobs history record
+or
+mim jobs history record --watch --interval 1m
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		server, token, err := login.ResolveCredentials()
+		utils.HandleError(err)
+
+		watch, err := cmd.Flags().GetBool("watch")
+		utils.HandleError(err)
+		interval, err := cmd.Flags().GetDuration("interval")
+		utils.HandleError(err)
+		if interval <= 0 {
+			pterm.Error.Println("The interval must be larger than 0")
+			os.Exit(1)
+		}
+
+		pterm.EnableDebugMessages()
+
+		jm := api.NewJobManager(server, token)
+		path := historyStorePath()
+		for {
+			added, err := recordHistory(jm, server, path)
+			if err != nil {
+				if !watch {
+					utils.HandleError(err)
+				}
+				pterm.Warning.Printf("Could not record runs from %s, trying again in %s: %s\n", server, interval, err)
+			} else {
+				pterm.Success.Printf("Recorded %d new run(s) from %s\n", added, server)
+			}
+			if !watch {
+				break
+			}
+			time.Sleep(interval)
+		}
+		pterm.Println()
+	},
+	TraverseChildren: true,
+}
+
+func init() {
+	HistoryRecordCmd.Flags().Bool("watch", false, "Keep recording new runs until stopped")
+	HistoryRecordCmd.Flags().Duration("interval", time.Minute, "How often to record new runs with --watch")
+}
+
+// recordHistory reads the job history from the server, and adds the new runs to the store
+func recordHistory(jm *api.JobManager, server string, path string) (int, error) {
+	histories, err := jm.ListJobHistories()
+	if err != nil {
+		return 0, err
+	}
+	store, err := openHistoryStore(path)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = store.close()
+	}()
+	return store.record(server, histories)
+}
+
+func historyStorePath() string {
+	home, err := os.UserHomeDir()
+	utils.HandleError(err)
+	return filepath.Join(home, ".mim", "history.db")
+}
+
+// historyStore keeps job runs in a bucket for each server, with a bucket for each job inside it,
+// keyed by the start time of the run so they are read back in order.
+type historyStore struct {
+	db *bolt.DB
+}
+
+func openHistoryStore(path string) (*historyStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, eris.Wrap(err, "failed creating the directory of the history store")
+	}
+	db, err := bolt.Open(path, 0666, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return nil, eris.Wrap(err, "failed opening the history store")
+	}
+	return &historyStore{db: db}, nil
+}
+
+func (s *historyStore) close() error {
+	return s.db.Close()
+}
+
+func runKey(start time.Time) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(start.UnixNano()))
+	return key
+}
+
+// record adds the runs that are not in the store yet, and returns how many were added. Runs that
+// are still in progress have no end time, and are left for a later recording.
+func (s *historyStore) record(server string, histories []api.JobHistory) (int, error) {
+	added := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		serverBucket, err := tx.CreateBucketIfNotExists([]byte(server))
+		if err != nil {
+			return err
+		}
+		for _, h := range histories {
+			if h.Start.IsZero() || h.End.IsZero() {
+				continue
+			}
+			h.Id = strings.TrimSuffix(h.Id, "_temp")
+			jobBucket, err := serverBucket.CreateBucketIfNotExists([]byte(h.Id))
+			if err != nil {
+				return err
+			}
+			key := runKey(h.Start)
+			if jobBucket.Get(key) != nil {
+				continue
+			}
+			value, err := json.Marshal(h)
+			if err != nil {
+				return err
+			}
+			if err := jobBucket.Put(key, value); err != nil {
+				return err
+			}
+			added++
+		}
+		return nil
+	})
+	return added, err
+}
+
+// runs returns the recorded runs of a job, oldest first
+func (s *historyStore) runs(server string, jobId string) ([]api.JobHistory, error) {
+	runs := make([]api.JobHistory, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		serverBucket := tx.Bucket([]byte(server))
+		if serverBucket == nil {
+			return nil
+		}
+		jobBucket := serverBucket.Bucket([]byte(jobId))
+		if jobBucket == nil {
+			return nil
+		}
+		return jobBucket.ForEach(func(k, v []byte) error {
+			h := api.JobHistory{}
+			if err := json.Unmarshal(v, &h); err != nil {
+				return err
+			}
+			runs = append(runs, h)
+			return nil
+		})
+	})
+	return runs, err
+}
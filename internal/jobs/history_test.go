@@ -0,0 +1,73 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/franela/goblin"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+)
+
+func TestHistory(t *testing.T) {
+	g := goblin.Goblin(t)
+	g.Describe("recorded job history", func() {
+		start := time.Date(2026, 10, 1, 10, 0, 0, 0, time.UTC)
+		run := func(id string, hour int, took time.Duration, processed int) api.JobHistory {
+			s := start.Add(time.Duration(hour) * time.Hour)
+			return api.JobHistory{Id: id, Start: s, End: s.Add(took), Processed: processed}
+		}
+
+		g.It("should only add new runs that have ended", func() {
+			store, err := openHistoryStore(filepath.Join(t.TempDir(), "history.db"))
+			g.Assert(err).IsNil()
+			defer func() { _ = store.close() }()
+
+			added, err := store.record("s1", []api.JobHistory{run("a", 0, time.Minute, 1), {Id: "b", Start: start}})
+			g.Assert(err).IsNil()
+			g.Assert(added).Equal(1)
+			added, _ = store.record("s1", []api.JobHistory{run("a", 0, time.Minute, 1), run("a_temp", 1, time.Minute, 2)})
+			g.Assert(added).Equal(1)
+
+			runs, _ := store.runs("s1", "a")
+			g.Assert(len(runs)).Equal(2)
+			g.Assert(runs[1].Processed).Equal(2)
+			runs, _ = store.runs("s2", "a")
+			g.Assert(len(runs)).Equal(0)
+		})
+
+		g.It("should flag runs much slower than the median", func() {
+			runs := []api.JobHistory{
+				run("a", 0, 10*time.Minute, 1),
+				run("a", 1, time.Minute, 10),
+				run("a", 2, 2*time.Minute, 20),
+				run("a", 3, time.Minute, 30),
+				run("a", 4, 5*time.Minute, 40),
+			}
+			trend := buildTrend("a", runs, 0, 2)
+			g.Assert(trend.median).Equal(2 * time.Minute)
+			g.Assert(trend.MedianProcessed).Equal(20)
+			g.Assert(trend.Runs[0].Slow).IsTrue()
+			g.Assert(trend.Runs[2].Slow).IsFalse()
+			g.Assert(trend.Runs[4].Slow).IsTrue()
+
+			trend = buildTrend("a", runs, 2, 2)
+			g.Assert(len(trend.Runs)).Equal(2)
+			g.Assert(trend.median).Equal(3 * time.Minute)
+		})
+	})
+}
@@ -0,0 +1,151 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mimiro-io/datahub-cli/internal/utils"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+	"github.com/pterm/pterm"
+	"github.com/tidwall/pretty"
+)
+
+type trendRun struct {
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Duration  string    `json:"duration"`
+	Seconds   float64   `json:"seconds"`
+	Processed int       `json:"processed"`
+	LastError string    `json:"lastError,omitempty"`
+	Slow      bool      `json:"slow"`
+	took      time.Duration
+}
+
+type historyTrend struct {
+	Job             string     `json:"job"`
+	Runs            []trendRun `json:"runs"`
+	MedianDuration  string     `json:"medianDuration"`
+	MedianProcessed int        `json:"medianProcessed"`
+	SlowFactor      float64    `json:"slowFactor"`
+	median          time.Duration
+}
+
+// buildTrend takes the last runs, oldest first, and flags the runs that took more than factor
+// times the median duration of them
+func buildTrend(job string, runs []api.JobHistory, last int, factor float64) historyTrend {
+	if last > 0 && len(runs) > last {
+		runs = runs[len(runs)-last:]
+	}
+	trend := historyTrend{Job: job, Runs: make([]trendRun, 0, len(runs)), SlowFactor: factor}
+	durations := make([]time.Duration, 0, len(runs))
+	processed := make([]int, 0, len(runs))
+	for _, h := range runs {
+		d := h.End.Sub(h.Start)
+		durations = append(durations, d)
+		processed = append(processed, h.Processed)
+		trend.Runs = append(trend.Runs, trendRun{
+			Start:     h.Start,
+			End:       h.End,
+			Duration:  d.String(),
+			Seconds:   d.Seconds(),
+			Processed: h.Processed,
+			LastError: h.LastError,
+			took:      d,
+		})
+	}
+	if len(runs) == 0 {
+		return trend
+	}
+
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	sort.Ints(processed)
+	trend.median = durations[len(durations)/2]
+	trend.MedianProcessed = processed[len(processed)/2]
+	if len(durations)%2 == 0 {
+		trend.median = (durations[len(durations)/2-1] + durations[len(durations)/2]) / 2
+		trend.MedianProcessed = (processed[len(processed)/2-1] + processed[len(processed)/2]) / 2
+	}
+	trend.MedianDuration = trend.median.String()
+	for i := range trend.Runs {
+		trend.Runs[i].Slow = trend.median > 0 && float64(trend.Runs[i].took) > factor*float64(trend.median)
+	}
+	return trend
+}
+
+func renderTrend(trend historyTrend, format string) {
+	if format != "term" {
+		out, err := json.Marshal(trend)
+		utils.HandleError(err)
+		if format == "pretty" {
+			out = pretty.Color(pretty.Pretty(out), nil)
+		}
+		fmt.Println(string(out))
+		return
+	}
+
+	var longest time.Duration
+	most := 0
+	for _, r := range trend.Runs {
+		longest = max(longest, r.took)
+		most = max(most, r.Processed)
+	}
+
+	out := [][]string{{"Start", "Duration", "", "Processed", "", "Error"}}
+	slow := 0
+	for _, r := range trend.Runs {
+		duration := r.took.Round(time.Millisecond).String()
+		durationBar := trendBar(float64(r.took), float64(longest))
+		if r.Slow {
+			slow++
+			duration = pterm.Red(duration)
+			durationBar = pterm.Red(durationBar) + pterm.Red(fmt.Sprintf(" %.1fx", float64(r.took)/float64(trend.median)))
+		}
+		out = append(out, []string{
+			utils.Date(r.Start),
+			duration,
+			durationBar,
+			strconv.Itoa(r.Processed),
+			trendBar(float64(r.Processed), float64(most)),
+			truncateError(r.LastError, 40),
+		})
+	}
+	pterm.DefaultTable.WithHasHeader().WithData(out).Render()
+	pterm.Println()
+
+	pterm.Info.Printf("%d run(s), median duration %s, median processed %d\n", len(trend.Runs), trend.median.Round(time.Millisecond), trend.MedianProcessed)
+	if slow > 0 {
+		pterm.Warning.Printf("%d run(s) took more than %.1f times the median duration\n", slow, trend.SlowFactor)
+	}
+	pterm.Println()
+}
+
+// trendBar draws a bar with a length relative to the largest value
+func trendBar(value float64, largest float64) string {
+	const width = 20
+	if largest <= 0 {
+		return ""
+	}
+	n := int(value / largest * width)
+	if n == 0 && value > 0 {
+		n = 1
+	}
+	return strings.Repeat("█", n)
+}
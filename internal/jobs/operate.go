@@ -16,14 +16,12 @@ package jobs
 
 import (
 	"context"
-	"fmt"
 	"os"
 	"time"
 
 	"github.com/mimiro-io/datahub-cli/internal/login"
 	"github.com/mimiro-io/datahub-cli/internal/utils"
 	"github.com/mimiro-io/datahub-cli/pkg/api"
-	"github.com/rotisserie/eris"
 	"golang.org/x/sync/errgroup"
 
 	"github.com/pterm/pterm"
@@ -38,6 +36,7 @@ func CmdOperate() *cobra.Command {
 		since     string
 		jobType   string
 		wait      bool
+		timeout   time.Duration
 	)
 
 	cmd := &cobra.Command{
@@ -47,6 +46,11 @@ func CmdOperate() *cobra.Command {
 
 	mim jobs operate -i <id> -o stop
 	mim jobs operate --id <id> --operation stop
+
+Use --wait with the run operation to follow the jobs in a live table until they are done. The command
+then exits with 1 if any job failed, or did not finish within --timeout:
+
+	mim jobs operate -i <id> -i <other-id> -o run --wait --timeout 30m
 `,
 		Run: func(cmd *cobra.Command, args []string) {
 			if len(ids) == 0 && len(args) > 0 {
@@ -58,11 +62,6 @@ func CmdOperate() *cobra.Command {
 				os.Exit(0)
 			}
 
-			// we only allow 1 job if we are following, because of reasons of complexity
-			if len(ids) > 1 && operation == "run" && wait {
-				utils.HandleError(eris.New("When following a job, only 1 id is allowed"))
-			}
-
 			server, token, err := login.ResolveCredentials()
 			utils.HandleError(err)
 
@@ -82,8 +81,12 @@ func CmdOperate() *cobra.Command {
 					os.Exit(0)
 				}
 			} else if operation == "run" && wait {
-				// if operation is run, and we are following, handle differently for now
-				runAndWait(jm, resolvedIds[0], jobType)
+				// if operation is run, and we are following, the jobs are shown in a live table instead
+				if !runAndFollow(jm, resolvedIds, jobType, timeout) {
+					pterm.Error.Println("One or more jobs failed")
+					os.Exit(1)
+				}
+				pterm.Success.Println("All jobs finished")
 				os.Exit(0)
 			}
 
@@ -125,7 +128,8 @@ func CmdOperate() *cobra.Command {
 	cmd.Flags().StringSliceVarP(&ids, "id", "i", []string{}, "The job id or name of the job you want to operate on. Can be multiple ids.")
 	cmd.Flags().StringVarP(&since, "since", "s", "", "The since token to reset to, if resetting or running")
 	cmd.Flags().StringVarP(&jobType, "jobType", "t", "", "Job type for operation run: fullsync or incremental")
-	cmd.Flags().BoolVarP(&wait, "wait", "w", false, "Use together with run operation to wait for the job to finish. When set you can only have 1 job id.")
+	cmd.Flags().BoolVarP(&wait, "wait", "w", false, "Use together with run operation to wait for the jobs to finish")
+	cmd.Flags().DurationVar(&timeout, "timeout", 0, "Use together with wait to stop waiting after this long, like 30m. Jobs still running count as failed")
 	_ = cmd.RegisterFlagCompletionFunc("operation", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 		return []string{"run", "stop", "pause", "resume", "kill", "reset", "reset-metadata"}, cobra.ShellCompDirectiveDefault
 	})
@@ -167,54 +171,6 @@ func operate(jm *api.JobManager, operation string, id api.JobId, since string, j
 	return err
 }
 
-// runAndWait is called when wait flag is set and the operation is "run". For now this has to be handled
-// differently than the others, as the ui component is quite different. We also only allow to run 1 job at a
-// time when the wait flag is set.
-func runAndWait(jm *api.JobManager, id api.JobId, jobType string) {
-	// is job running?
-	running, err := jm.GetJobStatus(id.Id)
-	utils.HandleError(err)
-	runningId := ""
-	if len(running) == 0 { // not running
-		job, err := jm.Operate.Run(context.Background(), id.Id, jobType)
-		utils.HandleError(err)
-
-		runningId = job.JobId
-
-		pterm.Success.Println("Job was started")
-	} else {
-		pterm.Success.Println("Job is already running, reattaching")
-		runningId = running[0].JobId
-	}
-
-	pterm.Println()
-	spinner, err := pterm.DefaultSpinner.Start(fmt.Sprintf("Processing job with id '%s'", runningId))
-	utils.HandleError(err)
-	err = followJob(runningId, *jm)
-	if err != nil {
-		spinner.Fail("Failed following job")
-		utils.HandleError(err) // this should be an error in the handling only, not in the job running itself
-	}
-	// we can fetch the job history
-	history, err := jm.GetJobHistoryForId(runningId)
-	if err != nil {
-		spinner.Fail(err)
-	} else {
-		if history.LastError == "" {
-			spinner.Success("Finished")
-		} else {
-			spinner.Fail("Finished with error")
-		}
-		pterm.Info.Println(fmt.Sprintf("Job started: 	%v", utils.Date(history.Start)))
-		pterm.Info.Println(fmt.Sprintf("Job ended: 	%v", utils.Date(history.End)))
-		pterm.Info.Println(fmt.Sprintf("Processed %v entities", history.Processed))
-		if history.LastError != "" {
-			pterm.Error.Println("Last error:")
-			pterm.Println(history.LastError)
-		}
-	}
-}
-
 func followJob(jobId string, jm api.JobManager) error {
 	for {
 		status, err := jm.GetJobStatus(jobId)
@@ -0,0 +1,247 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/mimiro-io/datahub-cli/internal/login"
+	"github.com/mimiro-io/datahub-cli/internal/utils"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// RunChainCmd runs a job together with the jobs that depend on it, in order
+var RunChainCmd = &cobra.Command{
+	Use:   "run-chain",
+	Short: "Run a job and the jobs downstream or upstream of it, in order",
+	Long: `Run a job and then every job downstream of it, one at a time and in the order they feed each other,
+as found from the source, sink and trigger of each job config. Each job is waited for like with
+jobs operate --wait, and the chain stops at the first job that fails. For example:
+mim jobs run-chain <job>
+or
+mim jobs run-chain <job> --upstream
+or
+mim jobs run-chain <job> --upstream --downstream --jobType fullsync
+
+With --upstream the jobs feeding the job are run before it. Use --dry-run to only show the order.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			_ = cmd.Usage()
+			os.Exit(0)
+		}
+
+		downstream, err := cmd.Flags().GetBool("downstream")
+		utils.HandleError(err)
+		upstream, err := cmd.Flags().GetBool("upstream")
+		utils.HandleError(err)
+		jobType, err := cmd.Flags().GetString("jobType")
+		utils.HandleError(err)
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		utils.HandleError(err)
+		if !cmd.Flags().Changed("downstream") && upstream {
+			downstream = false
+		}
+
+		server, token, err := login.ResolveCredentials()
+		utils.HandleError(err)
+
+		pterm.EnableDebugMessages()
+
+		jm := api.NewJobManager(server, token)
+		jobs := jm.GetJobs()
+		id := jm.ResolveId(args[0])
+
+		order, err := buildJobGraph(jobs).chain(id, downstream, upstream)
+		utils.HandleError(err)
+
+		titles := make(map[string]string)
+		for _, job := range jobs {
+			titles[job.Id] = job.Title
+		}
+
+		pterm.DefaultSection.Printf("Running %d job(s) on %s", len(order), server)
+		items := make([]pterm.BulletListItem, 0, len(order))
+		for i, jobId := range order {
+			items = append(items, pterm.BulletListItem{Level: 0, Text: fmt.Sprintf("%d. %s", i+1, jobLabel(jobId, titles[jobId]))})
+		}
+		_ = pterm.DefaultBulletList.WithItems(items).Render()
+		if dryRun {
+			return
+		}
+
+		results := make([]chainResult, 0, len(order))
+		failed := false
+		for _, jobId := range order {
+			if failed {
+				results = append(results, chainResult{Id: jobId, Title: titles[jobId], Status: "skipped"})
+				continue
+			}
+			result := runChainJob(jm, jobId, titles[jobId], jobType)
+			results = append(results, result)
+			failed = result.Status == "failed"
+		}
+
+		pterm.Println()
+		renderChainResults(results)
+		if failed {
+			pterm.Error.Println("The chain stopped at a failed job")
+			pterm.Println()
+			os.Exit(1)
+		}
+		pterm.Success.Printf("Ran %d job(s)\n", len(results))
+		pterm.Println()
+	},
+	TraverseChildren: true,
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) != 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return api.GetJobsCompletion(toComplete), cobra.ShellCompDirectiveNoFileComp
+	},
+}
+
+func init() {
+	RunChainCmd.Flags().Bool("downstream", true, "Run the jobs that read what the job writes, after it")
+	RunChainCmd.Flags().Bool("upstream", false, "Run the jobs that feed the job, before it")
+	RunChainCmd.Flags().StringP("jobType", "t", "", "Job type to run the jobs with: fullsync or incremental")
+	RunChainCmd.Flags().Bool("dry-run", false, "Only show the jobs and the order they would run in")
+	_ = RunChainCmd.RegisterFlagCompletionFunc("jobType", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{"fullsync", "incremental"}, cobra.ShellCompDirectiveDefault
+	})
+}
+
+type chainResult struct {
+	Id        string
+	Title     string
+	Status    string
+	Duration  time.Duration
+	Processed int
+	Error     string
+}
+
+func jobLabel(id string, title string) string {
+	if title == "" || title == id {
+		return id
+	}
+	return fmt.Sprintf("%s (%s)", title, id)
+}
+
+// chainPollInterval is how often the server is asked if a job in the chain is still running
+const chainPollInterval = 5 * time.Second
+
+// chainRun tells when a job that was asked to run has finished. A job does not show as running
+// right away, and until then its history is the one of the run before, so the run is only over
+// when the job has a history entry that started after the one it had before it was run. This is
+// compared with the start times the server wrote, so it holds when the clocks differ.
+type chainRun struct {
+	previous time.Time
+	seen     bool
+}
+
+// update takes what the last poll found, and returns true when the history is the one of this run
+func (r *chainRun) update(running bool, history *api.JobHistory) bool {
+	if running {
+		r.seen = true
+		return false
+	}
+	if history == nil {
+		return r.seen
+	}
+	return history.Start.After(r.previous)
+}
+
+// runChainJob runs a job and waits for it, and reports how it went
+func runChainJob(jm *api.JobManager, id string, title string, jobType string) chainResult {
+	result := chainResult{Id: id, Title: title, Status: "failed"}
+	started := time.Now()
+	spinner, _ := pterm.DefaultSpinner.Start(fmt.Sprintf("Running %s", jobLabel(id, title)))
+
+	run := &chainRun{}
+	if previous, err := jm.GetJobHistoryForId(id); err == nil {
+		run.previous = previous.Start
+	}
+	running, err := jm.GetJobStatus(id)
+	if err == nil && len(running) == 0 {
+		_, err = jm.Operate.Run(context.Background(), id, jobType)
+	}
+	var history api.JobHistory
+	for err == nil {
+		running, err = jm.GetJobStatus(id)
+		if err != nil {
+			break
+		}
+		if len(running) > 0 {
+			run.update(true, nil)
+		} else if h, herr := jm.GetJobHistoryForId(id); herr != nil {
+			if run.update(false, nil) {
+				err = herr
+			}
+		} else if run.update(false, &h) {
+			history = h
+			break
+		}
+		if err == nil {
+			time.Sleep(chainPollInterval)
+		}
+	}
+	if err != nil {
+		result.Error = err.Error()
+		result.Duration = time.Since(started)
+		spinner.Fail(fmt.Sprintf("%s failed: %s", jobLabel(id, title), err))
+		return result
+	}
+
+	result.Duration = time.Since(started)
+	if !history.Start.IsZero() && history.End.After(history.Start) {
+		result.Duration = history.End.Sub(history.Start)
+	}
+	result.Processed = history.Processed
+	result.Error = history.LastError
+	if result.Error != "" {
+		spinner.Fail(fmt.Sprintf("%s finished with error", jobLabel(id, title)))
+		return result
+	}
+	result.Status = "ok"
+	spinner.Success(fmt.Sprintf("%s finished", jobLabel(id, title)))
+	return result
+}
+
+func renderChainResults(results []chainResult) {
+	out := [][]string{{"Job", "Title", "Status", "Duration", "Processed", "Error"}}
+	for _, r := range results {
+		status := pterm.Green(r.Status)
+		switch r.Status {
+		case "failed":
+			status = pterm.Red(r.Status)
+		case "skipped":
+			status = pterm.Gray(r.Status)
+		}
+		duration, processed := "", ""
+		if r.Status != "skipped" {
+			duration = r.Duration.Round(time.Millisecond).String()
+			processed = strconv.Itoa(r.Processed)
+		}
+		out = append(out, []string{r.Id, r.Title, status, duration, processed, r.Error})
+	}
+	pterm.DefaultTable.WithHasHeader().WithData(out).Render()
+	pterm.Println()
+}
@@ -0,0 +1,55 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/franela/goblin"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+)
+
+func TestRunChain(t *testing.T) {
+	g := goblin.Goblin(t)
+	g.Describe("jobs run-chain", func() {
+		before := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+
+		g.It("should not take the history of the run before for the outcome", func() {
+			run := &chainRun{previous: before}
+			stale := &api.JobHistory{Id: "j", Start: before, End: before.Add(time.Minute), LastError: "old failure"}
+			g.Assert(run.update(false, stale)).IsFalse()
+			g.Assert(run.update(true, nil)).IsFalse()
+			g.Assert(run.update(false, stale)).IsFalse()
+
+			fresh := &api.JobHistory{Id: "j", Start: before.Add(time.Hour), End: before.Add(2 * time.Hour)}
+			g.Assert(run.update(false, fresh)).IsTrue()
+		})
+		g.It("should finish without being seen running when the history of the run shows up", func() {
+			run := &chainRun{previous: before}
+			g.Assert(run.update(false, &api.JobHistory{Id: "j", Start: before.Add(time.Second)})).IsTrue()
+		})
+		g.It("should take any history for a job that has not run before", func() {
+			run := &chainRun{}
+			g.Assert(run.update(false, nil)).IsFalse()
+			g.Assert(run.update(false, &api.JobHistory{Id: "j", Start: before})).IsTrue()
+		})
+		g.It("should give up on the history of a job that was seen running but wrote none", func() {
+			run := &chainRun{}
+			g.Assert(run.update(true, nil)).IsFalse()
+			g.Assert(run.update(false, nil)).IsTrue()
+		})
+	})
+}
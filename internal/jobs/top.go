@@ -0,0 +1,381 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"atomicgo.dev/keyboard"
+	"atomicgo.dev/keyboard/keys"
+	"github.com/mimiro-io/datahub-cli/internal/login"
+	"github.com/mimiro-io/datahub-cli/internal/utils"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// TopCmd shows a live dashboard of the jobs on the server
+var TopCmd = &cobra.Command{
+	Use:   "top",
+	Short: "Show a live dashboard of running, failed, slow and paused jobs",
+	Long: `Show a full screen dashboard of the jobs on the server that refreshes by itself. It lists the
+running jobs, the jobs whose last run failed, the slowest jobs and the paused jobs. For example:
+mim jobs top
+or
+mim jobs top --interval 10s --limit 5
+
+Use the arrow keys to select a job, and then:
+  r  run the job
+  p  pause the job
+  u  resume the job
+  x  kill the job, press y to confirm
+  q  quit
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		interval, err := cmd.Flags().GetDuration("interval")
+		utils.HandleError(err)
+		if interval <= 0 {
+			pterm.Error.Println("The interval must be larger than 0")
+			os.Exit(1)
+		}
+		limit, err := cmd.Flags().GetInt("limit")
+		utils.HandleError(err)
+
+		server, token, err := login.ResolveCredentials()
+		utils.HandleError(err)
+
+		top := &jobsTop{
+			server: server,
+			jm:     api.NewJobManager(server, token),
+			limit:  limit,
+		}
+		top.run(interval)
+	},
+	TraverseChildren: true,
+}
+
+func init() {
+	TopCmd.Flags().Duration("interval", 5*time.Second, "How often to refresh the dashboard")
+	TopCmd.Flags().Int("limit", 10, "The number of jobs to show in each section")
+}
+
+// topRow is a line in the dashboard that can be selected
+type topRow struct {
+	id    string
+	cells []string
+}
+
+type topSection struct {
+	title  string
+	header []string
+	rows   []topRow
+}
+
+// buildTopSections sorts the jobs into the sections of the dashboard
+func buildTopSections(items []api.JobOutputViewItem, running []api.JobStatus, now time.Time, limit int) []topSection {
+	titles := make(map[string]string)
+	for _, item := range items {
+		titles[item.Job.Id] = item.Job.Title
+	}
+
+	runningRows := make([]topRow, 0)
+	sort.Slice(running, func(i, j int) bool { return running[i].Started.Before(running[j].Started) })
+	for _, s := range running {
+		title := s.JobTitle
+		if title == "" {
+			title = titles[s.JobId]
+		}
+		runningRows = append(runningRows, topRow{id: s.JobId, cells: []string{
+			s.JobId, title, utils.Date(s.Started), now.Sub(s.Started).Round(time.Second).String(),
+		}})
+	}
+
+	withHistory := make([]api.JobOutputViewItem, 0)
+	paused := make([]topRow, 0)
+	for _, item := range items {
+		if item.History != nil && !item.History.End.IsZero() {
+			withHistory = append(withHistory, item)
+		}
+		if item.Job.Paused {
+			lastRun := ""
+			if item.History != nil {
+				lastRun = utils.Date(item.History.Start)
+			}
+			paused = append(paused, topRow{id: item.Job.Id, cells: []string{item.Job.Id, item.Job.Title, lastRun}})
+		}
+	}
+
+	failed := make([]topRow, 0)
+	sort.Slice(withHistory, func(i, j int) bool { return withHistory[i].History.End.After(withHistory[j].History.End) })
+	for _, item := range withHistory {
+		if item.History.LastError != "" {
+			failed = append(failed, topRow{id: item.Job.Id, cells: []string{
+				item.Job.Id, item.Job.Title, utils.Date(item.History.End), truncateError(item.History.LastError, 60),
+			}})
+		}
+	}
+
+	slowest := make([]topRow, 0)
+	sort.SliceStable(withHistory, func(i, j int) bool {
+		return lastDuration(withHistory[i].History) > lastDuration(withHistory[j].History)
+	})
+	for _, item := range withHistory {
+		slowest = append(slowest, topRow{id: item.Job.Id, cells: []string{
+			item.Job.Id, item.Job.Title, lastDuration(item.History).Round(time.Millisecond).String(), fmt.Sprintf("%d", item.History.Processed),
+		}})
+	}
+
+	return []topSection{
+		{title: "Running", header: []string{"Id", "Title", "Started", "Elapsed"}, rows: limitRows(runningRows, limit)},
+		{title: "Recently failed", header: []string{"Id", "Title", "Ended", "Error"}, rows: limitRows(failed, limit)},
+		{title: "Slowest", header: []string{"Id", "Title", "Last duration", "Processed"}, rows: limitRows(slowest, limit)},
+		{title: "Paused", header: []string{"Id", "Title", "Last run"}, rows: limitRows(paused, limit)},
+	}
+}
+
+func lastDuration(h *api.JobHistory) time.Duration {
+	return h.End.Sub(h.Start)
+}
+
+func limitRows(rows []topRow, limit int) []topRow {
+	if limit > 0 && len(rows) > limit {
+		return rows[:limit]
+	}
+	return rows
+}
+
+// truncateError keeps the first line of an error, cut to at most max characters
+func truncateError(err string, max int) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(err), "\n")
+	runes := []rune(line)
+	if len(runes) > max {
+		return string(runes[:max-3]) + "..."
+	}
+	return line
+}
+
+// jobsTop holds the state of the dashboard, which is shared by the refresh loop and the key handler
+type jobsTop struct {
+	server   string
+	jm       *api.JobManager
+	limit    int
+	mu       sync.Mutex
+	area     *pterm.AreaPrinter
+	sections []topSection
+	updated  time.Time
+	selected int
+	message  string
+	killing  string
+}
+
+func (t *jobsTop) run(interval time.Duration) {
+	t.area, _ = pterm.DefaultArea.WithFullscreen().Start()
+	defer func() {
+		_ = t.area.Stop()
+	}()
+
+	t.refresh()
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				t.refresh()
+			}
+		}
+	}()
+
+	_ = keyboard.Listen(func(key keys.Key) (bool, error) {
+		stop := t.handleKey(key)
+		if !stop {
+			t.render()
+		}
+		return stop, nil
+	})
+	close(done)
+}
+
+// refresh reads the jobs from the server. When that fails, the error is shown and the dashboard keeps
+// the jobs from the last refresh.
+func (t *jobsTop) refresh() {
+	items, err := t.jm.ListJobsWithHistory()
+	if err != nil {
+		t.setMessage(pterm.Red("Could not read the jobs: " + err.Error()))
+		t.render()
+		return
+	}
+	running, err := t.jm.GetJobStatus("")
+
+	t.mu.Lock()
+	if err != nil {
+		t.message = pterm.Red("Could not read the running jobs: " + err.Error())
+	}
+	t.sections = buildTopSections(items, running, time.Now(), t.limit)
+	t.updated = time.Now()
+	if n := len(t.selectable()); t.selected >= n {
+		t.selected = max(n-1, 0)
+	}
+	t.mu.Unlock()
+	t.render()
+}
+
+func (t *jobsTop) selectable() []string {
+	ids := make([]string, 0)
+	for _, s := range t.sections {
+		for _, r := range s.rows {
+			ids = append(ids, r.id)
+		}
+	}
+	return ids
+}
+
+// handleKey moves the selection or operates on the selected job, and returns true to quit
+func (t *jobsTop) handleKey(key keys.Key) bool {
+	t.mu.Lock()
+	ids := t.selectable()
+	selectedId := ""
+	if t.selected < len(ids) {
+		selectedId = ids[t.selected]
+	}
+	killing := t.killing
+	t.killing = ""
+	t.mu.Unlock()
+
+	switch key.Code {
+	case keys.CtrlC, keys.Escape:
+		return true
+	case keys.Up:
+		t.move(-1)
+		return false
+	case keys.Down:
+		t.move(1)
+		return false
+	case keys.RuneKey:
+	default:
+		return false
+	}
+
+	switch key.String() {
+	case "q":
+		return true
+	case "k":
+		t.move(-1)
+	case "j":
+		t.move(1)
+	case "r", "p", "u":
+		if selectedId != "" {
+			t.operate(key.String(), selectedId)
+		}
+	case "x":
+		if selectedId != "" {
+			t.setMessage(pterm.Yellow(fmt.Sprintf("Press y to kill %s", selectedId)))
+			t.mu.Lock()
+			t.killing = selectedId
+			t.mu.Unlock()
+		}
+	case "y":
+		if killing != "" {
+			t.operate("x", killing)
+		}
+	}
+	return false
+}
+
+func (t *jobsTop) move(by int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := len(t.selectable())
+	t.selected = min(max(t.selected+by, 0), max(n-1, 0))
+}
+
+func (t *jobsTop) setMessage(message string) {
+	t.mu.Lock()
+	t.message = message
+	t.mu.Unlock()
+}
+
+func (t *jobsTop) operate(key string, id string) {
+	ctx := context.Background()
+	var err error
+	var done string
+	switch key {
+	case "r":
+		_, err = t.jm.Operate.Run(ctx, id, "")
+		done = "Started"
+	case "p":
+		_, err = t.jm.Operate.Pause(ctx, id)
+		done = "Paused"
+	case "u":
+		_, err = t.jm.Operate.Resume(ctx, id)
+		done = "Resumed"
+	case "x":
+		_, err = t.jm.Operate.Kill(ctx, id)
+		done = "Killed"
+	}
+	if err != nil {
+		t.setMessage(pterm.Red(fmt.Sprintf("Failed on %s: %s", id, err)))
+		return
+	}
+	t.setMessage(pterm.Green(fmt.Sprintf("%s %s", done, id)))
+	go t.refresh()
+}
+
+func (t *jobsTop) render() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b := &strings.Builder{}
+	b.WriteString(pterm.Bold.Sprintf("mim jobs top") + pterm.Gray(fmt.Sprintf("  %s, updated %s", t.server, utils.Date(t.updated))) + "\n")
+	b.WriteString(pterm.Gray("↑/↓ select  r run  p pause  u resume  x kill  q quit") + "\n")
+	if t.message != "" {
+		b.WriteString(t.message + "\n")
+	}
+
+	index := 0
+	for _, s := range t.sections {
+		b.WriteString("\n" + pterm.Cyan(fmt.Sprintf("%s (%d)", s.title, len(s.rows))) + "\n")
+		if len(s.rows) == 0 {
+			b.WriteString(pterm.Gray("  none") + "\n")
+			continue
+		}
+		data := [][]string{append([]string{" "}, s.header...)}
+		for _, r := range s.rows {
+			marker := " "
+			cells := r.cells
+			if index == t.selected {
+				marker = pterm.Yellow(">")
+				cells = make([]string, len(r.cells))
+				for i, c := range r.cells {
+					cells[i] = pterm.Bold.Sprint(c)
+				}
+			}
+			data = append(data, append([]string{marker}, cells...))
+			index++
+		}
+		table, _ := pterm.DefaultTable.WithHasHeader().WithData(data).Srender()
+		b.WriteString(table + "\n")
+	}
+	t.area.Update(b.String())
+}
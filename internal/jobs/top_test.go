@@ -0,0 +1,63 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/franela/goblin"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+)
+
+func TestTop(t *testing.T) {
+	g := goblin.Goblin(t)
+	g.Describe("jobs top", func() {
+		start := time.Date(2026, 10, 1, 10, 0, 0, 0, time.UTC)
+		history := func(id string, took time.Duration, lastError string) *api.JobHistory {
+			return &api.JobHistory{Id: id, Start: start, End: start.Add(took), LastError: lastError}
+		}
+		items := []api.JobOutputViewItem{
+			{Job: api.Job{Id: "a", Title: "A"}, History: history("a", time.Minute, "")},
+			{Job: api.Job{Id: "b", Title: "B", Paused: true}, History: history("b", 5*time.Minute, "boom")},
+			{Job: api.Job{Id: "c", Title: "C"}},
+		}
+		running := []api.JobStatus{{JobId: "c", Started: start}}
+
+		g.It("should sort the jobs into sections", func() {
+			sections := buildTopSections(items, running, start.Add(90*time.Second), 10)
+			ids := func(s topSection) []string {
+				out := make([]string, 0)
+				for _, r := range s.rows {
+					out = append(out, r.id)
+				}
+				return out
+			}
+			g.Assert(ids(sections[0])).Equal([]string{"c"})
+			g.Assert(sections[0].rows[0].cells[3]).Equal("1m30s")
+			g.Assert(ids(sections[1])).Equal([]string{"b"})
+			g.Assert(ids(sections[2])).Equal([]string{"b", "a"})
+			g.Assert(ids(sections[3])).Equal([]string{"b"})
+
+			g.Assert(len(buildTopSections(items, running, start, 1)[2].rows)).Equal(1)
+		})
+
+		g.It("should truncate errors to their first line", func() {
+			g.Assert(truncateError("short\nsecond line", 10)).Equal("short")
+			g.Assert(truncateError(strings.Repeat("x", 20), 10)).Equal("xxxxxxx...")
+		})
+	})
+}
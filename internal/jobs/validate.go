@@ -0,0 +1,242 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/mimiro-io/datahub-cli/internal/login"
+	"github.com/mimiro-io/datahub-cli/internal/utils"
+	"github.com/mimiro-io/datahub-cli/pkg/api"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"github.com/tidwall/pretty"
+)
+
+// ValidateCmd checks job configs without sending them to the server
+var ValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check job configs for mistakes before adding them",
+	Long: `Check job config files for mistakes before adding them to the server. The source, sink and
+transform must be of a known type with the fields it needs, cron triggers must have a valid schedule,
+and onchange triggers must have a dataset to monitor. Unknown fields are reported as warnings, as
+they are often typos. For example:
+mim jobs validate job.json other-job.json
+or
+mim jobs validate -d ./jobs
+
+With --check-datasets, the datasets the jobs read from must exist on the server, or be written by
+one of the jobs that are validated:
+mim jobs validate -d ./jobs --check-datasets
+
+Exits with 1 if any errors are found, or with --strict also on warnings.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		format := utils.ResolveFormat(cmd)
+		if format != "term" {
+			pterm.DisableOutput()
+		}
+
+		pterm.EnableDebugMessages()
+
+		dir, err := cmd.Flags().GetString("dir")
+		utils.HandleError(err)
+		checkDatasets, err := cmd.Flags().GetBool("check-datasets")
+		utils.HandleError(err)
+		strict, err := cmd.Flags().GetBool("strict")
+		utils.HandleError(err)
+
+		files := make([]jobFile, 0)
+		for _, arg := range args {
+			files = append(files, jobFile{config: arg})
+		}
+		if dir != "" {
+			found, err := findJobFiles(dir)
+			utils.HandleError(err)
+			files = append(files, found...)
+		}
+		if len(files) == 0 {
+			pterm.Error.Println("You must provide job config files, or a directory with -d")
+			os.Exit(1)
+		}
+
+		results := make([]validationResult, 0)
+		jobs := make([]*api.Job, 0)
+		jobConfigs := make([]string, 0)
+		for _, f := range files {
+			job, problems := validateJobFile(f)
+			results = append(results, toResults(f.config, job, problems)...)
+			if job != nil {
+				jobs = append(jobs, job)
+				jobConfigs = append(jobConfigs, f.config)
+			}
+		}
+
+		if checkDatasets {
+			server, token, err := login.ResolveCredentials()
+			utils.HandleError(err)
+			datasets, err := api.NewDatasetManager(server, token).List()
+			utils.HandleError(err)
+			names := make([]string, 0, len(datasets))
+			for _, ds := range datasets {
+				names = append(names, ds.Name)
+			}
+			for i, job := range jobs {
+				results = append(results, toResults(jobConfigs[i], job, missingDatasets(job, jobs, names))...)
+			}
+		}
+
+		errors, warnings := 0, 0
+		for _, r := range results {
+			if r.Severity == api.SeverityError {
+				errors++
+			} else {
+				warnings++
+			}
+		}
+
+		if format != "term" {
+			out, err := json.Marshal(results)
+			utils.HandleError(err)
+			if format == "pretty" {
+				out = pretty.Color(pretty.Pretty(out), nil)
+			}
+			fmt.Println(string(out))
+		} else {
+			renderValidation(results)
+			switch {
+			case errors > 0:
+				pterm.Error.Printf("Found %d error(s) and %d warning(s) in %d job config(s)\n", errors, warnings, len(files))
+			case warnings > 0:
+				pterm.Warning.Printf("Found %d warning(s) in %d job config(s)\n", warnings, len(files))
+			default:
+				pterm.Success.Printf("%d job config(s) are valid\n", len(files))
+			}
+			pterm.Println()
+		}
+		if errors > 0 || strict && warnings > 0 {
+			os.Exit(1)
+		}
+	},
+	TraverseChildren: true,
+}
+
+func init() {
+	ValidateCmd.Flags().StringP("dir", "d", "", "A directory with job configs to validate")
+	ValidateCmd.Flags().Bool("check-datasets", false, "Check that the datasets the jobs read from exist on the server")
+	ValidateCmd.Flags().Bool("strict", false, "Exit with 1 on warnings too")
+}
+
+type validationResult struct {
+	File string `json:"file"`
+	Job  string `json:"job"`
+	api.JobProblem
+}
+
+func toResults(file string, job *api.Job, problems []api.JobProblem) []validationResult {
+	id := ""
+	if job != nil {
+		id = job.Id
+	}
+	results := make([]validationResult, 0, len(problems))
+	for _, p := range problems {
+		results = append(results, validationResult{File: file, Job: id, JobProblem: p})
+	}
+	return results
+}
+
+// validateJobFile parses and validates a job config. A transform file next to the config stands in
+// for the transform code, as it is added when the job is applied.
+func validateJobFile(f jobFile) (*api.Job, []api.JobProblem) {
+	data, err := os.ReadFile(f.config)
+	if err != nil {
+		return nil, []api.JobProblem{{Severity: api.SeverityError, Message: err.Error()}}
+	}
+	if f.transform != "" {
+		code, err := os.ReadFile(f.transform)
+		if err != nil {
+			return nil, []api.JobProblem{{Severity: api.SeverityError, Field: "transform", Message: err.Error()}}
+		}
+		job := make(map[string]interface{})
+		if err := json.Unmarshal(data, &job); err == nil {
+			t, _ := job["transform"].(map[string]interface{})
+			if t == nil {
+				t = make(map[string]interface{})
+			}
+			t["Type"] = "JavascriptTransform"
+			t["Code"] = base64.StdEncoding.EncodeToString(code)
+			job["transform"] = t
+			data, _ = json.Marshal(job)
+		}
+	}
+
+	config, problems := api.ParseJobConfig(data)
+	if config == nil {
+		return nil, problems
+	}
+	problems = append(problems, config.Validate()...)
+	job := &api.Job{}
+	_ = json.Unmarshal(data, job)
+	return job, problems
+}
+
+// missingDatasets lists the datasets the job reads that neither exist nor are written by one of the jobs
+func missingDatasets(job *api.Job, jobs []*api.Job, existing []string) []api.JobProblem {
+	written := make(map[string]bool)
+	for _, name := range existing {
+		written[name] = true
+	}
+	for _, j := range jobs {
+		for _, ref := range j.DatasetRefs() {
+			if ref.Role == api.RoleSink {
+				written[ref.Dataset] = true
+			}
+		}
+	}
+
+	problems := make([]api.JobProblem, 0)
+	reported := make(map[string]bool)
+	for _, ref := range job.DatasetRefs() {
+		if ref.Role == api.RoleSink || written[ref.Dataset] || reported[ref.Dataset] {
+			continue
+		}
+		reported[ref.Dataset] = true
+		problems = append(problems, api.JobProblem{
+			Severity: api.SeverityError,
+			Field:    ref.Role,
+			Message:  fmt.Sprintf("dataset '%s' does not exist, and is not written by any of the jobs", ref.Dataset),
+		})
+	}
+	return problems
+}
+
+func renderValidation(results []validationResult) {
+	if len(results) == 0 {
+		return
+	}
+	out := [][]string{{"File", "Job", "Severity", "Field", "Problem"}}
+	for _, r := range results {
+		severity := pterm.Yellow(r.Severity)
+		if r.Severity == api.SeverityError {
+			severity = pterm.Red(r.Severity)
+		}
+		out = append(out, []string{r.File, r.Job, severity, r.Field, r.Message})
+	}
+	pterm.DefaultTable.WithHasHeader().WithData(out).Render()
+	pterm.Println()
+}
@@ -55,6 +55,29 @@ func ResolveCredentials() (string, string, error) {
 	}
 }
 
+// ResolveCredentialsFromAlias returns the server and a valid token for a login alias, or for the
+// active login if the alias is empty.
+func ResolveCredentialsFromAlias(alias string) (string, string, error) {
+	if alias == "" {
+		return ResolveCredentials()
+	}
+	payload, err := getLoginAlias(alias)
+	if errors.Is(err, config.ErrValueNotFound) {
+		return "", "", fmt.Errorf("unknown login alias '%s'", alias)
+	}
+	if err != nil {
+		return "", "", err
+	}
+	if payload.Server == "" {
+		return "", "", fmt.Errorf("unknown login alias '%s'", alias)
+	}
+	tkn, err := web.ResolveCredentialsFromAlias(alias)
+	if err != nil {
+		return "", "", err
+	}
+	return payload.Server, tkn.AccessToken, nil
+}
+
 func getLoginAlias(alias string) (*config.Config, error) {
 	data := &config.Config{}
 	if err := config.Load(alias, data); err != nil {
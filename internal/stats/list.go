@@ -60,7 +60,7 @@ func output(statsBytes []byte, format string) {
 		result := make(map[string]any)
 		err := json.Unmarshal(statsBytes, &result)
 		utils.HandleError(err)
-		rows := toRows(result)
+		rows := ToRows(result)
 
 		out := make([][]string, 0)
 		out = append(out, []string{"Dataset", "Changes", "Entities", "Refs", "Keys size",
@@ -186,7 +186,9 @@ func toSystemStats(result map[string]any) (int64, int64, int64) {
 	return keyCount, keySize, valueSize
 }
 
-func toRows(result map[string]any) map[string][7]int64 {
+// ToRows sums the statistics for each dataset into changes, entities, refs, the size of entity keys,
+// the size of entity values and the size of ref keys
+func ToRows(result map[string]any) map[string][7]int64 {
 	ents, _ := result["entity"].(map[string]any)
 	rows := map[string][7]int64{}
 	for ix, sub := range ents {
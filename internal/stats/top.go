@@ -47,7 +47,7 @@ func topOutput(statsBytes []byte, format string) {
 		result := make(map[string]any)
 		err := json.Unmarshal(statsBytes, &result)
 		utils.HandleError(err)
-		rows := toRows(result)
+		rows := ToRows(result)
 
 		var totals [7]int64
 		out := make([][]string, 0)
@@ -77,22 +77,35 @@ mim transform export <my-job> > out.js
 }
 
 func output(job *api.Job) {
-	if job.Transform != nil {
-		if transform, ok := job.Transform["Code"]; ok {
-			out, err := base64.StdEncoding.DecodeString(transform.(string))
-			utils.HandleError(err)
-
-			// we should readd the export function part
-			js := string(out)
-			index := strings.Index(js, export)
-			if index > -1 {
-				js = js[:index] + "export " + js[index:]
-			}
-
-			fmt.Println(js)
-		}
+	js, err := DecodeTransform(job)
+	utils.HandleError(err)
+	if js != "" {
+		fmt.Println(js)
 	}
+}
 
+// DecodeTransform returns the transform of a job as javascript, with the export of the transform
+// function added back so that it can be imported again. It returns an empty string if the job has no transform.
+func DecodeTransform(job *api.Job) (string, error) {
+	if job.Transform == nil {
+		return "", nil
+	}
+	transform, ok := job.Transform["Code"].(string)
+	if !ok {
+		return "", nil
+	}
+	out, err := base64.StdEncoding.DecodeString(transform)
+	if err != nil {
+		return "", err
+	}
+
+	// we should readd the export function part
+	js := string(out)
+	index := strings.Index(js, export)
+	if index > -1 {
+		js = js[:index] + "export " + js[index:]
+	}
+	return js, nil
 }
 
 func init() {
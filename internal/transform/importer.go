@@ -24,6 +24,7 @@ import (
 	"github.com/pterm/pterm"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 )
 
@@ -38,6 +39,32 @@ func NewImporter(file string) *Importer {
 }
 
 func (imp *Importer) ImportJs() ([]byte, error) {
+	code, err := imp.compileJs()
+	if err != nil {
+		return nil, err
+	}
+	pterm.Println(string(code))
+
+	return code, nil
+}
+
+func (imp *Importer) ImportTs() ([]byte, error) {
+	code, err := imp.compileTs()
+
+	pterm.Println(string(code))
+	return code, err
+}
+
+// Compile builds the transform file with the typescript or javascript toolchain depending
+// on its extension. Unlike ImportJs and ImportTs it does not echo the compiled code.
+func (imp *Importer) Compile() ([]byte, error) {
+	if filepath.Ext(imp.file) == ".ts" {
+		return imp.compileTs()
+	}
+	return imp.compileJs()
+}
+
+func (imp *Importer) compileJs() ([]byte, error) {
 	result, err := imp.buildCode()
 	if err != nil {
 		return nil, err
@@ -45,20 +72,14 @@ func (imp *Importer) ImportJs() ([]byte, error) {
 
 	transform := result.OutputFiles[0]
 
-	code := imp.fix(string(transform.Contents))
-	pterm.Println(code)
-
-	return []byte(code), nil
+	return []byte(imp.fix(string(transform.Contents))), nil
 }
 
-func (imp *Importer) ImportTs() ([]byte, error) {
+func (imp *Importer) compileTs() ([]byte, error) {
 	VerifyNodeInstallation(imp)
 
 	typescriptCmd := []string{"npx", "tt", imp.file}
-	code, err := imp.Cmd(typescriptCmd)
-
-	pterm.Println(string(code))
-	return code, err
+	return imp.Cmd(typescriptCmd)
 }
 
 func VerifyNodeInstallation(imp *Importer) {
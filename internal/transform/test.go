@@ -28,7 +28,6 @@ import (
 	"github.com/pterm/pterm"
 	"github.com/spf13/cobra"
 
-	"github.com/mimiro-io/datahub-cli/internal/datasets"
 	"github.com/mimiro-io/datahub-cli/internal/login"
 	"github.com/mimiro-io/datahub-cli/internal/utils"
 )
@@ -273,7 +272,7 @@ func getEntities(server string, token string, dataset string, limit int) ([]*api
 		em := api.NewEntityManager(server, token, context.Background(), api.Changes)
 		collector := &api.CollectorSink{}
 
-		err := em.Read(dataset, "", datasets.SaneLimit("json", limit), false, collector)
+		err := em.Read(dataset, "", limit, false, collector)
 		if err != nil {
 			return nil, err
 		}
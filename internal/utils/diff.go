@@ -0,0 +1,133 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pterm/pterm"
+)
+
+// DiffLine is a single line in a diff. Op is "+" for added, "-" for removed and " " for unchanged lines.
+type DiffLine struct {
+	Op   string
+	Text string
+}
+
+// Diff returns a line based diff between two texts, based on the longest common subsequence of lines.
+func Diff(before string, after string) []DiffLine {
+	a := strings.Split(before, "\n")
+	b := strings.Split(after, "\n")
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	lines := make([]DiffLine, 0)
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, DiffLine{Op: " ", Text: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, DiffLine{Op: "-", Text: a[i]})
+			i++
+		default:
+			lines = append(lines, DiffLine{Op: "+", Text: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, DiffLine{Op: "-", Text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, DiffLine{Op: "+", Text: b[j]})
+	}
+	return lines
+}
+
+// HasChanges returns true if the diff contains added or removed lines
+func HasChanges(lines []DiffLine) bool {
+	for _, l := range lines {
+		if l.Op != " " {
+			return true
+		}
+	}
+	return false
+}
+
+// RenderDiff prints the changed lines of a diff with the given number of unchanged lines around them
+func RenderDiff(lines []DiffLine, context int) {
+	show := make([]bool, len(lines))
+	for i, l := range lines {
+		if l.Op == " " {
+			continue
+		}
+		for k := i - context; k <= i+context; k++ {
+			if k >= 0 && k < len(lines) {
+				show[k] = true
+			}
+		}
+	}
+
+	skipped := false
+	for i, l := range lines {
+		if !show[i] {
+			skipped = true
+			continue
+		}
+		if skipped {
+			pterm.Println(pterm.Gray("  ..."))
+			skipped = false
+		}
+		switch l.Op {
+		case "+":
+			pterm.Println(pterm.Green("+ " + l.Text))
+		case "-":
+			pterm.Println(pterm.Red("- " + l.Text))
+		default:
+			pterm.Println("  " + l.Text)
+		}
+	}
+}
+
+// DiffJSON diffs the indented json representation of two values
+func DiffJSON(before interface{}, after interface{}) ([]DiffLine, error) {
+	a, err := json.MarshalIndent(before, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.MarshalIndent(after, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return Diff(string(a), string(b)), nil
+}
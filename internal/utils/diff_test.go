@@ -0,0 +1,48 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+func TestDiff(t *testing.T) {
+	g := goblin.Goblin(t)
+	g.Describe("line diff", func() {
+		g.It("should keep unchanged lines", func() {
+			lines := Diff("a\nb", "a\nb")
+			g.Assert(HasChanges(lines)).IsFalse()
+		})
+		g.It("should show replaced lines", func() {
+			lines := Diff("a\nb\nc", "a\nx\nc")
+			g.Assert(lines).Equal([]DiffLine{
+				{Op: " ", Text: "a"},
+				{Op: "-", Text: "b"},
+				{Op: "+", Text: "x"},
+				{Op: " ", Text: "c"},
+			})
+		})
+		g.It("should show added and removed lines at the ends", func() {
+			lines := Diff("a\nb", "b\nc")
+			g.Assert(lines).Equal([]DiffLine{
+				{Op: "-", Text: "a"},
+				{Op: " ", Text: "b"},
+				{Op: "+", Text: "c"},
+			})
+		})
+	})
+}
@@ -27,6 +27,22 @@ import (
 
 const userAgent = "mim_cli/1.0"
 
+// StatusError is returned by GetRequest when the server answers with another status than 200 OK
+type StatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return "Got http status " + e.Status
+}
+
+// IsNotFound tells if the error is from the server answering 404 Not Found
+func IsNotFound(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound
+}
+
 func sendRequest(method string, server string, token string, path string, content []byte, headers map[string]string, timeout time.Duration) ([]byte, error) {
 	req, err := http.NewRequest(method, fmt.Sprintf("%s%s", server, path), bytes.NewBuffer(content))
 
@@ -141,7 +157,7 @@ func GetRequest(server string, token string, path string) ([]byte, error) {
 		}
 		return bodyBytes, nil
 	} else {
-		return nil, errors.New("Got http status " + resp.Status)
+		return nil, &StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
 	}
 
 }
@@ -0,0 +1,65 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/franela/goblin"
+)
+
+func TestParseSchedule(t *testing.T) {
+	g := goblin.Goblin(t)
+	at := func(s string) time.Time {
+		v, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			g.Fail(err)
+		}
+		return v
+	}
+	next := func(spec string, from string) string {
+		s, err := ParseSchedule(spec)
+		g.Assert(err).IsNil()
+		return s.Next(at(from)).Format(time.RFC3339)
+	}
+	g.Describe("cron schedules", func() {
+		g.It("should find the next time of five field schedules", func() {
+			g.Assert(next("*/15 * * * *", "2026-10-19T10:07:30Z")).Equal("2026-10-19T10:15:00Z")
+			g.Assert(next("0 2 * * *", "2026-10-19T10:07:00Z")).Equal("2026-10-20T02:00:00Z")
+			g.Assert(next("30 8 * * mon-fri", "2026-10-23T09:00:00Z")).Equal("2026-10-26T08:30:00Z")
+			g.Assert(next("0 0 1 jan *", "2026-10-19T00:00:00Z")).Equal("2027-01-01T00:00:00Z")
+			g.Assert(next("0 12 * * 7", "2026-10-19T00:00:00Z")).Equal("2026-10-25T12:00:00Z")
+		})
+		g.It("should match either day field when both are given", func() {
+			g.Assert(next("0 0 1 * 1", "2026-10-19T12:00:00Z")).Equal("2026-10-26T00:00:00Z")
+			g.Assert(next("0 0 1 * 1", "2026-10-27T12:00:00Z")).Equal("2026-11-01T00:00:00Z")
+		})
+		g.It("should read seconds, descriptors and intervals", func() {
+			g.Assert(next("*/10 * * * * *", "2026-10-19T10:00:05Z")).Equal("2026-10-19T10:00:10Z")
+			g.Assert(next("@hourly", "2026-10-19T10:07:00Z")).Equal("2026-10-19T11:00:00Z")
+			g.Assert(next("@every 5m", "2026-10-19T10:07:00Z")).Equal("2026-10-19T10:12:00Z")
+		})
+		g.It("should run in the given time zone", func() {
+			g.Assert(next("CRON_TZ=Europe/Oslo 0 6 * * *", "2026-10-19T10:00:00Z")).Equal("2026-10-20T04:00:00Z")
+		})
+		g.It("should refuse invalid schedules", func() {
+			for _, spec := range []string{"", "* * * *", "61 * * * *", "* * * foo *", "5-1 * * * *", "*/0 * * * *", "@often", "@every 5x"} {
+				_, err := ParseSchedule(spec)
+				g.Assert(err == nil).IsFalse(spec)
+			}
+		})
+	})
+}
@@ -20,6 +20,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/url"
@@ -290,15 +291,24 @@ type Sink interface {
 }
 
 type RawSink struct {
+	// Out is where the entities are written, it defaults to stdout
+	Out          io.Writer
 	header       bool
 	footer       bool
 	continuation *Entity
 	isFirst      bool
 }
 
+func (s *RawSink) out() io.Writer {
+	if s.Out == nil {
+		return os.Stdout
+	}
+	return s.Out
+}
+
 func (s *RawSink) Start() {
 	s.isFirst = true
-	_, _ = os.Stdout.Write([]byte("["))
+	_, _ = s.out().Write([]byte("["))
 }
 
 func (s *RawSink) End() {
@@ -307,10 +317,10 @@ func (s *RawSink) End() {
 		c["id"] = "@continuation"
 		out, err := json.Marshal(c)
 		if err == nil {
-			_, _ = os.Stdout.Write(out)
+			_, _ = s.out().Write(out)
 		}
 	}
-	_, _ = os.Stdout.Write([]byte("]\n"))
+	_, _ = s.out().Write([]byte("]\n"))
 }
 
 func (s *RawSink) ProcessEntities(entities []*Entity) error {
@@ -318,7 +328,7 @@ func (s *RawSink) ProcessEntities(entities []*Entity) error {
 		if s.isFirst {
 			s.isFirst = false
 		} else {
-			_, _ = os.Stdout.Write([]byte(","))
+			_, _ = s.out().Write([]byte(","))
 		}
 		var layer []byte
 		var err error
@@ -335,7 +345,7 @@ func (s *RawSink) ProcessEntities(entities []*Entity) error {
 			return err
 		}
 		if layer != nil {
-			_, _ = os.Stdout.Write(layer)
+			_, _ = s.out().Write(layer)
 		}
 	}
 	return nil
@@ -550,6 +560,12 @@ func (em *EntityManager) Read(dataset string, since string, limit int, reverse b
 	return pipeline.Sync(em.ctx, since, limit)
 }
 
+// ReadAll streams every entity of the dataset to the sink. The hub is called without a limit, so
+// everything arrives in a single response, and is handed to the sink in batches.
+func (em *EntityManager) ReadAll(dataset string, since string, sink Sink) error {
+	return em.Read(dataset, since, 0, false, sink)
+}
+
 func (em *EntityManager) buildUrl(server string, dataset string, t DatasetType, limit int, reverse bool,
 ) (*url.URL, error) {
 	endpoint, err := url.Parse(fmt.Sprintf("%s/datasets/%s/%s", server, dataset, t))
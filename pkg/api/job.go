@@ -15,6 +15,7 @@
 package api
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -186,14 +187,24 @@ func (jm *JobManager) GetJobStatus(jobId string) ([]JobStatus, error) {
 }
 
 func (jm *JobManager) GetJobHistories() []JobHistory {
-	body, err := web.GetRequest(jm.server, jm.token, "/jobs/_/history")
+	histories, err := jm.ListJobHistories()
 	utils.HandleError(err)
+	return histories
+}
+
+// ListJobHistories is like GetJobHistories, but returns errors instead of exiting
+func (jm *JobManager) ListJobHistories() ([]JobHistory, error) {
+	body, err := web.GetRequest(jm.server, jm.token, "/jobs/_/history")
+	if err != nil {
+		return nil, err
+	}
 
 	histories := make([]JobHistory, 0)
 	err = json.Unmarshal(body, &histories)
-	utils.HandleError(err)
-
-	return histories
+	if err != nil {
+		return nil, err
+	}
+	return histories, nil
 }
 
 func (jm *JobManager) GetJobHistoryForId(id string) (JobHistory, error) {
@@ -262,19 +273,65 @@ func (jm *JobManager) ResolveIds(titles ...string) []JobId {
 }
 
 func (jm *JobManager) GetJobs() []Job {
-	allJobs, err := web.GetRequest(jm.server, jm.token, "/jobs")
+	jobList, err := jm.ListJobs()
 	utils.HandleError(err)
+	return jobList
+}
+
+// ListJobs is like GetJobs, but returns errors instead of exiting
+func (jm *JobManager) ListJobs() ([]Job, error) {
+	allJobs, err := web.GetRequest(jm.server, jm.token, "/jobs")
+	if err != nil {
+		return nil, err
+	}
 
 	jobList := make([]Job, 0)
 	err = json.Unmarshal(allJobs, &jobList)
-	utils.HandleError(err)
+	if err != nil {
+		return nil, err
+	}
+	return jobList, nil
+}
 
-	return jobList
+// ListJobConfigs returns the job configs as they are stored on the server, with every field kept
+// and numbers as json.Number, so they can be changed and posted back without losing anything
+func (jm *JobManager) ListJobConfigs() ([]map[string]interface{}, error) {
+	allJobs, err := web.GetRequest(jm.server, jm.token, "/jobs")
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseJobConfigs(allJobs)
+}
+
+// ParseJobConfigs decodes a list of job configs as they are stored, keeping numbers as they are
+// written and the fields the Job type does not have
+func ParseJobConfigs(data []byte) ([]map[string]interface{}, error) {
+	configs := make([]map[string]interface{}, 0)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&configs); err != nil {
+		return nil, err
+	}
+	return configs, nil
 }
 
 func (jm *JobManager) GetJobListWithHistory() []JobOutputViewItem {
-	histories := jm.GetJobHistories()
-	jobs := jm.GetJobs()
+	output, err := jm.ListJobsWithHistory()
+	utils.HandleError(err)
+	return output
+}
+
+// ListJobsWithHistory is like GetJobListWithHistory, but returns errors instead of exiting
+func (jm *JobManager) ListJobsWithHistory() ([]JobOutputViewItem, error) {
+	histories, err := jm.ListJobHistories()
+	if err != nil {
+		return nil, err
+	}
+	jobs, err := jm.ListJobs()
+	if err != nil {
+		return nil, err
+	}
 
 	historyMap := make(map[string]JobHistory)
 	for _, jh := range histories {
@@ -304,5 +361,5 @@ func (jm *JobManager) GetJobListWithHistory() []JobOutputViewItem {
 		}
 		output = append(output, out)
 	}
-	return output
+	return output, nil
 }
@@ -0,0 +1,407 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const (
+	TriggerCron     = "cron"
+	TriggerOnChange = "onchange"
+	JobFullSync     = "fullsync"
+	JobIncremental  = "incremental"
+
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// DatasetSourceConfig reads the changes of a dataset
+type DatasetSourceConfig struct {
+	Type       string `json:"Type"`
+	Name       string `json:"Name"`
+	LatestOnly bool   `json:"LatestOnly,omitempty"`
+}
+
+// MultiSourceConfig reads a dataset, and the entities of other datasets that change and are joined to it
+type MultiSourceConfig struct {
+	Type         string                  `json:"Type"`
+	Name         string                  `json:"Name"`
+	LatestOnly   bool                    `json:"LatestOnly,omitempty"`
+	Dependencies []MultiSourceDependency `json:"Dependencies,omitempty"`
+}
+
+type MultiSourceDependency struct {
+	Dataset string            `json:"dataset"`
+	Joins   []MultiSourceJoin `json:"joins"`
+}
+
+type MultiSourceJoin struct {
+	Dataset   string `json:"dataset"`
+	Predicate string `json:"predicate"`
+	Inverse   bool   `json:"inverse,omitempty"`
+}
+
+// UnionDatasetSourceConfig reads the changes of several datasets as one
+type UnionDatasetSourceConfig struct {
+	Type           string                `json:"Type"`
+	DatasetSources []DatasetSourceConfig `json:"DatasetSources"`
+	LatestOnly     bool                  `json:"LatestOnly,omitempty"`
+}
+
+// HttpDatasetSourceConfig reads a dataset from a remote server speaking the datahub protocol
+type HttpDatasetSourceConfig struct {
+	Type          string `json:"Type"`
+	Url           string `json:"Url"`
+	TokenProvider string `json:"TokenProvider,omitempty"`
+	LatestOnly    bool   `json:"LatestOnly,omitempty"`
+}
+
+// SampleSourceConfig generates entities, for testing
+type SampleSourceConfig struct {
+	Type             string `json:"Type"`
+	NumberOfEntities int    `json:"NumberOfEntities"`
+	BatchSize        int    `json:"BatchSize,omitempty"`
+}
+
+// SlowSourceConfig generates entities slowly, for testing
+type SlowSourceConfig struct {
+	Type      string `json:"Type"`
+	BatchSize int    `json:"BatchSize,omitempty"`
+	Sleep     string `json:"Sleep,omitempty"`
+}
+
+// DatasetSinkConfig writes to a dataset
+type DatasetSinkConfig struct {
+	Type string `json:"Type"`
+	Name string `json:"Name"`
+}
+
+// HttpDatasetSinkConfig posts to a remote endpoint
+type HttpDatasetSinkConfig struct {
+	Type          string `json:"Type"`
+	Url           string `json:"Url"`
+	TokenProvider string `json:"TokenProvider,omitempty"`
+}
+
+// ConsoleSinkConfig logs the entities on the server
+type ConsoleSinkConfig struct {
+	Type     string `json:"Type"`
+	Prefix   string `json:"Prefix,omitempty"`
+	Detailed bool   `json:"Detailed,omitempty"`
+}
+
+// DevNullSinkConfig throws the entities away
+type DevNullSinkConfig struct {
+	Type string `json:"Type"`
+}
+
+// JavascriptTransformConfig runs a base64 encoded javascript transform
+type JavascriptTransformConfig struct {
+	Type        string `json:"Type"`
+	Code        string `json:"Code"`
+	Parallelism int    `json:"Parallelism,omitempty"`
+}
+
+// HttpTransformConfig posts the entities to a remote endpoint that returns the transformed entities
+type HttpTransformConfig struct {
+	Type          string `json:"Type"`
+	Url           string `json:"Url"`
+	TokenProvider string `json:"TokenProvider,omitempty"`
+	TimeOut       int    `json:"TimeOut,omitempty"`
+}
+
+// JobConfig is a job with typed source, sink and transform. Source, Sink and Transform hold one of
+// the *Config types above, or nil if they are missing or of an unknown type.
+type JobConfig struct {
+	Id          string
+	Title       string
+	Description string
+	Tags        []string
+	Source      interface{}
+	Sink        interface{}
+	Transform   interface{}
+	Triggers    []JobTrigger
+	Paused      bool
+	BatchSize   int
+}
+
+// JobProblem is something wrong with a job config. Errors will make the job fail, warnings are
+// likely mistakes.
+type JobProblem struct {
+	Severity string `json:"severity"`
+	Field    string `json:"field"`
+	Message  string `json:"message"`
+}
+
+func (p JobProblem) String() string {
+	return fmt.Sprintf("%s: %s", p.Field, p.Message)
+}
+
+var sourceTypes = map[string]func() interface{}{
+	"DatasetSource":      func() interface{} { return &DatasetSourceConfig{} },
+	"MultiSource":        func() interface{} { return &MultiSourceConfig{} },
+	"UnionDatasetSource": func() interface{} { return &UnionDatasetSourceConfig{} },
+	"HttpDatasetSource":  func() interface{} { return &HttpDatasetSourceConfig{} },
+	"SampleSource":       func() interface{} { return &SampleSourceConfig{} },
+	"SlowSource":         func() interface{} { return &SlowSourceConfig{} },
+}
+
+var sinkTypes = map[string]func() interface{}{
+	"DatasetSink":     func() interface{} { return &DatasetSinkConfig{} },
+	"HttpDatasetSink": func() interface{} { return &HttpDatasetSinkConfig{} },
+	"ConsoleSink":     func() interface{} { return &ConsoleSinkConfig{} },
+	"DevNullSink":     func() interface{} { return &DevNullSinkConfig{} },
+}
+
+var transformTypes = map[string]func() interface{}{
+	"JavascriptTransform": func() interface{} { return &JavascriptTransformConfig{} },
+	"HttpTransform":       func() interface{} { return &HttpTransformConfig{} },
+}
+
+// jobConfigFields are the fields the datahub reads from a job config
+var jobConfigFields = []string{"id", "title", "description", "tags", "source", "sink", "transform", "triggers", "paused", "batchSize"}
+
+// ParseJobConfig reads a job config into typed models, and lists the problems found on the way,
+// such as unknown fields and unknown source, sink and transform types.
+func ParseJobConfig(data []byte) (*JobConfig, []JobProblem) {
+	problems := make([]JobProblem, 0)
+	raw := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, append(problems, JobProblem{SeverityError, "", "not a valid json object: " + err.Error()})
+	}
+	for _, key := range sortedRawKeys(raw) {
+		if !containsField(jobConfigFields, key) {
+			problems = append(problems, JobProblem{SeverityWarning, key, "unknown field, it is ignored by the datahub"})
+		}
+	}
+
+	job := &Job{}
+	if err := json.Unmarshal(data, job); err != nil {
+		return nil, append(problems, JobProblem{SeverityError, "", err.Error()})
+	}
+	config := &JobConfig{
+		Id:          job.Id,
+		Title:       job.Title,
+		Description: job.Description,
+		Tags:        job.Tags,
+		Triggers:    job.Triggers,
+		Paused:      job.Paused,
+		BatchSize:   job.BatchSize,
+	}
+	var p []JobProblem
+	config.Source, p = decodeTyped("source", job.Source, sourceTypes)
+	problems = append(problems, p...)
+	config.Sink, p = decodeTyped("sink", job.Sink, sinkTypes)
+	problems = append(problems, p...)
+	if job.Transform != nil {
+		config.Transform, p = decodeTyped("transform", job.Transform, transformTypes)
+		problems = append(problems, p...)
+	}
+	return config, problems
+}
+
+// decodeTyped picks the model from the Type of the config, and decodes the config into it
+func decodeTyped(field string, config map[string]interface{}, types map[string]func() interface{}) (interface{}, []JobProblem) {
+	if config == nil {
+		return nil, []JobProblem{{SeverityError, field, "is missing"}}
+	}
+	typeName, _ := config["Type"].(string)
+	if typeName == "" {
+		return nil, []JobProblem{{SeverityError, field + ".Type", "is missing"}}
+	}
+	newModel, ok := types[typeName]
+	if !ok {
+		known := make([]string, 0, len(types))
+		for k := range types {
+			known = append(known, k)
+		}
+		sort.Strings(known)
+		return nil, []JobProblem{{SeverityError, field + ".Type", fmt.Sprintf("unknown type '%s', expected one of %s", typeName, strings.Join(known, ", "))}}
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, []JobProblem{{SeverityError, field, err.Error()}}
+	}
+	model := newModel()
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(model); err != nil {
+		// decode again without the check, so that the other fields can still be validated
+		_ = json.Unmarshal(data, model)
+		msg := err.Error()
+		if strings.HasPrefix(msg, "json: unknown field ") {
+			msg = "unknown field " + strings.TrimPrefix(msg, "json: unknown field ") + " for " + typeName
+			return model, []JobProblem{{SeverityWarning, field, msg}}
+		}
+		return model, []JobProblem{{SeverityError, field, strings.TrimPrefix(msg, "json: ")}}
+	}
+	return model, nil
+}
+
+// Validate checks the job config for missing and invalid values, and for triggers that can not work
+func (c *JobConfig) Validate() []JobProblem {
+	problems := make([]JobProblem, 0)
+	add := func(severity string, field string, format string, args ...interface{}) {
+		problems = append(problems, JobProblem{severity, field, fmt.Sprintf(format, args...)})
+	}
+
+	if c.Id == "" {
+		add(SeverityError, "id", "is missing")
+	}
+	if c.Title == "" {
+		add(SeverityWarning, "title", "is missing, the id is shown instead")
+	}
+	if c.BatchSize < 0 {
+		add(SeverityError, "batchSize", "can not be negative")
+	}
+
+	switch s := c.Source.(type) {
+	case *DatasetSourceConfig:
+		requireName(add, "source.Name", s.Name)
+	case *MultiSourceConfig:
+		requireName(add, "source.Name", s.Name)
+		for i, dep := range s.Dependencies {
+			field := fmt.Sprintf("source.Dependencies[%d]", i)
+			requireName(add, field+".dataset", dep.Dataset)
+			if len(dep.Joins) == 0 {
+				add(SeverityError, field+".joins", "needs at least one join")
+			}
+			for j, join := range dep.Joins {
+				jf := fmt.Sprintf("%s.joins[%d]", field, j)
+				requireName(add, jf+".dataset", join.Dataset)
+				if join.Predicate == "" {
+					add(SeverityError, jf+".predicate", "is missing")
+				}
+			}
+		}
+	case *UnionDatasetSourceConfig:
+		if len(s.DatasetSources) == 0 {
+			add(SeverityError, "source.DatasetSources", "needs at least one dataset source")
+		}
+		for i, ds := range s.DatasetSources {
+			requireName(add, fmt.Sprintf("source.DatasetSources[%d].Name", i), ds.Name)
+		}
+	case *HttpDatasetSourceConfig:
+		requireUrl(add, "source.Url", s.Url)
+	case *SampleSourceConfig:
+		if s.NumberOfEntities < 1 {
+			add(SeverityError, "source.NumberOfEntities", "must be at least 1")
+		}
+	}
+
+	switch s := c.Sink.(type) {
+	case *DatasetSinkConfig:
+		requireName(add, "sink.Name", s.Name)
+	case *HttpDatasetSinkConfig:
+		requireUrl(add, "sink.Url", s.Url)
+	}
+
+	switch t := c.Transform.(type) {
+	case *JavascriptTransformConfig:
+		if t.Code == "" {
+			add(SeverityError, "transform.Code", "is missing")
+		} else if _, err := base64.StdEncoding.DecodeString(t.Code); err != nil {
+			add(SeverityError, "transform.Code", "is not base64 encoded")
+		}
+		if t.Parallelism < 0 {
+			add(SeverityError, "transform.Parallelism", "can not be negative")
+		}
+	case *HttpTransformConfig:
+		requireUrl(add, "transform.Url", t.Url)
+	}
+
+	if len(c.Triggers) == 0 {
+		add(SeverityError, "triggers", "needs at least one trigger")
+	}
+	for i, trigger := range c.Triggers {
+		field := fmt.Sprintf("triggers[%d]", i)
+		switch trigger.JobType {
+		case JobFullSync, JobIncremental:
+		case "":
+			add(SeverityWarning, field+".jobType", "is missing, the default of the datahub is used")
+		default:
+			add(SeverityError, field+".jobType", "unknown job type '%s', use %s or %s", trigger.JobType, JobFullSync, JobIncremental)
+		}
+		switch trigger.TriggerType {
+		case TriggerCron:
+			if trigger.Schedule == "" {
+				add(SeverityError, field+".schedule", "is missing, a cron trigger needs a schedule")
+			} else if _, err := ParseSchedule(trigger.Schedule); err != nil {
+				add(SeverityError, field+".schedule", "%s", err.Error())
+			}
+			if trigger.MonitoredDataset != "" {
+				add(SeverityWarning, field+".monitoredDataset", "is ignored by a cron trigger")
+			}
+		case TriggerOnChange:
+			if trigger.MonitoredDataset == "" {
+				add(SeverityError, field+".monitoredDataset", "is missing, an onchange trigger needs a dataset to monitor")
+			}
+			if trigger.Schedule != "" {
+				add(SeverityWarning, field+".schedule", "is ignored by an onchange trigger")
+			}
+		case "":
+			add(SeverityError, field+".triggerType", "is missing, use %s or %s", TriggerCron, TriggerOnChange)
+		default:
+			add(SeverityError, field+".triggerType", "unknown trigger type '%s', use %s or %s", trigger.TriggerType, TriggerCron, TriggerOnChange)
+		}
+	}
+	return problems
+}
+
+func requireName(add func(string, string, string, ...interface{}), field string, name string) {
+	if name == "" {
+		add(SeverityError, field, "is missing")
+	} else if strings.ContainsAny(name, " \t/") {
+		add(SeverityWarning, field, "'%s' is not a valid dataset name", name)
+	}
+}
+
+func requireUrl(add func(string, string, string, ...interface{}), field string, value string) {
+	if value == "" {
+		add(SeverityError, field, "is missing")
+		return
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		add(SeverityError, field, "'%s' is not an absolute url", value)
+	}
+}
+
+func sortedRawKeys(m map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// containsField compares like encoding/json does, without case
+func containsField(fields []string, field string) bool {
+	for _, f := range fields {
+		if strings.EqualFold(f, field) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+func TestJobConfig(t *testing.T) {
+	g := goblin.Goblin(t)
+	problemsOf := func(config string) []string {
+		c, problems := ParseJobConfig([]byte(config))
+		if c != nil {
+			problems = append(problems, c.Validate()...)
+		}
+		out := make([]string, 0)
+		for _, p := range problems {
+			out = append(out, p.Severity+" "+p.String())
+		}
+		return out
+	}
+	g.Describe("job config validation", func() {
+		g.It("should accept a valid job", func() {
+			g.Assert(problemsOf(`{"id":"a","title":"A",
+				"source":{"Type":"MultiSource","Name":"people.Person","Dependencies":[{"dataset":"people.Address","joins":[{"dataset":"people.Person","predicate":"ns3:address","inverse":true}]}]},
+				"sink":{"Type":"DatasetSink","Name":"people.Merged"},
+				"transform":{"Type":"JavascriptTransform","Code":"ZnVuY3Rpb24geCgpIHt9"},
+				"triggers":[{"triggerType":"cron","jobType":"incremental","schedule":"@every 5m"},{"triggerType":"onchange","jobType":"incremental","monitoredDataset":"people.Person"}]}`)).Equal([]string{})
+		})
+		g.It("should type the source, sink and transform", func() {
+			c, _ := ParseJobConfig([]byte(`{"id":"a","source":{"Type":"DatasetSource","Name":"x"},"sink":{"Type":"HttpDatasetSink","Url":"http://h/x"}}`))
+			g.Assert(c.Source.(*DatasetSourceConfig).Name).Equal("x")
+			g.Assert(c.Sink.(*HttpDatasetSinkConfig).Url).Equal("http://h/x")
+			g.Assert(c.Transform == nil).IsTrue()
+		})
+		g.It("should report typos and missing values", func() {
+			g.Assert(problemsOf(`{"id":"a","title":"A","sorce":{},
+				"sink":{"Type":"DatasetSinks","Name":"x"},
+				"triggers":[{"triggerType":"cron","jobType":"full","schedule":"0 25 * * *"},{"triggerType":"onchange","jobType":"incremental"}]}`)).Equal([]string{
+				"warning sorce: unknown field, it is ignored by the datahub",
+				"error source: is missing",
+				"error sink.Type: unknown type 'DatasetSinks', expected one of ConsoleSink, DatasetSink, DevNullSink, HttpDatasetSink",
+				"error triggers[0].jobType: unknown job type 'full', use fullsync or incremental",
+				"error triggers[0].schedule: hour value 25 is outside 0-23",
+				"error triggers[1].monitoredDataset: is missing, an onchange trigger needs a dataset to monitor",
+			})
+		})
+		g.It("should report unknown and missing fields of a known type", func() {
+			g.Assert(problemsOf(`{"id":"a","title":"A","source":{"Type":"DatasetSource","Nme":"x"},"sink":{"Type":"DevNullSink"},
+				"triggers":[{"triggerType":"cron","jobType":"fullsync","schedule":"@daily"}]}`)).Equal([]string{
+				"warning source: unknown field \"Nme\" for DatasetSource",
+				"error source.Name: is missing",
+			})
+		})
+	})
+}
@@ -0,0 +1,157 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import "encoding/json"
+
+const (
+	RoleSource     = "source"
+	RoleDependency = "dependency"
+	RoleSink       = "sink"
+	RoleTrigger    = "trigger"
+)
+
+// JobDatasetRef is a place in a job config that refers to a dataset
+type JobDatasetRef struct {
+	Dataset string
+	Role    string
+}
+
+// DatasetRefs lists every dataset the job config refers to: the dataset of a DatasetSource, the
+// main dataset and the dependencies of a MultiSource, the datasets of a UnionDatasetSource, the
+// dataset of a DatasetSink, and the monitored dataset of onchange triggers.
+func (job *Job) DatasetRefs() []JobDatasetRef {
+	refs := make([]JobDatasetRef, 0)
+	job.visitDatasets(func(role string, name string) string {
+		refs = append(refs, JobDatasetRef{Dataset: name, Role: role})
+		return name
+	})
+	return refs
+}
+
+// ReferencesDataset returns true if the job config refers to the dataset in any way
+func (job *Job) ReferencesDataset(name string) bool {
+	for _, ref := range job.DatasetRefs() {
+		if ref.Dataset == name {
+			return true
+		}
+	}
+	return false
+}
+
+// RenameDataset replaces every reference to the dataset in the job config, and returns
+// true if anything was changed.
+func (job *Job) RenameDataset(from string, to string) bool {
+	changed := false
+	job.visitDatasets(renameVisitor(map[string]string{from: to}, &changed))
+	return changed
+}
+
+// RenameConfigDatasets is like RenameDataset for a job config as it is read from the server, so
+// that fields the Job type does not have are kept. Every reference is looked up once in renames,
+// which maps old names to new names, so chains and swaps of names are applied correctly.
+func RenameConfigDatasets(config map[string]interface{}, renames map[string]string) bool {
+	changed := false
+	visit := renameVisitor(renames, &changed)
+	if source, ok := config["source"].(map[string]interface{}); ok {
+		visitSourceDatasets(source, visit)
+	}
+	if sink, ok := config["sink"].(map[string]interface{}); ok && sink["Type"] == "DatasetSink" {
+		visitName(sink, "Name", RoleSink, visit)
+	}
+	for _, trigger := range asMaps(config["triggers"]) {
+		visitName(trigger, "monitoredDataset", RoleTrigger, visit)
+	}
+	return changed
+}
+
+func renameVisitor(renames map[string]string, changed *bool) func(role string, name string) string {
+	return func(role string, name string) string {
+		if to, ok := renames[name]; ok && to != name {
+			*changed = true
+			return to
+		}
+		return name
+	}
+}
+
+// Clone returns a deep copy of the job, so that it can be changed without touching the original
+func (job *Job) Clone() (*Job, error) {
+	b, err := json.Marshal(job)
+	if err != nil {
+		return nil, err
+	}
+	clone := &Job{}
+	err = json.Unmarshal(b, clone)
+	return clone, err
+}
+
+// visitDatasets calls visit for every dataset name in the job config, and replaces the name with
+// what visit returns.
+func (job *Job) visitDatasets(visit func(role string, name string) string) {
+	visitSourceDatasets(job.Source, visit)
+
+	if job.Sink != nil && job.Sink["Type"] == "DatasetSink" {
+		visitName(job.Sink, "Name", RoleSink, visit)
+	}
+
+	for i, trigger := range job.Triggers {
+		if trigger.MonitoredDataset != "" {
+			job.Triggers[i].MonitoredDataset = visit(RoleTrigger, trigger.MonitoredDataset)
+		}
+	}
+}
+
+func visitSourceDatasets(source map[string]interface{}, visit func(role string, name string) string) {
+	if source == nil {
+		return
+	}
+	switch source["Type"] {
+	case "DatasetSource":
+		visitName(source, "Name", RoleSource, visit)
+	case "MultiSource":
+		visitName(source, "Name", RoleSource, visit)
+		for _, dep := range asMaps(source["Dependencies"]) {
+			visitName(dep, "dataset", RoleDependency, visit)
+			for _, join := range asMaps(dep["joins"]) {
+				visitName(join, "dataset", RoleDependency, visit)
+			}
+		}
+	case "UnionDatasetSource":
+		for _, ds := range asMaps(source["DatasetSources"]) {
+			visitSourceDatasets(ds, visit)
+		}
+	}
+}
+
+func visitName(config map[string]interface{}, key string, role string, visit func(role string, name string) string) {
+	if name, ok := config[key].(string); ok && name != "" {
+		config[key] = visit(role, name)
+	}
+}
+
+func asMaps(value interface{}) []map[string]interface{} {
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil
+	}
+	maps := make([]map[string]interface{}, 0, len(list))
+	for _, item := range list {
+		if m, ok := item.(map[string]interface{}); ok {
+			maps = append(maps, m)
+		}
+	}
+	return maps
+}
@@ -0,0 +1,88 @@
+// Copyright 2021 MIMIRO AS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+func TestJobDatasetRefs(t *testing.T) {
+	g := goblin.Goblin(t)
+	parse := func(config string) *Job {
+		job := &Job{}
+		if err := json.Unmarshal([]byte(config), job); err != nil {
+			g.Fail(err)
+		}
+		return job
+	}
+	g.Describe("dataset references in job configs", func() {
+		g.It("should find datasets in a MultiSource job", func() {
+			job := parse(`{"id": "j1",
+				"source": {"Type": "MultiSource", "Name": "people", "Dependencies": [
+					{"dataset": "addresses", "joins": [{"dataset": "homes", "predicate": "ns1:address", "inverse": true}]}
+				]},
+				"sink": {"Type": "DatasetSink", "Name": "people.out"},
+				"triggers": [{"triggerType": "onchange", "monitoredDataset": "people"}]}`)
+			g.Assert(job.DatasetRefs()).Equal([]JobDatasetRef{
+				{Dataset: "people", Role: RoleSource},
+				{Dataset: "addresses", Role: RoleDependency},
+				{Dataset: "homes", Role: RoleDependency},
+				{Dataset: "people.out", Role: RoleSink},
+				{Dataset: "people", Role: RoleTrigger},
+			})
+		})
+		g.It("should find datasets in a UnionDatasetSource job", func() {
+			job := parse(`{"id": "j2",
+				"source": {"Type": "UnionDatasetSource", "DatasetSources": [
+					{"Type": "DatasetSource", "Name": "a"}, {"Type": "DatasetSource", "Name": "b"}
+				]},
+				"sink": {"Type": "HttpDatasetSink", "Url": "http://example.io"}}`)
+			g.Assert(job.DatasetRefs()).Equal([]JobDatasetRef{
+				{Dataset: "a", Role: RoleSource},
+				{Dataset: "b", Role: RoleSource},
+			})
+		})
+		g.It("should rename every reference", func() {
+			job := parse(`{"id": "j3",
+				"source": {"Type": "MultiSource", "Name": "people", "Dependencies": [
+					{"dataset": "people", "joins": [{"dataset": "people"}]}
+				]},
+				"sink": {"Type": "DatasetSink", "Name": "out"},
+				"triggers": [{"triggerType": "onchange", "monitoredDataset": "people"}]}`)
+			g.Assert(job.RenameDataset("people", "persons")).IsTrue()
+			g.Assert(job.ReferencesDataset("people")).IsFalse()
+			g.Assert(len(job.DatasetRefs())).Equal(5)
+			g.Assert(job.RenameDataset("people", "persons")).IsFalse()
+		})
+		g.It("should rename each reference once in a raw config", func() {
+			config := make(map[string]interface{})
+			g.Assert(json.Unmarshal([]byte(`{"id": "j4", "custom": {"kept": true},
+				"source": {"Type": "MultiSource", "Name": "a", "Dependencies": [{"dataset": "b"}]},
+				"sink": {"Type": "DatasetSink", "Name": "c"},
+				"triggers": [{"triggerType": "onchange", "monitoredDataset": "a"}]}`), &config)).IsNil()
+			// a and b are swapped, and c is renamed in a chain c to d and d to e
+			g.Assert(RenameConfigDatasets(config, map[string]string{"a": "b", "b": "a", "c": "d", "d": "e"})).IsTrue()
+			g.Assert(config["source"].(map[string]interface{})["Name"]).Equal("b")
+			g.Assert(asMaps(config["source"].(map[string]interface{})["Dependencies"])[0]["dataset"]).Equal("a")
+			g.Assert(config["sink"].(map[string]interface{})["Name"]).Equal("d")
+			g.Assert(asMaps(config["triggers"])[0]["monitoredDataset"]).Equal("b")
+			g.Assert(config["custom"]).Equal(map[string]interface{}{"kept": true})
+			g.Assert(RenameConfigDatasets(config, map[string]string{"x": "y"})).IsFalse()
+		})
+	})
+}
@@ -78,6 +78,7 @@ func addCommands() {
 	RootCmd.AddCommand(command.ProviderCmd)
 	RootCmd.AddCommand(command.VersionCmd)
 	RootCmd.AddCommand(command.GatewayCmd)
+	RootCmd.AddCommand(command.ExporterCmd)
 	RootCmd.AddCommand(command.StatsCmd)
 	RootCmd.AddCommand(command.LineageCmd)
 }